@@ -1,11 +1,15 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"template-echo-notion-integration/config"
 	"template-echo-notion-integration/internal/handler"
+	"template-echo-notion-integration/internal/hub"
 	"template-echo-notion-integration/internal/repository"
 	"template-echo-notion-integration/internal/service"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/labstack/echo/v4"
@@ -23,30 +27,52 @@ func main() {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: appConfig.AllowOrigins,
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPost, http.MethodDelete},
+		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
 	}))
 
-	kaimemoRepository := repository.NewNotionRepository(
-		appConfig.NotionAPIKey,
-		appConfig.NotionKaimemoDatabaseInputID,
-		appConfig.NotionKaimemoDatabaseSummaryRecordID,
-	)
-	kaimemoService := service.NewKaimemoService(kaimemoRepository)
-	kaimemoHandler := handler.NewKaimemoHandler(kaimemoService)
+	// ログインで作ったセッションと発行したチケットで、WebSocket・Server-Sent Eventsの接続を認証する
+	sessionManager := service.NewSessionManager(newSessionStore(appConfig), appConfig.SessionTTL)
+	go purgeExpiredSessions(sessionManager, time.Hour)
+	ticketManager := service.NewTicketManager([]byte(appConfig.JWTSecret), time.Minute)
 
-	lineRepository := repository.NewLineRepository(appConfig.LINEConfig)
-	lineAuthService := service.NewLineAuthService(lineRepository)
+	lineRepository := repository.NewLineRepository(appConfig.LINEConfig, repository.NewLineIDTokenVerifier(
+		appConfig.LINEConfig.ClientID,
+		appConfig.LINEConfig.ClientSecret,
+		newLineKeySet(appConfig),
+	))
+	// ログインからコールバックまでの状態は、10分以内に使い切る署名付きのクッキーに保存する
+	loginStateManager := service.NewLoginStateManager([]byte(appConfig.JWTSecret), 10*time.Minute)
+	kaimemoRepository := newKaimemoRepository(appConfig)
+	userRepository := newUserRepository(appConfig)
+	lineAuthService := service.NewLineAuthService(lineRepository, userRepository, kaimemoRepository, sessionManager, ticketManager, loginStateManager)
 	lineAuthHandler := handler.NewLineAuthHandler(lineAuthService, appConfig.LINEConfig)
 
+	kaimemoService := service.NewKaimemoService(kaimemoRepository)
+	kaimemoHub := hub.New(hub.WithPresence(handler.KaimemoPresenceTelegraph))
+	go kaimemoHub.Run()
+	kaimemoHandler := handler.NewKaimemoHandler(
+		kaimemoService,
+		kaimemoHub,
+		service.NewAuthenticator(sessionManager, ticketManager, userRepository),
+		appConfig.AllowOrigins,
+		appConfig.AdminUserIDs,
+	)
+
 	kaimemo := e.Group("/kaimemo")
 	kaimemo.GET("", kaimemoHandler.FetchKaimemo)
+	kaimemo.GET("/page", kaimemoHandler.FetchKaimemoPage)
 	kaimemo.POST("", kaimemoHandler.CreateKaimemo)
+	kaimemo.PATCH("/:id", kaimemoHandler.UpdateKaimemo)
 	kaimemo.DELETE("/:id", kaimemoHandler.RemoveKaimemo)
 
 	kaimemo.GET("/ws", kaimemoHandler.WebsocketTelegraph)
+	kaimemo.GET("/ws/stats", kaimemoHandler.FetchWebsocketStats)
+	kaimemo.GET("/events", kaimemoHandler.StreamKaimemoEvents)
+	kaimemo.GET("/presence", kaimemoHandler.FetchKaimemoPresence)
 
 	kaimemo.GET("/summary", kaimemoHandler.FetchKaimemoSummaryRecord)
 	kaimemo.POST("/summary", kaimemoHandler.CreateKaimemoAmount)
+	kaimemo.PUT("/summary/:id", kaimemoHandler.UpdateKaimemoAmount)
 	kaimemo.DELETE("/summary/:id", kaimemoHandler.RemoveKaimemoAmount)
 
 	lineAuth := e.Group("/line")
@@ -54,7 +80,101 @@ func main() {
 	lineAuth.GET("/callback", lineAuthHandler.Callback)
 	lineAuth.GET("/logout", lineAuthHandler.Logout)
 	lineAuth.GET("/me", lineAuthHandler.FetchMe)
+	lineAuth.POST("/ticket", lineAuthHandler.IssueTicket)
+	lineAuth.POST("/link", lineAuthHandler.LinkTempUser)
 
 	port := "3000"
 	e.Logger.Fatal(e.Start(":" + port))
 }
+
+// newKaimemoRepository は、設定されたバックエンドに応じてKaimemoRepositoryを生成する
+func newKaimemoRepository(appConfig *config.AppConfig) repository.KaimemoRepository {
+	switch appConfig.KaimemoBackend {
+	case config.KaimemoBackendSQLite:
+		kaimemoRepository, err := repository.NewSQLiteRepository(appConfig.SQLitePath)
+		if err != nil {
+			log.Fatalf("failed to open sqlite: %v", err)
+		}
+		return kaimemoRepository
+	case config.KaimemoBackendMemory:
+		return repository.NewMemoryRepository()
+	default:
+		kaimemoRepository := repository.NewNotionRepository(
+			appConfig.NotionAPIKey,
+			appConfig.NotionKaimemoDatabaseInputID,
+			appConfig.NotionKaimemoDatabaseSummaryRecordID,
+			repository.WithUserPropertyType(appConfig.NotionUserPropertyType),
+			repository.WithPropertyMapping(appConfig.NotionPropertyMapping.Repository()),
+		)
+		validateNotionSchema(kaimemoRepository.(repository.SchemaValidator), "run `go run ./cmd/notion bootstrap` to fix the databases")
+		return kaimemoRepository
+	}
+}
+
+// validateNotionSchema は、プロパティの不備を、空の項目として表に出る前に起動時に検出する。
+// Notionに一時的に接続できないだけなら、起動は止めない。hintは不備の直し方
+func validateNotionSchema(validator repository.SchemaValidator, hint string) {
+	var schemaErr *repository.SchemaError
+	if err := validator.ValidateSchema(); errors.As(err, &schemaErr) {
+		log.Fatalf("%v\n%s", err, hint)
+	} else if err != nil {
+		log.Printf("skipped notion schema validation: %v", err)
+	}
+}
+
+// newSessionStore は、設定された保存先に応じてSessionStoreを生成する
+func newSessionStore(appConfig *config.AppConfig) repository.SessionStore {
+	if appConfig.SessionBackend == config.SessionBackendSQLite {
+		sessionStore, err := repository.NewSQLiteSessionStore(appConfig.SQLitePath)
+		if err != nil {
+			log.Fatalf("failed to open sqlite: %v", err)
+		}
+		return sessionStore
+	}
+	return repository.NewMemorySessionStore()
+}
+
+// newUserRepository は、設定された保存先に応じてUserRepositoryを生成する
+func newUserRepository(appConfig *config.AppConfig) repository.UserRepository {
+	switch appConfig.UserBackend {
+	case config.UserBackendSQLite:
+		userRepository, err := repository.NewSQLiteUserRepository(appConfig.SQLitePath)
+		if err != nil {
+			log.Fatalf("failed to open sqlite: %v", err)
+		}
+		return userRepository
+	case config.UserBackendNotion:
+		userRepository := repository.NewNotionUserRepository(
+			appConfig.NotionAPIKey,
+			appConfig.NotionUserDatabaseID,
+			repository.WithPropertyMapping(appConfig.NotionPropertyMapping.Repository()),
+		)
+		validateNotionSchema(userRepository.(repository.SchemaValidator), "add the properties to NOTION_DATABASE_USER or map them in NOTION_PROPERTY_MAPPING")
+		return userRepository
+	default:
+		return repository.NewMemoryUserRepository()
+	}
+}
+
+// newLineKeySet は、IDトークンの署名を検証する公開鍵を、設定に応じてファイルまたはLINEから読み込む
+func newLineKeySet(appConfig *config.AppConfig) repository.KeySet {
+	if appConfig.LineJWKSFile != "" {
+		keySet, err := repository.NewFileKeySet(appConfig.LineJWKSFile)
+		if err != nil {
+			log.Fatalf("failed to load LINE_JWKS_FILE: %v", err)
+		}
+		return keySet
+	}
+	return repository.NewJWKSKeySet(appConfig.LineJWKSURL, &http.Client{Timeout: 10 * time.Second}, 24*time.Hour)
+}
+
+// purgeExpiredSessions は、期限が切れたまま使われないセッションをintervalごとに削除する
+func purgeExpiredSessions(sessionManager service.SessionManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := sessionManager.PurgeExpiredSessions(); err != nil {
+			log.Printf("failed to purge expired sessions: %v", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"template-echo-notion-integration/config"
+	"template-echo-notion-integration/internal/repository"
+)
+
+const usage = `usage: go run ./cmd/notion <command> [flags]
+
+commands:
+  validate           データベースのプロパティ構成を検証する。NOTION_DATABASE_USERを設定していれば、利用者のデータベースも検証する
+  bootstrap [-force] データベースを作成し、不足しているプロパティを追加する。
+                     -forceを指定すると、型の異なるプロパティの型も変更する（既存の値が失われる場合がある）
+  migrate-userkey    tempUserIDの値をuserKey（セレクト）プロパティへ移行する`
+
+// Notionデータベースの運用コマンド
+// export XXで NOTION_API_KEY などを設定してから実行する
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "validate":
+		appConfig := config.LoadNotionConfig()
+		if err := newSchemaManager(appConfig).ValidateSchema(); err != nil {
+			log.Fatal(err)
+		}
+		// 利用者をNotionに保存する場合は、利用者のデータベースも検証する
+		if appConfig.NotionUserDatabaseID != "" {
+			userRepository := repository.NewNotionUserRepository(
+				appConfig.NotionAPIKey,
+				appConfig.NotionUserDatabaseID,
+				repository.WithPropertyMapping(appConfig.NotionPropertyMapping.Repository()),
+			)
+			if err := userRepository.(repository.SchemaValidator).ValidateSchema(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		log.Println("notion schema is valid")
+	case "bootstrap":
+		flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+		force := flags.Bool("force", false, "change the type of wrong-typed properties (existing values may be lost)")
+		flags.Parse(os.Args[2:])
+
+		appConfig := config.LoadNotionBootstrapConfig()
+		result, err := newSchemaManager(appConfig).BootstrapSchema(appConfig.NotionParentPageID, *force)
+		for _, change := range result.Changes {
+			log.Println(change)
+		}
+		for label, id := range result.CreatedDatabases {
+			log.Printf("created %s database: %s", label, id)
+		}
+		if err != nil {
+			log.Fatalf("failed to bootstrap: %v", err)
+		}
+		if len(result.CreatedDatabases) > 0 {
+			log.Println("set NOTION_DATABASE_KAIMEMO_INPUT / NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD to the created database ids")
+		}
+	case "migrate-userkey":
+		appConfig := config.LoadNotionConfig()
+		migrator := newKaimemoRepository(appConfig).(repository.UserKeyMigrator)
+		result, err := migrator.MigrateUserKey()
+		if err != nil {
+			log.Fatalf("failed to migrate userKey (migrated %d so far, rerun to resume): %v", result.Migrated, err)
+		}
+		log.Printf("migrated %d pages, skipped %d pages without tempUserID or with commas in it", result.Migrated, result.Skipped)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func newKaimemoRepository(appConfig *config.AppConfig) repository.KaimemoRepository {
+	return repository.NewNotionRepository(
+		appConfig.NotionAPIKey,
+		appConfig.NotionKaimemoDatabaseInputID,
+		appConfig.NotionKaimemoDatabaseSummaryRecordID,
+		repository.WithUserPropertyType(appConfig.NotionUserPropertyType),
+		repository.WithPropertyMapping(appConfig.NotionPropertyMapping.Repository()),
+	)
+}
+
+func newSchemaManager(appConfig *config.AppConfig) repository.SchemaManager {
+	return newKaimemoRepository(appConfig).(repository.SchemaManager)
+}
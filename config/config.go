@@ -1,20 +1,123 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"template-echo-notion-integration/internal/repository"
+	"time"
 
 	"golang.org/x/oauth2"
 )
 
+// KaimemoBackend の選択肢
+const (
+	KaimemoBackendNotion = "notion"
+	KaimemoBackendSQLite = "sqlite"
+	KaimemoBackendMemory = "memory"
+)
+
+// SessionBackend の選択肢
+const (
+	SessionBackendMemory = "memory"
+	SessionBackendSQLite = "sqlite"
+)
+
+// UserBackend の選択肢
+const (
+	UserBackendMemory = "memory"
+	UserBackendSQLite = "sqlite"
+	UserBackendNotion = "notion"
+)
+
+// defaultLineJWKSURL は、LINEがIDトークンの署名に使う公開鍵のURL
+const defaultLineJWKSURL = "https://api.line.me/oauth2/v2.1/certs"
+
+// セッションの期限のデフォルト。最後に使われてからこの時間が過ぎるとログインし直す
+const defaultSessionTTL = 24 * time.Hour
+
+// NotionUserPropertyType の選択肢。repository.UserPropertyRichText / UserPropertySelect と対応する
+const (
+	NotionUserPropertyRichText = "rich_text"
+	NotionUserPropertySelect   = "select"
+)
+
 type AppConfig struct {
 	Port                                 string
+	KaimemoBackend                       string
+	SQLitePath                           string
 	NotionAPIKey                         string
 	NotionKaimemoDatabaseInputID         string
 	NotionKaimemoDatabaseSummaryRecordID string
+	NotionUserPropertyType               string
+	NotionParentPageID                   string
+	NotionPropertyMapping                NotionPropertyMapping
 	AllowOrigins                         []string
+	// AdminUserIDs は、WebSocketの接続状況を参照できる利用者（ADMIN_USER_IDS、カンマ区切り）
+	AdminUserIDs []string
+	// JWTSecret は、WebSocket接続用のチケットの署名鍵（LINE_JWT_SECRET）
+	JWTSecret string
+	// SessionBackend は、LINEログインのセッションの保存先。sqliteの場合はSQLitePathに保存する
+	SessionBackend string
+	SessionTTL     time.Duration
+	// UserBackend は、LINEログインした利用者の保存先。sqliteの場合はSQLitePathに保存する
+	UserBackend string
+	// NotionUserDatabaseID は、UserBackendがnotionの場合に利用者を保存するデータベース（NOTION_DATABASE_USER）
+	NotionUserDatabaseID string
 	// LINEConfig                           *LINEConfig
 	LINEConfig *oauth2.Config
+	// LineJWKSURL は、IDトークンの署名を検証する公開鍵の取得先（LINE_JWKS_URL）
+	LineJWKSURL string
+	// LineJWKSFile は、指定するとLineJWKSURLの代わりに使うJWKSのファイル（LINE_JWKS_FILE）。LINEに接続しないローカル開発向け
+	LineJWKSFile string
+}
+
+// NotionPropertyMapping は、NOTION_PROPERTY_MAPPING（JSON）で指定するNotionのプロパティ名。
+// repository.NotionPropertyMapping と対応する。未指定の項目はテンプレートのデータベースの名前を使う
+//
+//	{"input": {"name": "品名", "tag": "分類"}, "summary": {"date": "日付", "amount": "金額"}, "users": {"name": "表示名"}}
+type NotionPropertyMapping struct {
+	Input   NotionInputProperties   `json:"input"`
+	Summary NotionSummaryProperties `json:"summary"`
+	Users   NotionUserProperties    `json:"users"`
+}
+
+// Repository は、リポジトリのオプションに渡すプロパティ名に変換する
+func (m NotionPropertyMapping) Repository() repository.NotionPropertyMapping {
+	return repository.NotionPropertyMapping{
+		Input:   repository.NotionInputProperties(m.Input),
+		Summary: repository.NotionSummaryProperties(m.Summary),
+		Users:   repository.NotionUserProperties(m.Users),
+	}
+}
+
+// NotionInputProperties は、買い物メモのデータベースのプロパティ名
+type NotionInputProperties struct {
+	TempUserID string `json:"tempUserID"`
+	UserKey    string `json:"userKey"`
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	Done       string `json:"done"`
+}
+
+// NotionSummaryProperties は、買い物集計のデータベースのプロパティ名
+type NotionSummaryProperties struct {
+	TempUserID string `json:"tempUserID"`
+	UserKey    string `json:"userKey"`
+	Date       string `json:"date"`
+	Tag        string `json:"tag"`
+	Amount     string `json:"amount"`
+}
+
+// NotionUserProperties は、利用者のデータベース（NOTION_DATABASE_USER）のプロパティ名
+type NotionUserProperties struct {
+	Name              string `json:"name"`
+	UserID            string `json:"userId"`
+	PictureURL        string `json:"pictureUrl"`
+	LinkedTempUserIDs string `json:"linkedTempUserIds"`
+	LastLoginAt       string `json:"lastLoginAt"`
 }
 
 type LINEConfig struct {
@@ -33,18 +136,100 @@ func LoadConfig() *AppConfig {
 	// }
 
 	apiKey := os.Getenv("NOTION_API_KEY")
-	if apiKey == "" {
-		log.Fatal("NOTION_API_KEY is not set")
+
+	// 未指定の場合、NOTION_API_KEYがなければインメモリで起動する
+	kaimemoBackend := os.Getenv("KAIMEMO_BACKEND")
+	if kaimemoBackend == "" {
+		kaimemoBackend = KaimemoBackendNotion
+		if apiKey == "" {
+			kaimemoBackend = KaimemoBackendMemory
+		}
 	}
 
-	notionKaimemoDatabaseInputID := os.Getenv("NOTION_DATABASE_KAIMEMO_INPUT")
-	if notionKaimemoDatabaseInputID == "" {
-		log.Fatal("NOTION_DATABASE_KAIMEMO_INPUT is not set")
+	notion := &AppConfig{}
+	sqlitePath := os.Getenv("SQLITE_PATH")
+
+	switch kaimemoBackend {
+	case KaimemoBackendNotion:
+		notion = LoadNotionConfig()
+	case KaimemoBackendSQLite:
+		if sqlitePath == "" {
+			sqlitePath = "kaimemo.db"
+		}
+	case KaimemoBackendMemory:
+		log.Println("KAIMEMO_BACKEND is memory: data will be lost on restart")
+	default:
+		log.Fatalf("KAIMEMO_BACKEND is invalid: %s", kaimemoBackend)
 	}
 
-	notionKaimemoDatabaseSummaryRecordID := os.Getenv("NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD")
-	if notionKaimemoDatabaseSummaryRecordID == "" {
-		log.Fatal("NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD is not set")
+	// 未指定の場合、買い物メモをSQLiteに保存するならセッションも同じファイルに保存する
+	sessionBackend := os.Getenv("SESSION_BACKEND")
+	if sessionBackend == "" {
+		sessionBackend = SessionBackendMemory
+		if kaimemoBackend == KaimemoBackendSQLite {
+			sessionBackend = SessionBackendSQLite
+		}
+	}
+	switch sessionBackend {
+	case SessionBackendMemory:
+		log.Println("SESSION_BACKEND is memory: logins will be lost on restart")
+	case SessionBackendSQLite:
+		if sqlitePath == "" {
+			sqlitePath = "kaimemo.db"
+		}
+	default:
+		log.Fatalf("SESSION_BACKEND is invalid: %s", sessionBackend)
+	}
+
+	// 未指定の場合、買い物メモと同じ保存先を使う。Notionの利用者データベースがなければインメモリにする
+	notionUserDatabaseID := os.Getenv("NOTION_DATABASE_USER")
+	userBackend := os.Getenv("USER_BACKEND")
+	if userBackend == "" {
+		userBackend = kaimemoBackend
+		if kaimemoBackend == KaimemoBackendNotion && notionUserDatabaseID == "" {
+			userBackend = UserBackendMemory
+		}
+	}
+	switch userBackend {
+	case UserBackendMemory:
+		log.Println("USER_BACKEND is memory: users will be lost on restart")
+	case UserBackendSQLite:
+		if sqlitePath == "" {
+			sqlitePath = "kaimemo.db"
+		}
+	case UserBackendNotion:
+		if apiKey == "" {
+			log.Fatal("NOTION_API_KEY is not set")
+		}
+		if notionUserDatabaseID == "" {
+			log.Fatal("NOTION_DATABASE_USER is not set")
+		}
+		// 買い物メモをNotionに保存しない場合も、利用者のプロパティ名は対応付けられる
+		if kaimemoBackend != KaimemoBackendNotion {
+			propertyMapping, err := parseNotionPropertyMapping(os.Getenv("NOTION_PROPERTY_MAPPING"))
+			if err != nil {
+				log.Fatalf("NOTION_PROPERTY_MAPPING is invalid: %v", err)
+			}
+			notion.NotionPropertyMapping = propertyMapping
+		}
+	default:
+		log.Fatalf("USER_BACKEND is invalid: %s", userBackend)
+	}
+
+	sessionTTL := defaultSessionTTL
+	if value := os.Getenv("SESSION_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			log.Fatalf("SESSION_TTL is invalid: %s", value)
+		}
+		sessionTTL = ttl
+	}
+
+	var adminUserIDs []string
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			adminUserIDs = append(adminUserIDs, id)
+		}
 	}
 
 	frontEndUrl := os.Getenv("FRONTEND_URL")
@@ -64,15 +249,20 @@ func LoadConfig() *AppConfig {
 	if lineJwtSecret == "" {
 		log.Fatal("LINE_JWT_SECRET is not set")
 	}
-	lineState := os.Getenv("LINE_STATE")
-	if lineState == "" {
-		log.Fatal("LINE_STATE is not set")
+	// stateはログインのたびに生成するため、固定のLINE_STATEは使わない
+	if os.Getenv("LINE_STATE") != "" {
+		log.Println("LINE_STATE is ignored: state is generated for each login")
 	}
 
 	lineRedirectURI := os.Getenv("LINE_REDIRECT_URI")
 	if lineRedirectURI == "" {
 		log.Fatal("LINE_REDIRECT is not set")
 	}
+	lineJWKSURL := os.Getenv("LINE_JWKS_URL")
+	if lineJWKSURL == "" {
+		lineJWKSURL = defaultLineJWKSURL
+	}
+
 	// lineTokenURL := os.Getenv("LINE_TOKEN_URL")
 	// if lineTokenURL == "" {
 	// 	log.Fatal("LINE_TOKEN_URL is not set")
@@ -80,12 +270,22 @@ func LoadConfig() *AppConfig {
 
 	return &AppConfig{
 		Port:                                 port,
+		KaimemoBackend:                       kaimemoBackend,
+		SQLitePath:                           sqlitePath,
 		NotionAPIKey:                         apiKey,
-		NotionKaimemoDatabaseInputID:         notionKaimemoDatabaseInputID,
-		NotionKaimemoDatabaseSummaryRecordID: notionKaimemoDatabaseSummaryRecordID,
+		NotionKaimemoDatabaseInputID:         notion.NotionKaimemoDatabaseInputID,
+		NotionKaimemoDatabaseSummaryRecordID: notion.NotionKaimemoDatabaseSummaryRecordID,
+		NotionUserPropertyType:               notion.NotionUserPropertyType,
+		NotionPropertyMapping:                notion.NotionPropertyMapping,
 		AllowOrigins: []string{
 			"http://localhost:5173", "http://localhost:4173", frontEndUrl,
 		},
+		AdminUserIDs:         adminUserIDs,
+		JWTSecret:            lineJwtSecret,
+		SessionBackend:       sessionBackend,
+		SessionTTL:           sessionTTL,
+		UserBackend:          userBackend,
+		NotionUserDatabaseID: notionUserDatabaseID,
 		// LINEConfig: &LINEConfig{
 		// 	ClientID:     lineClientID,
 		// 	ClientSecret: lineClientSecret,
@@ -103,5 +303,134 @@ func LoadConfig() *AppConfig {
 				TokenURL: "https://api.line.me/oauth2/v2.1/token",
 			},
 		},
+		LineJWKSURL:  lineJWKSURL,
+		LineJWKSFile: os.Getenv("LINE_JWKS_FILE"),
+	}
+}
+
+// LoadNotionConfig は、Notion関連の設定のみを読み込む。cmd/notionの運用コマンドからも使う
+func LoadNotionConfig() *AppConfig {
+	appConfig := readNotionConfig()
+
+	if appConfig.NotionKaimemoDatabaseInputID == "" {
+		log.Fatal("NOTION_DATABASE_KAIMEMO_INPUT is not set")
+	}
+	if appConfig.NotionKaimemoDatabaseSummaryRecordID == "" {
+		log.Fatal("NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD is not set")
+	}
+
+	return appConfig
+}
+
+// LoadNotionBootstrapConfig は、データベース作成用の設定を読み込む。
+// 未設定のデータベースはNOTION_PARENT_PAGE_IDのページ配下に作成する
+func LoadNotionBootstrapConfig() *AppConfig {
+	appConfig := readNotionConfig()
+
+	if (appConfig.NotionKaimemoDatabaseInputID == "" || appConfig.NotionKaimemoDatabaseSummaryRecordID == "") && appConfig.NotionParentPageID == "" {
+		log.Fatal("NOTION_PARENT_PAGE_ID is required to create NOTION_DATABASE_KAIMEMO_INPUT / NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD")
+	}
+
+	return appConfig
+}
+
+func readNotionConfig() *AppConfig {
+	apiKey := os.Getenv("NOTION_API_KEY")
+	if apiKey == "" {
+		log.Fatal("NOTION_API_KEY is not set")
+	}
+
+	notionUserPropertyType := os.Getenv("NOTION_USER_PROPERTY_TYPE")
+	switch notionUserPropertyType {
+	case "":
+		notionUserPropertyType = NotionUserPropertyRichText
+	case NotionUserPropertyRichText, NotionUserPropertySelect:
+	default:
+		log.Fatalf("NOTION_USER_PROPERTY_TYPE is invalid: %s", notionUserPropertyType)
+	}
+
+	propertyMapping, err := parseNotionPropertyMapping(os.Getenv("NOTION_PROPERTY_MAPPING"))
+	if err != nil {
+		log.Fatalf("NOTION_PROPERTY_MAPPING is invalid: %v", err)
+	}
+
+	return &AppConfig{
+		KaimemoBackend:                       KaimemoBackendNotion,
+		NotionAPIKey:                         apiKey,
+		NotionKaimemoDatabaseInputID:         os.Getenv("NOTION_DATABASE_KAIMEMO_INPUT"),
+		NotionKaimemoDatabaseSummaryRecordID: os.Getenv("NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD"),
+		NotionUserPropertyType:               notionUserPropertyType,
+		NotionParentPageID:                   os.Getenv("NOTION_PARENT_PAGE_ID"),
+		NotionPropertyMapping:                propertyMapping,
+		NotionUserDatabaseID:                 os.Getenv("NOTION_DATABASE_USER"),
+	}
+}
+
+// parseNotionPropertyMapping は、プロパティ名の対応を読み込み、同じデータベース内で名前が重複していないかを検証する
+func parseNotionPropertyMapping(value string) (NotionPropertyMapping, error) {
+	var mapping NotionPropertyMapping
+	if value == "" {
+		return mapping, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&mapping); err != nil {
+		return mapping, err
+	}
+
+	input := mapping.Input
+	if err := checkDuplicatePropertyNames("input", map[string]string{
+		"tempUserID": orDefault(input.TempUserID, "tempUserID"),
+		"userKey":    orDefault(input.UserKey, "userKey"),
+		"name":       orDefault(input.Name, "name"),
+		"tag":        orDefault(input.Tag, "tag"),
+		"done":       orDefault(input.Done, "done"),
+	}); err != nil {
+		return mapping, err
+	}
+	summary := mapping.Summary
+	if err := checkDuplicatePropertyNames("summary", map[string]string{
+		"tempUserID": orDefault(summary.TempUserID, "tempUserID"),
+		"userKey":    orDefault(summary.UserKey, "userKey"),
+		"date":       orDefault(summary.Date, "date"),
+		"tag":        orDefault(summary.Tag, "tag"),
+		"amount":     orDefault(summary.Amount, "amount"),
+	}); err != nil {
+		return mapping, err
+	}
+	users := mapping.Users
+	if err := checkDuplicatePropertyNames("users", map[string]string{
+		"name":              orDefault(users.Name, "name"),
+		"userId":            orDefault(users.UserID, "userId"),
+		"pictureUrl":        orDefault(users.PictureURL, "pictureUrl"),
+		"linkedTempUserIds": orDefault(users.LinkedTempUserIDs, "linkedTempUserIds"),
+		"lastLoginAt":       orDefault(users.LastLoginAt, "lastLoginAt"),
+	}); err != nil {
+		return mapping, err
+	}
+
+	return mapping, nil
+}
+
+func checkDuplicatePropertyNames(database string, names map[string]string) error {
+	used := map[string]string{}
+	for _, key := range []string{"tempUserID", "userKey", "name", "date", "tag", "done", "amount", "userId", "pictureUrl", "linkedTempUserIds", "lastLoginAt"} {
+		name, ok := names[key]
+		if !ok {
+			continue
+		}
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("%s.%s and %s.%s both use property %q", database, other, database, key, name)
+		}
+		used[name] = key
+	}
+	return nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
 	}
+	return value
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -55,8 +56,253 @@ func TestLoadConfig_Success(t *testing.T) {
 
 	assert.Equal(t, "test-client-id", config.LINEConfig.ClientID)
 	assert.Equal(t, "test-client-secret", config.LINEConfig.ClientSecret)
-	assert.Equal(t, "test-jwt-secret", config.LINEConfig.JwtSecret)
-	assert.Equal(t, "test-state", config.LINEConfig.State)
-	assert.Equal(t, "https://example.com/callback", config.LINEConfig.RedirectURI)
-	assert.Equal(t, "https://example.com/token", config.LINEConfig.TokenURL)
+	assert.Equal(t, "test-jwt-secret", config.JWTSecret)
+	assert.Equal(t, "https://example.com/callback", config.LINEConfig.RedirectURL)
+	assert.Equal(t, "https://api.line.me/oauth2/v2.1/token", config.LINEConfig.Endpoint.TokenURL)
+}
+
+func TestLoadConfig_DefaultBackend(t *testing.T) {
+	setEnv("NOTION_API_KEY", "test-api-key")
+	setEnv("NOTION_DATABASE_KAIMEMO_INPUT", "test-database-input-id")
+	setEnv("NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD", "test-database-summary-id")
+	setEnv("FRONTEND_URL", "https://example.com")
+	setEnv("LINE_CLIENT_ID", "test-client-id")
+	setEnv("LINE_CLIENT_SECRET", "test-client-secret")
+	setEnv("LINE_JWT_SECRET", "test-jwt-secret")
+	setEnv("LINE_REDIRECT_URI", "https://example.com/callback")
+	unsetEnv("KAIMEMO_BACKEND", "NOTION_USER_PROPERTY_TYPE")
+
+	defer unsetEnv("NOTION_API_KEY", "NOTION_DATABASE_KAIMEMO_INPUT", "NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD", "FRONTEND_URL")
+
+	// NOTION_API_KEYがあればNotionに保存し、完全一致の絞り込みはテキストのまま行う
+	config := LoadConfig()
+
+	assert.Equal(t, KaimemoBackendNotion, config.KaimemoBackend)
+	assert.Equal(t, NotionUserPropertyRichText, config.NotionUserPropertyType)
+}
+
+func TestLoadConfig_SQLiteBackend(t *testing.T) {
+	setEnv("KAIMEMO_BACKEND", "sqlite")
+	setEnv("FRONTEND_URL", "https://example.com")
+	setEnv("LINE_CLIENT_ID", "test-client-id")
+	setEnv("LINE_CLIENT_SECRET", "test-client-secret")
+	setEnv("LINE_JWT_SECRET", "test-jwt-secret")
+	setEnv("LINE_STATE", "test-state")
+	setEnv("LINE_REDIRECT_URI", "https://example.com/callback")
+	unsetEnv("NOTION_API_KEY", "NOTION_DATABASE_KAIMEMO_INPUT", "NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD", "SQLITE_PATH")
+
+	defer unsetEnv("KAIMEMO_BACKEND", "FRONTEND_URL")
+
+	// Notionの設定がなくても読み込める
+	config := LoadConfig()
+
+	assert.Equal(t, KaimemoBackendSQLite, config.KaimemoBackend)
+	assert.Equal(t, "kaimemo.db", config.SQLitePath)
+	assert.Empty(t, config.NotionAPIKey)
+	// セッションも同じファイルに保存する
+	assert.Equal(t, SessionBackendSQLite, config.SessionBackend)
+	assert.Equal(t, 24*time.Hour, config.SessionTTL)
+}
+
+func TestLoadConfig_MemoryBackendWithoutNotionAPIKey(t *testing.T) {
+	setEnv("FRONTEND_URL", "https://example.com")
+	setEnv("LINE_CLIENT_ID", "test-client-id")
+	setEnv("LINE_CLIENT_SECRET", "test-client-secret")
+	setEnv("LINE_JWT_SECRET", "test-jwt-secret")
+	setEnv("LINE_STATE", "test-state")
+	setEnv("LINE_REDIRECT_URI", "https://example.com/callback")
+	unsetEnv("KAIMEMO_BACKEND", "NOTION_API_KEY", "NOTION_DATABASE_KAIMEMO_INPUT", "NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD")
+
+	defer unsetEnv("FRONTEND_URL")
+
+	config := LoadConfig()
+
+	assert.Equal(t, KaimemoBackendMemory, config.KaimemoBackend)
+	assert.Equal(t, SessionBackendMemory, config.SessionBackend)
+}
+
+func TestLoadConfig_SessionBackend(t *testing.T) {
+	setEnv("FRONTEND_URL", "https://example.com")
+	setEnv("LINE_CLIENT_ID", "test-client-id")
+	setEnv("LINE_CLIENT_SECRET", "test-client-secret")
+	setEnv("LINE_JWT_SECRET", "test-jwt-secret")
+	setEnv("LINE_STATE", "test-state")
+	setEnv("LINE_REDIRECT_URI", "https://example.com/callback")
+	setEnv("SESSION_BACKEND", "sqlite")
+	setEnv("SESSION_TTL", "168h")
+	unsetEnv("KAIMEMO_BACKEND", "NOTION_API_KEY", "SQLITE_PATH")
+
+	defer unsetEnv("FRONTEND_URL", "SESSION_BACKEND", "SESSION_TTL")
+
+	// 買い物メモがインメモリでも、セッションだけSQLiteに保存できる
+	config := LoadConfig()
+
+	assert.Equal(t, KaimemoBackendMemory, config.KaimemoBackend)
+	assert.Equal(t, SessionBackendSQLite, config.SessionBackend)
+	assert.Equal(t, "kaimemo.db", config.SQLitePath)
+	assert.Equal(t, 7*24*time.Hour, config.SessionTTL)
+	assert.Equal(t, "test-jwt-secret", config.JWTSecret)
+	assert.Equal(t, "https://api.line.me/oauth2/v2.1/certs", config.LineJWKSURL)
+}
+
+func TestLoadConfig_UserBackend(t *testing.T) {
+	setEnv("FRONTEND_URL", "https://example.com")
+	setEnv("LINE_CLIENT_ID", "test-client-id")
+	setEnv("LINE_CLIENT_SECRET", "test-client-secret")
+	setEnv("LINE_JWT_SECRET", "test-jwt-secret")
+	setEnv("LINE_REDIRECT_URI", "https://example.com/callback")
+	unsetEnv("KAIMEMO_BACKEND", "SESSION_BACKEND", "NOTION_API_KEY", "SQLITE_PATH", "USER_BACKEND", "NOTION_DATABASE_USER")
+
+	defer unsetEnv("FRONTEND_URL")
+
+	testCases := []struct {
+		name          string
+		env           map[string]string
+		expected      string
+		expectedPath  string
+		expectedUsers NotionUserProperties
+	}{
+		{
+			name:     "follows memory kaimemo backend",
+			expected: UserBackendMemory,
+		},
+		{
+			name:         "follows sqlite kaimemo backend",
+			env:          map[string]string{"KAIMEMO_BACKEND": "sqlite"},
+			expected:     UserBackendSQLite,
+			expectedPath: "kaimemo.db",
+		},
+		{
+			name:     "notion kaimemo backend without user database",
+			env:      map[string]string{"KAIMEMO_BACKEND": "notion", "NOTION_API_KEY": "test-api-key", "NOTION_DATABASE_KAIMEMO_INPUT": "test-input-db", "NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD": "test-summary-db"},
+			expected: UserBackendMemory,
+		},
+		{
+			name:     "follows notion kaimemo backend",
+			env:      map[string]string{"KAIMEMO_BACKEND": "notion", "NOTION_API_KEY": "test-api-key", "NOTION_DATABASE_KAIMEMO_INPUT": "test-input-db", "NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD": "test-summary-db", "NOTION_DATABASE_USER": "test-user-db"},
+			expected: UserBackendNotion,
+		},
+		{
+			// 買い物メモがインメモリでも、利用者だけNotionに保存できる
+			name:          "notion user backend",
+			env:           map[string]string{"KAIMEMO_BACKEND": "memory", "USER_BACKEND": "notion", "NOTION_API_KEY": "test-api-key", "NOTION_DATABASE_USER": "test-user-db", "NOTION_PROPERTY_MAPPING": `{"users":{"name":"表示名"}}`},
+			expected:      UserBackendNotion,
+			expectedUsers: NotionUserProperties{Name: "表示名"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, value := range tc.env {
+				setEnv(key, value)
+			}
+			defer func() {
+				for key := range tc.env {
+					unsetEnv(key)
+				}
+			}()
+
+			config := LoadConfig()
+
+			assert.Equal(t, tc.expected, config.UserBackend)
+			assert.Equal(t, tc.expectedPath, config.SQLitePath)
+			assert.Equal(t, tc.env["NOTION_DATABASE_USER"], config.NotionUserDatabaseID)
+			assert.Equal(t, tc.expectedUsers, config.NotionPropertyMapping.Users)
+		})
+	}
+}
+
+func TestLoadNotionConfig(t *testing.T) {
+	setEnv("NOTION_API_KEY", "test-api-key")
+	setEnv("NOTION_DATABASE_KAIMEMO_INPUT", "test-database-input-id")
+	setEnv("NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD", "test-database-summary-id")
+	setEnv("NOTION_USER_PROPERTY_TYPE", "select")
+
+	defer unsetEnv("NOTION_API_KEY", "NOTION_DATABASE_KAIMEMO_INPUT", "NOTION_DATABASE_KAIMEMO_SUMMARY_RECORD", "NOTION_USER_PROPERTY_TYPE")
+
+	// LINEの設定がなくても読み込める
+	config := LoadNotionConfig()
+
+	assert.Equal(t, "test-api-key", config.NotionAPIKey)
+	assert.Equal(t, NotionUserPropertySelect, config.NotionUserPropertyType)
+}
+
+func TestLoadNotionBootstrapConfig(t *testing.T) {
+	setEnv("NOTION_API_KEY", "test-api-key")
+	setEnv("NOTION_PARENT_PAGE_ID", "test-parent-page-id")
+
+	defer unsetEnv("NOTION_API_KEY", "NOTION_PARENT_PAGE_ID")
+
+	// データベースIDが未設定でも親ページがあれば読み込める
+	config := LoadNotionBootstrapConfig()
+
+	assert.Empty(t, config.NotionKaimemoDatabaseInputID)
+	assert.Empty(t, config.NotionKaimemoDatabaseSummaryRecordID)
+	assert.Equal(t, "test-parent-page-id", config.NotionParentPageID)
+	assert.Equal(t, NotionUserPropertyRichText, config.NotionUserPropertyType)
+}
+
+func TestParseNotionPropertyMapping(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected NotionPropertyMapping
+		wantErr  bool
+	}{
+		{
+			name:     "empty uses defaults",
+			value:    "",
+			expected: NotionPropertyMapping{},
+		},
+		{
+			name:  "japanese property names",
+			value: `{"input":{"name":"品名","tag":"分類"},"summary":{"amount":"金額"}}`,
+			expected: NotionPropertyMapping{
+				Input:   NotionInputProperties{Name: "品名", Tag: "分類"},
+				Summary: NotionSummaryProperties{Amount: "金額"},
+			},
+		},
+		{
+			name:     "user property names",
+			value:    `{"users":{"name":"表示名","userId":"LINE ID"}}`,
+			expected: NotionPropertyMapping{Users: NotionUserProperties{Name: "表示名", UserID: "LINE ID"}},
+		},
+		{
+			name:    "duplicate user property name",
+			value:   `{"users":{"pictureUrl":"name"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			value:   `{"input":{"title":"品名"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name in a database",
+			value:   `{"input":{"name":"分類","tag":"分類"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate with default name",
+			value:   `{"summary":{"amount":"date"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			value:   `{"input":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mapping, err := parseNotionPropertyMapping(tc.value)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, mapping)
+		})
+	}
 }
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// StreamKaimemoEvents implements KaimemoHandler.
+//
+// WebSocketを使えない環境向けに、/kaimemo/wsと同じ変更通知をServer-Sent Eventsで配信する。
+// 変更はRESTで行う。EventSourceの再接続時に送られるLast-Event-IDから、取りこぼした分を送り直す
+//
+// WebSocketと同じく、セッションクッキーまたはticketで認証し、クエリのtempUserIDの一覧の変更を配信する
+func (k *kaimemoHandler) StreamKaimemoEvents(c echo.Context) error {
+	tempUserID, viewer, err := k.kaimemoViewer(c)
+	if err != nil {
+		return authenticationError(c, err)
+	}
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("since")
+	}
+	since, resume, err := k.parseSince(lastEventID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Last-Event-ID must be an id of a received event",
+		})
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// プロキシにバッファリングさせない
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	// レスポンスへの書き込みはhubが行う。失敗もイベントで通知する
+	conn := newSSEConn(res)
+	client, err := k.joinKaimemoRoom(tempUserID, conn, viewer, since, resume)
+	if err == nil {
+		select {
+		case <-c.Request().Context().Done():
+		case <-client.Done():
+		}
+	}
+	k.hub.Unregister(client)
+	// ハンドラを抜けた後にレスポンスへ書き込まれないよう、hubが接続を閉じるまで待つ
+	<-conn.closed
+	return nil
+}
+
+// sseConn は、hubからの書き込みをServer-Sent Eventsとして送るhub.Conn
+type sseConn struct {
+	res       *echo.Response
+	rc        *http.ResponseController
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSSEConn(res *echo.Response) *sseConn {
+	return &sseConn{
+		res:    res,
+		rc:     http.NewResponseController(res),
+		closed: make(chan struct{}),
+	}
+}
+
+// WriteMessage は、メッセージのtypeをevent、再接続用の位置（cursor）をidとして送る
+func (s *sseConn) WriteMessage(_ int, data []byte) error {
+	var msg struct {
+		Type   string `json:"type"`
+		Cursor string `json:"cursor"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	if msg.Cursor != "" {
+		if _, err := fmt.Fprintf(s.res, "id: %s\n", msg.Cursor); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.res, "event: %s\ndata: %s\n\n", msg.Type, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// WriteControl は、pingをコメント行として送る。コメントはEventSourceには通知されない
+func (s *sseConn) WriteControl(messageType int, _ []byte, deadline time.Time) error {
+	if messageType != websocket.PingMessage {
+		return nil
+	}
+	if err := s.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(s.res, ": ping\n\n"); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseConn) SetWriteDeadline(t time.Time) error {
+	if err := s.rc.SetWriteDeadline(t); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// SetReadDeadline は、何もしない。Server-Sent Eventsではクライアントから受け取らない
+func (s *sseConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+// SetPongHandler は、何もしない。切断はリクエストのコンテキストと書き込みの失敗で検出する
+func (s *sseConn) SetPongHandler(func(string) error) {}
+
+func (s *sseConn) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
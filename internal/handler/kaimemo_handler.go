@@ -2,107 +2,35 @@
 package handler
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"template-echo-notion-integration/internal/hub"
 	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
 	"template-echo-notion-integration/internal/service"
+	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
 type kaimemoHandler struct {
-	service service.KaimemoService
+	service       service.KaimemoService
+	hub           *hub.Hub
+	authenticator service.Authenticator
+	upgrader      websocket.Upgrader
+	// adminUserIDs は、サーバー全体の接続状況を参照できる利用者
+	adminUserIDs map[string]bool
 }
 
-var clients = make(map[*websocket.Conn]bool)
-
-// FYI. GoでWebSocketを使いチャットサーバー構築 | https://qiita.com/TetsuyaFukunaga/items/4c83a8dedd34e65ffbdc
-// WebsocketTelegraph implements KaimemoHandler.
-func (k *kaimemoHandler) WebsocketTelegraph(c echo.Context) error {
-	tempUserID := c.QueryParam("tempUserID")
-	if tempUserID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "tempUserID is required",
-		})
-	}
-
-	var upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
-	}
-
-	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
-	if err != nil {
-		return err
-	}
-	clients[conn] = true
-	spew.Dump(clients)
-	defer conn.Close()
-
-	// ここで買い物一覧送信
-	res, err := k.service.FetchKaimemo(tempUserID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to fetch kaimemo",
-		})
-	}
-	resJSON, _ := json.Marshal(res)
-	conn.WriteMessage(websocket.TextMessage, resJSON)
-
-	for {
-		_, msg, err := conn.ReadMessage()
-		if err != nil {
-			log.Println("読み取りエラー:", err)
-			break
-		}
-
-		// TODO : 処理区分を渡して、それに応じて登録・削除を分ける必要がある
-		var request model.TelegraphRequest
-		if err := json.Unmarshal(msg, &request); err != nil {
-			log.Println("JSONデコードエラー:", err)
-			continue
-		}
-		spew.Dump(request)
-
-		if request.MethodType == "1" {
-			if err := k.service.CreateKaimemo(model.CreateKaimemoRequest{
-				TempUserID: tempUserID,
-				Tag:        *request.Tag,
-				Name:       *request.Name,
-			}); err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{
-					"error": "Failed to create kaimemo",
-				})
-			}
-		} else if request.MethodType == "2" {
-			if err := k.service.RemoveKaimemo(*request.ID, tempUserID); err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{
-					"error": "Failed to remove kaimemo",
-				})
-			}
-		}
-
-		res, err := k.service.FetchKaimemo(tempUserID)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "Failed to fetch kaimemo",
-			})
-		}
-		resJSON, _ := json.Marshal(res)
-
-		// 全クライアントにメッセージをブロードキャスト
-		for client := range clients {
-			if err := client.WriteMessage(websocket.TextMessage, resJSON); err != nil {
-				log.Printf("ブロードキャストエラー: %v", err)
-				delete(clients, client)
-				client.Close()
-			}
-		}
-	}
-	return nil
-}
+// ページングで1回に返す件数
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
 
 // CreateKaimemoAmount implements KaimemoHandler.
 func (k *kaimemoHandler) CreateKaimemoAmount(c echo.Context) error {
@@ -114,9 +42,7 @@ func (k *kaimemoHandler) CreateKaimemoAmount(c echo.Context) error {
 	}
 
 	if err := k.service.CreateKaimemoAmount(req); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to create kaimemo amount",
-		})
+		return errorResponse(c, err, "Failed to create kaimemo amount")
 	}
 
 	return c.NoContent(http.StatusCreated)
@@ -141,6 +67,45 @@ func (k *kaimemoHandler) FetchKaimemoSummaryRecord(c echo.Context) error {
 	return c.JSON(http.StatusOK, res)
 }
 
+// UpdateKaimemoAmount implements KaimemoHandler.
+func (k *kaimemoHandler) UpdateKaimemoAmount(c echo.Context) error {
+	req := model.UpdateKaimemoAmountRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "ID is required",
+		})
+	}
+	if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "date must be in YYYY-MM-DD format",
+		})
+	}
+	if req.Tag == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "tag is required",
+		})
+	}
+	if req.Amount < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "amount must not be negative",
+		})
+	}
+
+	res, err := k.service.UpdateKaimemoAmount(id, req)
+	if err != nil {
+		return errorResponse(c, err, "Failed to update kaimemo amount")
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
 // RemoveKaimemoAmount implements KaimemoHandler.
 func (k *kaimemoHandler) RemoveKaimemoAmount(c echo.Context) error {
 	req := model.RemoveKaimemoAmountRequest{}
@@ -158,9 +123,7 @@ func (k *kaimemoHandler) RemoveKaimemoAmount(c echo.Context) error {
 	}
 
 	if err := k.service.RemoveKaimemoAmount(id, req.TempUserID); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to remove kaimemo",
-		})
+		return errorResponse(c, err, "Failed to remove kaimemo")
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -175,13 +138,13 @@ func (k *kaimemoHandler) CreateKaimemo(c echo.Context) error {
 		})
 	}
 
-	if err := k.service.CreateKaimemo(req); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to create kaimemo",
-		})
+	res, err := k.service.CreateKaimemo(req)
+	if err != nil {
+		return errorResponse(c, err, "Failed to create kaimemo")
 	}
+	k.publishKaimemo(req.TempUserID, kaimemoEvent{eventType: model.TelegraphTypeAdded, payload: res})
 
-	return c.NoContent(http.StatusCreated)
+	return c.JSON(http.StatusCreated, res)
 }
 
 // FetchKaimemo implements KaimemoHandler.
@@ -203,6 +166,71 @@ func (k *kaimemoHandler) FetchKaimemo(c echo.Context) error {
 	return c.JSON(http.StatusOK, res)
 }
 
+// FetchKaimemoPage implements KaimemoHandler.
+func (k *kaimemoHandler) FetchKaimemoPage(c echo.Context) error {
+	tempUserID := c.QueryParam("tempUserID")
+	if tempUserID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "TempUserID is required",
+		})
+	}
+
+	limit := defaultPageLimit
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("limit must be between 1 and %d", maxPageLimit),
+			})
+		}
+		limit = n
+	}
+
+	res, err := k.service.FetchKaimemoPage(tempUserID, c.QueryParam("cursor"), limit)
+	if err != nil {
+		return errorResponse(c, err, "Failed to fetch kaimemo")
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// UpdateKaimemo implements KaimemoHandler.
+func (k *kaimemoHandler) UpdateKaimemo(c echo.Context) error {
+	req := model.UpdateKaimemoRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "ID is required",
+		})
+	}
+	if req.Name == nil && req.Tag == nil && req.Done == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "name, tag or done is required",
+		})
+	}
+	if req.Name != nil && *req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "name must not be empty",
+		})
+	}
+
+	req.IfMatch = ifMatch(c)
+	res, err := k.service.UpdateKaimemo(id, req)
+	if err != nil {
+		return errorResponse(c, err, "Failed to update kaimemo")
+	}
+	k.publishKaimemo(req.TempUserID, kaimemoEvent{eventType: model.TelegraphTypeUpdated, payload: res})
+
+	c.Response().Header().Set("ETag", etag(res.Version))
+	return c.JSON(http.StatusOK, res)
+}
+
 // RemoveKaimemo implements KaimemoHandler.
 func (k *kaimemoHandler) RemoveKaimemo(c echo.Context) error {
 	req := model.RemoveKaimemoRequest{}
@@ -219,25 +247,92 @@ func (k *kaimemoHandler) RemoveKaimemo(c echo.Context) error {
 		})
 	}
 
-	if err := k.service.RemoveKaimemo(id, req.TempUserID); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to remove kaimemo",
-		})
+	if err := k.service.RemoveKaimemo(id, req.TempUserID, ifMatch(c)); err != nil {
+		return errorResponse(c, err, "Failed to remove kaimemo")
 	}
+	k.publishKaimemo(req.TempUserID, kaimemoEvent{eventType: model.TelegraphTypeRemoved, payload: model.TelegraphRemovePayload{ID: id}})
 
 	return c.NoContent(http.StatusOK)
 }
 
+// etag は、買い物のバージョンをETagの形式にする
+func etag(version string) string {
+	return `"` + version + `"`
+}
+
+// ifMatch は、If-Matchヘッダーのバージョンを返す。指定がないか*の場合は空
+func ifMatch(c echo.Context) string {
+	v := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if v == "*" {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(v, "W/"), `"`)
+}
+
+// errorResponse は、リポジトリのエラーをHTTPステータスに変換して返す。
+// 該当しないエラーはmessageとともに500を返す。競合の場合は現在の状態も返す
+func errorResponse(c echo.Context, err error, message string) error {
+	var conflict *repository.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.Response().Header().Set("ETag", etag(conflict.Current.Version))
+		return c.JSON(http.StatusConflict, map[string]any{
+			"error":   "Conflict",
+			"current": conflict.Current,
+		})
+	case errors.Is(err, repository.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Not found",
+		})
+	case errors.Is(err, repository.ErrForbidden):
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Forbidden",
+		})
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid cursor",
+		})
+	case errors.Is(err, repository.ErrInvalidUserKey):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "tempUserID must not contain commas",
+		})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": message,
+		})
+	}
+}
+
 type KaimemoHandler interface {
 	WebsocketTelegraph(c echo.Context) error
+	FetchWebsocketStats(c echo.Context) error
+	StreamKaimemoEvents(c echo.Context) error
+	FetchKaimemoPresence(c echo.Context) error
 	FetchKaimemo(c echo.Context) error
+	FetchKaimemoPage(c echo.Context) error
 	CreateKaimemo(c echo.Context) error
+	UpdateKaimemo(c echo.Context) error
 	RemoveKaimemo(c echo.Context) error
 	FetchKaimemoSummaryRecord(c echo.Context) error
 	CreateKaimemoAmount(c echo.Context) error
+	UpdateKaimemoAmount(c echo.Context) error
 	RemoveKaimemoAmount(c echo.Context) error
 }
 
-func NewKaimemoHandler(service service.KaimemoService) KaimemoHandler {
-	return &kaimemoHandler{service: service}
+// NewKaimemoHandler は、WebSocket・Server-Sent Eventsの接続と在室状況をauthenticatorで認証する。
+// WebSocketはallowOriginsのオリジンからの接続のみ受け付ける。接続状況の統計はadminUserIDsの利用者だけが参照できる
+func NewKaimemoHandler(service service.KaimemoService, hub *hub.Hub, authenticator service.Authenticator, allowOrigins []string, adminUserIDs []string) KaimemoHandler {
+	admins := make(map[string]bool, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		admins[id] = true
+	}
+	return &kaimemoHandler{
+		service:       service,
+		hub:           hub,
+		authenticator: authenticator,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkOrigin(allowOrigins),
+		},
+		adminUserIDs: admins,
+	}
 }
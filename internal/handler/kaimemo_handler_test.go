@@ -1,14 +1,31 @@
 package handler
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"template-echo-notion-integration/internal/hub"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	"template-echo-notion-integration/internal/service"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func registerTestRoutes(e *echo.Echo) {
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/", ok)
+	e.GET("/health", ok)
+}
+
 func TestEchoRouterSetup(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -19,6 +36,7 @@ func TestEchoRouterSetup(t *testing.T) {
 			name: "router with basic middleware",
 			setupRouter: func() *echo.Echo {
 				e := echo.New()
+				registerTestRoutes(e)
 				return e
 			},
 			expectedRoutes: []string{"/", "/health"},
@@ -28,8 +46,13 @@ func TestEchoRouterSetup(t *testing.T) {
 			setupRouter: func() *echo.Echo {
 				e := echo.New()
 				e.HTTPErrorHandler = func(err error, c echo.Context) {
-					c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+					code := http.StatusInternalServerError
+					if he, ok := err.(*echo.HTTPError); ok {
+						code = he.Code
+					}
+					c.JSON(code, map[string]string{"error": err.Error()})
 				}
+				registerTestRoutes(e)
 				return e
 			},
 			expectedRoutes: []string{"/", "/health"},
@@ -39,6 +62,7 @@ func TestEchoRouterSetup(t *testing.T) {
 			setupRouter: func() *echo.Echo {
 				e := echo.New()
 				e.Binder = &echo.DefaultBinder{}
+				registerTestRoutes(e)
 				return e
 			},
 			expectedRoutes: []string{"/", "/health"},
@@ -66,3 +90,968 @@ func TestEchoRouterSetup(t *testing.T) {
 		})
 	}
 }
+
+func newTestKaimemoHandler(t *testing.T, opts ...hub.Option) KaimemoHandler {
+	t.Helper()
+
+	return newTestKaimemoHandlerWithService(t, service.NewKaimemoService(repository.NewMemoryRepository()), opts...)
+}
+
+// newTestKaimemoHandlerWithService は、kaimemoServiceのデータを扱うハンドラを、新しいhubで生成する。
+// 接続するたびに入室が通知されないよう、入退室の通知はhub.WithPresenceを渡した場合だけ送る
+func newTestKaimemoHandlerWithService(t *testing.T, kaimemoService service.KaimemoService, opts ...hub.Option) KaimemoHandler {
+	t.Helper()
+
+	h := hub.New(opts...)
+	go h.Run()
+	t.Cleanup(h.Stop)
+	return NewKaimemoHandler(
+		kaimemoService,
+		h,
+		service.NewAuthenticator(testSessionManager, testTicketManager, testUserRepository),
+		[]string{testAllowOrigin},
+		[]string{testAdminUserID},
+	)
+}
+
+// WebSocket・Server-Sent Eventsの接続の認証に使う
+var (
+	testSessionManager = service.NewSessionManager(repository.NewMemorySessionStore(), time.Hour)
+	testTicketManager  = service.NewTicketManager([]byte("test-secret"), time.Minute)
+	testUserRepository = repository.NewMemoryUserRepository()
+)
+
+const (
+	testAllowOrigin = "http://localhost:5173"
+	testAdminUserID = "admin"
+)
+
+// kaimemoTicket は、userIDとして接続するためのクエリを返す
+func kaimemoTicket(t *testing.T, userID string) string {
+	t.Helper()
+
+	ticket, _, err := testTicketManager.IssueTicket(userID)
+	require.NoError(t, err)
+	return "ticket=" + ticket
+}
+
+// serve は、echoのコンテキストを組み立ててハンドラを実行する
+func serve(t *testing.T, h echo.HandlerFunc, method, target, body string, params map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	for name, value := range params {
+		c.SetParamNames(name)
+		c.SetParamValues(value)
+	}
+
+	assert.NoError(t, h(c))
+	return rec
+}
+
+func TestKaimemoHandler_KaimemoFlow(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-2","tag":"food","name":"egg"}`, nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(t, handler.FetchKaimemo, http.MethodGet, "/kaimemo?tempUserID=user-1", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var items []model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, "milk", items[0].Name)
+
+	rec = serve(t, handler.RemoveKaimemo, http.MethodDelete, "/kaimemo/"+items[0].ID, `{"tempUserID":"user-1"}`, map[string]string{"id": items[0].ID})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(t, handler.FetchKaimemo, http.MethodGet, "/kaimemo?tempUserID=user-1", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "null\n", rec.Body.String())
+
+	rec = serve(t, handler.FetchKaimemo, http.MethodGet, "/kaimemo", "", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestKaimemoHandler_KaimemoAmountFlow(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+
+	rec := serve(t, handler.CreateKaimemoAmount, http.MethodPost, "/kaimemo/summary", `{"tempUserID":"user-1","date":"2023-05-15","tag":"food","amount":1000}`, nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(t, handler.CreateKaimemoAmount, http.MethodPost, "/kaimemo/summary", `{"tempUserID":"user-1","date":"2023-06-01","tag":"food","amount":2000}`, nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(t, handler.FetchKaimemoSummaryRecord, http.MethodGet, "/kaimemo/summary?tempUserID=user-1", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var summary model.KaimemoSummaryResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	require.Len(t, summary.MonthlySummaries, 2)
+	assert.Equal(t, 1000, summary.MonthlySummaries[0].TotalAmount)
+
+	id := summary.WeeklySummaries[0].Items[0].ID
+	rec = serve(t, handler.RemoveKaimemoAmount, http.MethodDelete, "/kaimemo/summary/"+id, `{"tempUserID":"user-1"}`, map[string]string{"id": id})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(t, handler.FetchKaimemoSummaryRecord, http.MethodGet, "/kaimemo/summary?tempUserID=user-1", "", nil)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	require.Len(t, summary.MonthlySummaries, 1)
+	assert.Equal(t, "2023-06", summary.MonthlySummaries[0].Month)
+}
+
+func TestKaimemoHandler_FetchKaimemoPage(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	for _, name := range []string{"milk", "egg", "bread"} {
+		rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"`+name+`"}`, nil)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec := serve(t, handler.FetchKaimemoPage, http.MethodGet, "/kaimemo/page?tempUserID=user-1&limit=2", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var page model.KaimemoPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 2)
+	assert.True(t, page.HasMore)
+
+	rec = serve(t, handler.FetchKaimemoPage, http.MethodGet, "/kaimemo/page?tempUserID=user-1&limit=2&cursor="+page.NextCursor, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "bread", page.Items[0].Name)
+	assert.False(t, page.HasMore)
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "missing tempUserID", target: "/kaimemo/page"},
+		{name: "limit too large", target: "/kaimemo/page?tempUserID=user-1&limit=101"},
+		{name: "limit not a number", target: "/kaimemo/page?tempUserID=user-1&limit=abc"},
+		{name: "invalid cursor", target: "/kaimemo/page?tempUserID=user-1&cursor=%21%21"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, handler.FetchKaimemoPage, http.MethodGet, tt.target, "", nil)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
+
+func TestKaimemoHandler_RemoveOwnership(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(t, handler.CreateKaimemoAmount, http.MethodPost, "/kaimemo/summary", `{"tempUserID":"user-1","date":"2023-05-15","tag":"food","amount":1000}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// メモリ実装のIDは登録順の連番
+	tests := []struct {
+		name           string
+		handler        echo.HandlerFunc
+		id             string
+		tempUserID     string
+		expectedStatus int
+	}{
+		{name: "kaimemo of another user", handler: handler.RemoveKaimemo, id: "memory-1", tempUserID: "user-2", expectedStatus: http.StatusForbidden},
+		{name: "unknown kaimemo", handler: handler.RemoveKaimemo, id: "unknown", tempUserID: "user-1", expectedStatus: http.StatusNotFound},
+		{name: "own kaimemo", handler: handler.RemoveKaimemo, id: "memory-1", tempUserID: "user-1", expectedStatus: http.StatusOK},
+		{name: "already removed kaimemo", handler: handler.RemoveKaimemo, id: "memory-1", tempUserID: "user-1", expectedStatus: http.StatusNotFound},
+		{name: "amount of another user", handler: handler.RemoveKaimemoAmount, id: "memory-2", tempUserID: "user-2", expectedStatus: http.StatusForbidden},
+		{name: "own amount", handler: handler.RemoveKaimemoAmount, id: "memory-2", tempUserID: "user-1", expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, tt.handler, http.MethodDelete, "/kaimemo/"+tt.id, `{"tempUserID":"`+tt.tempUserID+`"}`, map[string]string{"id": tt.id})
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestKaimemoHandler_UpdateKaimemo(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		expectedStatus int
+		expected       *model.KaimemoResponse
+	}{
+		{name: "toggle done", id: "memory-1", body: `{"tempUserID":"user-1","done":true}`, expectedStatus: http.StatusOK, expected: &model.KaimemoResponse{ID: "memory-1", Tag: "food", Name: "milk", Done: true, Version: "2"}},
+		{name: "rename and retag", id: "memory-1", body: `{"tempUserID":"user-1","name":"egg","tag":"protein"}`, expectedStatus: http.StatusOK, expected: &model.KaimemoResponse{ID: "memory-1", Tag: "protein", Name: "egg", Done: true, Version: "3"}},
+		{name: "no fields", id: "memory-1", body: `{"tempUserID":"user-1"}`, expectedStatus: http.StatusBadRequest},
+		{name: "empty name", id: "memory-1", body: `{"tempUserID":"user-1","name":""}`, expectedStatus: http.StatusBadRequest},
+		{name: "another user", id: "memory-1", body: `{"tempUserID":"user-2","done":false}`, expectedStatus: http.StatusForbidden},
+		{name: "unknown id", id: "unknown", body: `{"tempUserID":"user-1","done":false}`, expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, handler.UpdateKaimemo, http.MethodPatch, "/kaimemo/"+tt.id, tt.body, map[string]string{"id": tt.id})
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expected != nil {
+				var res model.KaimemoResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Equal(t, *tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestKaimemoHandler_UpdateKaimemoAmount(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	rec := serve(t, handler.CreateKaimemoAmount, http.MethodPost, "/kaimemo/summary", `{"tempUserID":"user-1","date":"2023-05-15","tag":"food","amount":1000}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(t, handler.CreateKaimemoAmount, http.MethodPost, "/kaimemo/summary", `{"tempUserID":"user-1","date":"2023-05-16","tag":"food","amount":500}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		expectedStatus int
+	}{
+		{name: "invalid date", id: "memory-1", body: `{"tempUserID":"user-1","date":"2023/05/15","tag":"food","amount":100}`, expectedStatus: http.StatusBadRequest},
+		{name: "missing tag", id: "memory-1", body: `{"tempUserID":"user-1","date":"2023-05-15","amount":100}`, expectedStatus: http.StatusBadRequest},
+		{name: "negative amount", id: "memory-1", body: `{"tempUserID":"user-1","date":"2023-05-15","tag":"food","amount":-1}`, expectedStatus: http.StatusBadRequest},
+		{name: "another user", id: "memory-1", body: `{"tempUserID":"user-2","date":"2023-05-15","tag":"food","amount":100}`, expectedStatus: http.StatusForbidden},
+		{name: "unknown id", id: "unknown", body: `{"tempUserID":"user-1","date":"2023-05-15","tag":"food","amount":100}`, expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, handler.UpdateKaimemoAmount, http.MethodPut, "/kaimemo/summary/"+tt.id, tt.body, map[string]string{"id": tt.id})
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+
+	// 金額と日付を直すと、集計し直した結果が返る
+	rec = serve(t, handler.UpdateKaimemoAmount, http.MethodPut, "/kaimemo/summary/memory-1", `{"tempUserID":"user-1","date":"2023-06-01","tag":"daily","amount":100}`, map[string]string{"id": "memory-1"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var summary model.KaimemoSummaryResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Equal(t, []model.MonthlySummary{
+		{Month: "2023-05", TotalAmount: 500, TagSummary: map[string]int{"food": 500}},
+		{Month: "2023-06", TotalAmount: 100, TagSummary: map[string]int{"daily": 100}},
+	}, summary.MonthlySummaries)
+}
+
+// newTestWebsocketServer は、WebsocketTelegraphを提供するテストサーバーを起動する
+func newTestWebsocketServer(t *testing.T, handler KaimemoHandler) string {
+	t.Helper()
+
+	e := echo.New()
+	e.GET("/kaimemo/ws", handler.WebsocketTelegraph)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/kaimemo/ws"
+}
+
+// dialKaimemo は、tempUserIDの部屋に接続し、初回に送られる買い物一覧を返す
+func dialKaimemo(t *testing.T, url, tempUserID string) (*websocket.Conn, []model.KaimemoResponse) {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, tempUserID), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, readKaimemoList(t, conn)
+}
+
+func readTelegraph(t *testing.T, conn *websocket.Conn) model.TelegraphMessage {
+	t.Helper()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var msg model.TelegraphMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, model.TelegraphVersion, msg.Version)
+	return msg
+}
+
+func readKaimemoList(t *testing.T, conn *websocket.Conn) []model.KaimemoResponse {
+	t.Helper()
+
+	msg := readTelegraph(t, conn)
+	require.Equal(t, model.TelegraphTypeList, msg.Type)
+	var items []model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(msg.Payload, &items))
+	return items
+}
+
+// readKaimemoEvent は、eventTypeの変更通知を読み、payloadをvにデコードして連番を返す
+func readKaimemoEvent(t *testing.T, conn *websocket.Conn, eventType string, v any) uint64 {
+	t.Helper()
+
+	msg := readTelegraph(t, conn)
+	require.Equal(t, eventType, msg.Type)
+	assert.Empty(t, msg.RequestID)
+	require.NoError(t, json.Unmarshal(msg.Payload, v))
+	return msg.Seq
+}
+
+func assertNoTelegraph(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, msg, err := conn.ReadMessage()
+	assert.Error(t, err, "unexpected message: %s", msg)
+}
+
+// sendTelegraph は、要求を送り、対応するack/errorを返す。成功した場合は続けて変更通知も届く
+func sendTelegraph(t *testing.T, conn *websocket.Conn, raw string) model.TelegraphMessage {
+	t.Helper()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(raw)))
+	return readTelegraph(t, conn)
+}
+
+func TestKaimemoHandler_WebsocketRooms(t *testing.T) {
+	url := newTestWebsocketServer(t, newTestKaimemoHandler(t))
+
+	household1Phone, _ := dialKaimemo(t, url, "household-1")
+	household1Tablet, _ := dialKaimemo(t, url, "household-1")
+	household2, _ := dialKaimemo(t, url, "household-2")
+
+	ack := sendTelegraph(t, household1Phone, `{"version":1,"type":"kaimemo.create","requestId":"r1","payload":{"name":"milk","tag":"food"}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	for _, conn := range []*websocket.Conn{household1Phone, household1Tablet} {
+		var added model.KaimemoResponse
+		readKaimemoEvent(t, conn, model.TelegraphTypeAdded, &added)
+		assert.Equal(t, "milk", added.Name)
+	}
+
+	ack = sendTelegraph(t, household2, `{"version":1,"type":"kaimemo.create","requestId":"r1","payload":{"name":"egg","tag":"food"}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	var added model.KaimemoResponse
+	readKaimemoEvent(t, household2, model.TelegraphTypeAdded, &added)
+	assert.Equal(t, "egg", added.Name)
+
+	// 他の世帯の更新は届かない
+	for _, conn := range []*websocket.Conn{household1Phone, household1Tablet} {
+		assertNoTelegraph(t, conn)
+	}
+
+	// 後から接続しても、自分の世帯の一覧だけが送られる
+	_, items := dialKaimemo(t, url, "household-2")
+	require.Len(t, items, 1)
+	assert.Equal(t, "egg", items[0].Name)
+}
+
+func TestKaimemoHandler_WebsocketProtocol(t *testing.T) {
+	url := newTestWebsocketServer(t, newTestKaimemoHandler(t))
+	conn, items := dialKaimemo(t, url, "user-1")
+	assert.Empty(t, items)
+	other, _ := dialKaimemo(t, url, "user-2")
+
+	ack := sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.create","requestId":"create-1","payload":{"name":"milk","tag":"food"}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	assert.Equal(t, "create-1", ack.RequestID)
+	var created, added model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(ack.Payload, &created))
+	readKaimemoEvent(t, conn, model.TelegraphTypeAdded, &added)
+	assert.Equal(t, created, added)
+	assert.Equal(t, "milk", added.Name)
+	id := added.ID
+
+	ack = sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.update","requestId":"update-1","payload":{"id":"`+id+`","done":true}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	assert.Equal(t, "update-1", ack.RequestID)
+	var updated model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(ack.Payload, &updated))
+	assert.True(t, updated.Done)
+	var changed model.KaimemoResponse
+	readKaimemoEvent(t, conn, model.TelegraphTypeUpdated, &changed)
+	assert.Equal(t, updated, changed)
+
+	// 一覧全体はkaimemo.syncを送ったクライアントにだけ返る
+	res := sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.sync","requestId":"sync-1"}`)
+	require.Equal(t, model.TelegraphTypeList, res.Type)
+	assert.Equal(t, "sync-1", res.RequestID)
+	require.NoError(t, json.Unmarshal(res.Payload, &items))
+	assert.Equal(t, []model.KaimemoResponse{updated}, items)
+
+	// 不正なメッセージにはerrorを返し、接続は維持する
+	tests := []struct {
+		name      string
+		conn      *websocket.Conn
+		raw       string
+		requestID string
+		code      string
+	}{
+		{name: "not json", conn: conn, raw: `methodType=1`, code: model.TelegraphErrorInvalidMessage},
+		{name: "legacy message", conn: conn, raw: `{"methodType":"1","name":"milk"}`, code: model.TelegraphErrorUnsupportedVersion},
+		{name: "unknown type", conn: conn, raw: `{"version":1,"type":"kaimemo.rename","requestId":"e1"}`, requestID: "e1", code: model.TelegraphErrorUnknownType},
+		{name: "missing payload", conn: conn, raw: `{"version":1,"type":"kaimemo.create","requestId":"e2"}`, requestID: "e2", code: model.TelegraphErrorInvalidPayload},
+		{name: "missing name", conn: conn, raw: `{"version":1,"type":"kaimemo.create","requestId":"e3","payload":{"tag":"food"}}`, requestID: "e3", code: model.TelegraphErrorInvalidPayload},
+		{name: "missing id", conn: conn, raw: `{"version":1,"type":"kaimemo.remove","requestId":"e4","payload":{}}`, requestID: "e4", code: model.TelegraphErrorInvalidPayload},
+		{name: "wrong payload type", conn: conn, raw: `{"version":1,"type":"kaimemo.update","requestId":"e5","payload":{"id":"` + id + `","done":"yes"}}`, requestID: "e5", code: model.TelegraphErrorInvalidPayload},
+		{name: "nothing to update", conn: conn, raw: `{"version":1,"type":"kaimemo.update","requestId":"e6","payload":{"id":"` + id + `"}}`, requestID: "e6", code: model.TelegraphErrorInvalidPayload},
+		{name: "unknown id", conn: conn, raw: `{"version":1,"type":"kaimemo.remove","requestId":"e7","payload":{"id":"unknown"}}`, requestID: "e7", code: model.TelegraphErrorNotFound},
+		{name: "another user's item", conn: other, raw: `{"version":1,"type":"kaimemo.remove","requestId":"e8","payload":{"id":"` + id + `"}}`, requestID: "e8", code: model.TelegraphErrorForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := sendTelegraph(t, tt.conn, tt.raw)
+			require.Equal(t, model.TelegraphTypeError, res.Type)
+			assert.Equal(t, tt.requestID, res.RequestID)
+			var terr model.TelegraphError
+			require.NoError(t, json.Unmarshal(res.Payload, &terr))
+			assert.Equal(t, tt.code, terr.Code)
+		})
+	}
+
+	ack = sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.remove","requestId":"remove-1","payload":{"id":"`+id+`"}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	var removed model.TelegraphRemovePayload
+	readKaimemoEvent(t, conn, model.TelegraphTypeRemoved, &removed)
+	assert.Equal(t, id, removed.ID)
+
+	// 失敗した要求や他の部屋の変更は通知されない
+	assertNoTelegraph(t, conn)
+}
+
+func TestKaimemoHandler_RESTPublishesEvents(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	url := newTestWebsocketServer(t, handler)
+	conn, _ := dialKaimemo(t, url, "user-1")
+	other, _ := dialKaimemo(t, url, "user-2")
+
+	// セッションのない要求も、書き込んだ一覧の持ち主の部屋に通知される
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created, added model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, uint64(1), readKaimemoEvent(t, conn, model.TelegraphTypeAdded, &added))
+	assert.Equal(t, created, added)
+
+	// 別の利用者として認証した要求でも、配信先は書き込んだ一覧の持ち主
+	rec = serve(t, handler.UpdateKaimemo, http.MethodPatch, "/kaimemo/"+created.ID+"?"+kaimemoTicket(t, "user-2"), `{"tempUserID":"user-1","done":true}`, map[string]string{"id": created.ID})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var updated model.KaimemoResponse
+	readKaimemoEvent(t, conn, model.TelegraphTypeUpdated, &updated)
+	assert.True(t, updated.Done)
+
+	// 失敗した変更は通知されない
+	rec = serve(t, handler.RemoveKaimemo, http.MethodDelete, "/kaimemo/"+created.ID+"?"+kaimemoTicket(t, "user-2"), `{"tempUserID":"user-2"}`, map[string]string{"id": created.ID})
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(t, handler.RemoveKaimemo, http.MethodDelete, "/kaimemo/"+created.ID, `{"tempUserID":"user-1"}`, map[string]string{"id": created.ID})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var removed model.TelegraphRemovePayload
+	readKaimemoEvent(t, conn, model.TelegraphTypeRemoved, &removed)
+	assert.Equal(t, created.ID, removed.ID)
+
+	assertNoTelegraph(t, other)
+}
+
+func TestKaimemoHandler_WebsocketReplay(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	url := newTestWebsocketServer(t, handler)
+
+	phone, _ := dialKaimemo(t, url, "user-1")
+	tablet, _ := dialKaimemo(t, url, "user-1")
+	sendTelegraph(t, phone, `{"version":1,"type":"kaimemo.create","requestId":"r1","payload":{"name":"milk","tag":"food"}}`)
+	var added model.KaimemoResponse
+	assert.Equal(t, uint64(1), readKaimemoEvent(t, phone, model.TelegraphTypeAdded, &added))
+	assert.Equal(t, uint64(1), readKaimemoEvent(t, tablet, model.TelegraphTypeAdded, &added))
+
+	// 電波が切れている間の変更
+	require.NoError(t, phone.Close())
+	sendTelegraph(t, tablet, `{"version":1,"type":"kaimemo.update","requestId":"r2","payload":{"id":"`+added.ID+`","done":true}}`)
+	readKaimemoEvent(t, tablet, model.TelegraphTypeUpdated, &model.KaimemoResponse{})
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo?"+kaimemoTicket(t, "user-1"), `{"tempUserID":"user-1","tag":"food","name":"egg"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	readKaimemoEvent(t, tablet, model.TelegraphTypeAdded, &model.KaimemoResponse{})
+
+	t.Run("replay missed events", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "user-1")+"&since="+testCursor(handler, 1), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var updated, egg model.KaimemoResponse
+		assert.Equal(t, uint64(2), readKaimemoEvent(t, conn, model.TelegraphTypeUpdated, &updated))
+		assert.True(t, updated.Done)
+		assert.Equal(t, uint64(3), readKaimemoEvent(t, conn, model.TelegraphTypeAdded, &egg))
+		assert.Equal(t, "egg", egg.Name)
+		assertNoTelegraph(t, conn)
+	})
+
+	t.Run("seq unknown to the server", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "user-1")+"&since="+testCursor(handler, 99), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		msg := readTelegraph(t, conn)
+		require.Equal(t, model.TelegraphTypeList, msg.Type)
+		assert.Equal(t, uint64(3), msg.Seq)
+		assert.Equal(t, testCursor(handler, 3), msg.Cursor)
+		var items []model.KaimemoResponse
+		require.NoError(t, json.Unmarshal(msg.Payload, &items))
+		assert.Len(t, items, 2)
+	})
+
+	t.Run("invalid since", func(t *testing.T) {
+		_, res, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "user-1")+"&since=-1", nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+// 再起動で連番が振り直しになっても、再起動前の位置からは取りこぼしを埋めずに一覧全体を送り直す
+func TestKaimemoHandler_WebsocketResumeAfterRestart(t *testing.T) {
+	kaimemoService := service.NewKaimemoService(repository.NewMemoryRepository())
+	before := newTestKaimemoHandlerWithService(t, kaimemoService)
+	conn, _ := dialKaimemo(t, newTestWebsocketServer(t, before), "user-1")
+	sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.create","requestId":"r1","payload":{"name":"milk","tag":"food"}}`)
+	msg := readTelegraph(t, conn)
+	require.Equal(t, model.TelegraphTypeAdded, msg.Type)
+	stale := msg.Cursor
+	require.NoError(t, conn.Close())
+
+	// 再起動後、再接続までの間に連番が再起動前の位置を追い越す
+	handler := newTestKaimemoHandlerWithService(t, kaimemoService)
+	url := newTestWebsocketServer(t, handler)
+	for _, name := range []string{"egg", "bread"} {
+		rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo?"+kaimemoTicket(t, "user-1"), `{"tempUserID":"user-1","tag":"food","name":"`+name+`"}`, nil)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "user-1")+"&since="+stale, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	msg = readTelegraph(t, conn)
+	require.Equal(t, model.TelegraphTypeList, msg.Type)
+	assert.Equal(t, testCursor(handler, 2), msg.Cursor)
+	var items []model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(msg.Payload, &items))
+	assert.Len(t, items, 3)
+	assertNoTelegraph(t, conn)
+
+	// epochのない古い形式の連番も同じく扱う
+	legacy, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "user-1")+"&since=1", nil)
+	require.NoError(t, err)
+	defer legacy.Close()
+	assert.Len(t, readKaimemoList(t, legacy), 3)
+}
+
+// testCursor は、handlerのhubでの連番seqの位置を返す
+func testCursor(handler KaimemoHandler, seq uint64) string {
+	return handler.(*kaimemoHandler).hub.Cursor(seq)
+}
+
+func TestKaimemoHandler_WebsocketKeepalive(t *testing.T) {
+	handler := newTestKaimemoHandler(t, hub.WithKeepalive(20*time.Millisecond, 200*time.Millisecond))
+	url := newTestWebsocketServer(t, handler)
+	stats := func() hub.Stats {
+		rec := serve(t, handler.FetchWebsocketStats, http.MethodGet, "/kaimemo/ws/stats?"+kaimemoTicket(t, testAdminUserID), "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var res hub.Stats
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return res
+	}
+
+	// 読み取りを続けるクライアントはpingにpongを返すため、接続が維持される
+	alive, _ := dialKaimemo(t, url, "user-1")
+	aliveDone := make(chan struct{})
+	go func() {
+		defer close(aliveDone)
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	// 読み取りをやめたクライアント（電波の届かない端末）はpongを返さない
+	dialKaimemo(t, url, "user-2")
+	assert.Equal(t, hub.Stats{Rooms: 2, Clients: 2}, stats())
+
+	assert.Eventually(t, func() bool {
+		return stats() == hub.Stats{Rooms: 1, Clients: 1}
+	}, 2*time.Second, 20*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, hub.Stats{Rooms: 1, Clients: 1}, stats())
+
+	alive.Close()
+	<-aliveDone
+}
+
+// sseEvent は、Server-Sent Eventsの1件
+type sseEvent struct {
+	id    string
+	event string
+	msg   model.TelegraphMessage
+}
+
+// openKaimemoEvents は、/kaimemo/eventsに接続し、届いたイベントを順に返すチャネルを返す。
+// cancelで接続を切る
+func openKaimemoEvents(t *testing.T, handler KaimemoHandler, query string, header http.Header) (<-chan sseEvent, context.CancelFunc) {
+	t.Helper()
+
+	e := echo.New()
+	e.GET("/kaimemo/events", handler.StreamKaimemoEvents)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/kaimemo/events?"+query, nil)
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		defer res.Body.Close()
+		scanner := bufio.NewScanner(res.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if ev.event != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.msg); err != nil {
+					t.Errorf("invalid data: %v", err)
+				}
+			}
+		}
+	}()
+	return events, cancel
+}
+
+func nextSSEEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+
+	select {
+	case ev, ok := <-events:
+		require.True(t, ok, "stream closed")
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return sseEvent{}
+	}
+}
+
+func TestKaimemoHandler_StreamKaimemoEvents(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	wsURL := newTestWebsocketServer(t, handler)
+
+	events, cancel := openKaimemoEvents(t, handler, kaimemoTicket(t, "user-1"), nil)
+	ev := nextSSEEvent(t, events)
+	assert.Equal(t, model.TelegraphTypeList, ev.event)
+	assert.Equal(t, testCursor(handler, 0), ev.id)
+
+	// RESTでの変更も、WebSocketでの変更も同じイベントとして届く
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo?"+kaimemoTicket(t, "user-1"), `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	ev = nextSSEEvent(t, events)
+	assert.Equal(t, model.TelegraphTypeAdded, ev.event)
+	assert.Equal(t, testCursor(handler, 1), ev.id)
+	var added model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(ev.msg.Payload, &added))
+	assert.Equal(t, "milk", added.Name)
+
+	conn, _ := dialKaimemo(t, wsURL, "user-1")
+	sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.update","requestId":"r1","payload":{"id":"`+added.ID+`","done":true}}`)
+	ev = nextSSEEvent(t, events)
+	assert.Equal(t, model.TelegraphTypeUpdated, ev.event)
+	assert.Equal(t, testCursor(handler, 2), ev.id)
+
+	// 切断すると部屋から外れる
+	cancel()
+	assert.Eventually(t, func() bool {
+		rec := serve(t, handler.FetchWebsocketStats, http.MethodGet, "/kaimemo/ws/stats?"+kaimemoTicket(t, testAdminUserID), "", nil)
+		return strings.Contains(rec.Body.String(), `"clients":1`)
+	}, 2*time.Second, 20*time.Millisecond)
+
+	t.Run("resume from Last-Event-ID", func(t *testing.T) {
+		events, _ := openKaimemoEvents(t, handler, kaimemoTicket(t, "user-1"), http.Header{"Last-Event-Id": {testCursor(handler, 1)}})
+		ev := nextSSEEvent(t, events)
+		assert.Equal(t, model.TelegraphTypeUpdated, ev.event)
+		assert.Equal(t, testCursor(handler, 2), ev.id)
+	})
+
+	t.Run("other rooms are not streamed", func(t *testing.T) {
+		events, _ := openKaimemoEvents(t, handler, kaimemoTicket(t, "user-2"), nil)
+		ev := nextSSEEvent(t, events)
+		require.Equal(t, model.TelegraphTypeList, ev.event)
+		assert.JSONEq(t, `[]`, string(ev.msg.Payload))
+
+		rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo?"+kaimemoTicket(t, "user-1"), `{"tempUserID":"user-1","tag":"food","name":"egg"}`, nil)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected event: %+v", ev)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		rec := serve(t, handler.StreamKaimemoEvents, http.MethodGet, "/kaimemo/events?tempUserID=user-1", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec = serve(t, handler.StreamKaimemoEvents, http.MethodGet, "/kaimemo/events?"+kaimemoTicket(t, "user-1")+"&since=abc", "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestKaimemoHandler_Presence(t *testing.T) {
+	handler := newTestKaimemoHandler(t, hub.WithPresence(KaimemoPresenceTelegraph))
+	url := newTestWebsocketServer(t, handler)
+	for _, info := range []repository.UserInfo{{UserID: "mom", DisplayName: "Mom"}, {UserID: "dad", DisplayName: "Dad"}} {
+		_, err := testUserRepository.UpsertUser(info)
+		require.NoError(t, err)
+	}
+	presence := func(userID, tempUserID string) []model.KaimemoViewer {
+		rec := serve(t, handler.FetchKaimemoPresence, http.MethodGet, "/kaimemo/presence?"+kaimemoTicket(t, userID)+"&tempUserID="+tempUserID, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var res model.KaimemoPresenceResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return res.Viewers
+	}
+	readPresence := func(conn *websocket.Conn, messageType string) model.KaimemoViewer {
+		msg := readTelegraph(t, conn)
+		require.Equal(t, messageType, msg.Type)
+		assert.Zero(t, msg.Seq)
+		var viewer model.KaimemoViewer
+		require.NoError(t, json.Unmarshal(msg.Payload, &viewer))
+		return viewer
+	}
+
+	assert.Empty(t, presence("mom", "household-1"))
+
+	// 入室の通知は、一覧より先に本人にも届く。クエリのdeviceIdやnameではなく、認証した利用者のプロフィールを表示する
+	mom, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "mom")+"&tempUserID=household-1&deviceId=dad&name=Dad", nil)
+	require.NoError(t, err)
+	defer mom.Close()
+	assert.Equal(t, model.KaimemoViewer{ID: "mom", Name: "Mom"}, readPresence(mom, model.TelegraphTypePresenceJoined))
+	readKaimemoList(t, mom)
+
+	// Server-Sent Eventsの接続も数える
+	events, cancel := openKaimemoEvents(t, handler, kaimemoTicket(t, "dad")+"&tempUserID=household-1", nil)
+	assert.Equal(t, model.KaimemoViewer{ID: "dad", Name: "Dad"}, readPresence(mom, model.TelegraphTypePresenceJoined))
+	ev := nextSSEEvent(t, events)
+	assert.Equal(t, model.TelegraphTypePresenceJoined, ev.event)
+	assert.Empty(t, ev.id)
+
+	// プロフィールのない利用者はIDだけを表示する。他の一覧を見ている利用者は数えない
+	neighbor, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "neighbor")+"&tempUserID=household-2", nil)
+	require.NoError(t, err)
+	defer neighbor.Close()
+	readPresence(neighbor, model.TelegraphTypePresenceJoined)
+	assert.Equal(t, []model.KaimemoViewer{{ID: "dad", Name: "Dad"}, {ID: "mom", Name: "Mom"}}, presence("mom", "household-1"))
+	assert.Equal(t, []model.KaimemoViewer{{ID: "neighbor"}}, presence("mom", "household-2"))
+
+	cancel()
+	assert.Equal(t, model.KaimemoViewer{ID: "dad", Name: "Dad"}, readPresence(mom, model.TelegraphTypePresenceLeft))
+	assert.Equal(t, []model.KaimemoViewer{{ID: "mom", Name: "Mom"}}, presence("dad", "household-1"))
+
+	// 認証しないと、在室状況は見られない
+	rec := serve(t, handler.FetchKaimemoPresence, http.MethodGet, "/kaimemo/presence?tempUserID=household-1", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	// 一覧を指定しなければ、ログイン中の利用者自身の一覧の在室状況を返す
+	rec = serve(t, handler.FetchKaimemoPresence, http.MethodGet, "/kaimemo/presence?"+kaimemoTicket(t, "household-2"), "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"viewers":[{"id":"neighbor","name":""}]}`, rec.Body.String())
+}
+
+func TestKaimemoHandler_FetchWebsocketStats(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "admin", query: "?" + kaimemoTicket(t, testAdminUserID), expectedStatus: http.StatusOK},
+		{name: "not admin", query: "?" + kaimemoTicket(t, "user-1"), expectedStatus: http.StatusForbidden},
+		{name: "not logged in", expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, handler.FetchWebsocketStats, http.MethodGet, "/kaimemo/ws/stats"+tt.query, "", nil)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+// serveIfMatch は、If-Matchヘッダーを付けてハンドラを実行する
+func serveIfMatch(t *testing.T, h echo.HandlerFunc, method, target, body, ifMatch string, params map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", ifMatch)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	for name, value := range params {
+		c.SetParamNames(name)
+		c.SetParamValues(value)
+	}
+	require.NoError(t, h(c))
+	return rec
+}
+
+func TestKaimemoHandler_IfMatch(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	params := map[string]string{"id": "memory-1"}
+
+	// 家族の1人が先に更新する
+	rec = serveIfMatch(t, handler.UpdateKaimemo, http.MethodPatch, "/kaimemo/memory-1", `{"tempUserID":"user-1","done":true}`, `"1"`, params)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	tests := []struct {
+		name           string
+		handler        echo.HandlerFunc
+		method         string
+		body           string
+		ifMatch        string
+		expectedStatus int
+	}{
+		{name: "stale update", handler: handler.UpdateKaimemo, method: http.MethodPatch, body: `{"tempUserID":"user-1","name":"egg"}`, ifMatch: `"1"`, expectedStatus: http.StatusConflict},
+		{name: "stale weak etag", handler: handler.UpdateKaimemo, method: http.MethodPatch, body: `{"tempUserID":"user-1","name":"egg"}`, ifMatch: `W/"1"`, expectedStatus: http.StatusConflict},
+		{name: "stale remove", handler: handler.RemoveKaimemo, method: http.MethodDelete, body: `{"tempUserID":"user-1"}`, ifMatch: `"1"`, expectedStatus: http.StatusConflict},
+		{name: "wildcard", handler: handler.UpdateKaimemo, method: http.MethodPatch, body: `{"tempUserID":"user-1","tag":"drink"}`, ifMatch: `*`, expectedStatus: http.StatusOK},
+		{name: "current version", handler: handler.RemoveKaimemo, method: http.MethodDelete, body: `{"tempUserID":"user-1"}`, ifMatch: `"3"`, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveIfMatch(t, tt.handler, tt.method, "/kaimemo/memory-1", tt.body, tt.ifMatch, params)
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusConflict {
+				return
+			}
+			// 競合した場合は現在の状態を返す
+			var res struct {
+				Current model.KaimemoResponse `json:"current"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, model.KaimemoResponse{ID: "memory-1", Tag: "food", Name: "milk", Done: true, Version: "2"}, res.Current)
+			assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestKaimemoHandler_WebsocketConflict(t *testing.T) {
+	url := newTestWebsocketServer(t, newTestKaimemoHandler(t))
+	conn, _ := dialKaimemo(t, url, "user-1")
+
+	ack := sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.create","requestId":"r1","payload":{"name":"milk","tag":"food"}}`)
+	var created model.KaimemoResponse
+	require.NoError(t, json.Unmarshal(ack.Payload, &created))
+	readKaimemoEvent(t, conn, model.TelegraphTypeAdded, &model.KaimemoResponse{})
+
+	ack = sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.update","requestId":"r2","payload":{"id":"`+created.ID+`","done":true,"version":"`+created.Version+`"}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	var updated model.KaimemoResponse
+	readKaimemoEvent(t, conn, model.TelegraphTypeUpdated, &updated)
+
+	for _, raw := range []string{
+		`{"version":1,"type":"kaimemo.update","requestId":"r3","payload":{"id":"` + created.ID + `","name":"egg","version":"` + created.Version + `"}}`,
+		`{"version":1,"type":"kaimemo.remove","requestId":"r3","payload":{"id":"` + created.ID + `","version":"` + created.Version + `"}}`,
+	} {
+		res := sendTelegraph(t, conn, raw)
+		require.Equal(t, model.TelegraphTypeError, res.Type)
+		var terr model.TelegraphError
+		require.NoError(t, json.Unmarshal(res.Payload, &terr))
+		assert.Equal(t, model.TelegraphErrorConflict, terr.Code)
+		assert.Equal(t, &updated, terr.Current)
+	}
+
+	ack = sendTelegraph(t, conn, `{"version":1,"type":"kaimemo.remove","requestId":"r4","payload":{"id":"`+created.ID+`","version":"`+updated.Version+`"}}`)
+	require.Equal(t, model.TelegraphTypeAck, ack.Type)
+	var removed model.TelegraphRemovePayload
+	readKaimemoEvent(t, conn, model.TelegraphTypeRemoved, &removed)
+	assert.Equal(t, model.TelegraphRemovePayload{ID: created.ID}, removed)
+}
+
+func TestKaimemoHandler_WebsocketAuth(t *testing.T) {
+	handler := newTestKaimemoHandler(t)
+	url := newTestWebsocketServer(t, handler)
+
+	rec := serve(t, handler.CreateKaimemo, http.MethodPost, "/kaimemo", `{"tempUserID":"user-1","tag":"food","name":"milk"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	session, err := testSessionManager.CreateSession("user-1")
+	require.NoError(t, err)
+	sessionID := session.ID
+	expired, _, err := service.NewTicketManager([]byte("test-secret"), -time.Minute).IssueTicket("user-1")
+	require.NoError(t, err)
+	forged, _, err := service.NewTicketManager([]byte("other-secret"), time.Minute).IssueTicket("user-1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		query          string
+		header         http.Header
+		expectedStatus int
+	}{
+		{name: "ticket", query: kaimemoTicket(t, "user-1"), expectedStatus: http.StatusSwitchingProtocols},
+		{name: "session cookie", header: http.Header{"Cookie": {"session=" + sessionID}}, expectedStatus: http.StatusSwitchingProtocols},
+		{name: "allowed origin", query: kaimemoTicket(t, "user-1"), header: http.Header{"Origin": {testAllowOrigin}}, expectedStatus: http.StatusSwitchingProtocols},
+		// クエリのtempUserIDだけでは認証しない
+		{name: "tempUserID only", query: "tempUserID=user-1", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown session", header: http.Header{"Cookie": {"session=unknown"}}, expectedStatus: http.StatusUnauthorized},
+		{name: "expired ticket", query: "ticket=" + expired, expectedStatus: http.StatusUnauthorized},
+		{name: "forged ticket", query: "ticket=" + forged, expectedStatus: http.StatusUnauthorized},
+		{name: "cross-site origin", header: http.Header{"Cookie": {"session=" + sessionID}, "Origin": {"https://evil.example"}}, expectedStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, res, err := websocket.DefaultDialer.Dial(url+"?"+tt.query, tt.header)
+			require.Equal(t, tt.expectedStatus, res.StatusCode)
+			if tt.expectedStatus != http.StatusSwitchingProtocols {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close()
+			items := readKaimemoList(t, conn)
+			require.Len(t, items, 1)
+			assert.Equal(t, "milk", items[0].Name)
+		})
+	}
+
+	t.Run("session cookie is refreshed on upgrade", func(t *testing.T) {
+		conn, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Cookie": {"session=" + sessionID}})
+		require.NoError(t, err)
+		defer conn.Close()
+		cookies := res.Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "session", cookies[0].Name)
+		assert.Equal(t, sessionID, cookies[0].Value)
+	})
+
+	t.Run("tempUserID selects the shared list", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?"+kaimemoTicket(t, "user-2")+"&tempUserID=user-1", nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		items := readKaimemoList(t, conn)
+		require.Len(t, items, 1)
+		assert.Equal(t, "milk", items[0].Name)
+
+		// 指定しなければ、ログイン中の利用者自身の一覧を送る
+		_, items = dialKaimemo(t, url, "user-2")
+		assert.Empty(t, items)
+	})
+}
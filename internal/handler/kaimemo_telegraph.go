@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"template-echo-notion-integration/internal/hub"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	"template-echo-notion-integration/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FYI. GoでWebSocketを使いチャットサーバー構築 | https://qiita.com/TetsuyaFukunaga/items/4c83a8dedd34e65ffbdc
+// WebsocketTelegraph implements KaimemoHandler.
+//
+// 接続はセッションクッキーまたはticketで認証し、クエリのtempUserIDの一覧の部屋に入る。
+// 在室状況には、認証した利用者として表示する
+func (k *kaimemoHandler) WebsocketTelegraph(c echo.Context) error {
+	tempUserID, viewer, err := k.kaimemoViewer(c)
+	if err != nil {
+		return authenticationError(c, err)
+	}
+	since, resume, err := k.parseSince(c.QueryParam("since"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "since must be a cursor of a received message",
+		})
+	}
+
+	// 認証で設定し直したセッションクッキーは、upgradeの応答で返す
+	conn, err := k.upgrader.Upgrade(c.Response(), c.Request(), http.Header{echo.HeaderSetCookie: c.Response().Header().Values(echo.HeaderSetCookie)})
+	if err != nil {
+		return err
+	}
+	// アップグレード後はHTTPのレスポンスを返せないため、失敗もメッセージで通知する
+	client, err := k.joinKaimemoRoom(tempUserID, conn, viewer, since, resume)
+	defer k.hub.Unregister(client)
+	if err != nil {
+		return nil
+	}
+
+	// 読み取り期限はhubがpongのたびに延ばす。期限切れや切断で読み取りがエラーになり、部屋から外れる
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Println("読み取りエラー:", err)
+			break
+		}
+		client.Touch()
+
+		var msg model.TelegraphMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			k.sendTelegraphError(client, "", &model.TelegraphError{
+				Code:    model.TelegraphErrorInvalidMessage,
+				Message: "message must be a JSON object",
+			})
+			continue
+		}
+		if msg.Version != model.TelegraphVersion {
+			k.sendTelegraphError(client, msg.RequestID, &model.TelegraphError{
+				Code:    model.TelegraphErrorUnsupportedVersion,
+				Message: "version must be 1",
+			})
+			continue
+		}
+
+		if msg.Type == model.TelegraphTypeSync {
+			k.sendKaimemoList(client, tempUserID, msg.RequestID)
+			continue
+		}
+
+		ack, event, terr := k.handleTelegraph(tempUserID, msg)
+		if terr != nil {
+			k.sendTelegraphError(client, msg.RequestID, terr)
+			continue
+		}
+		k.sendTelegraph(client, model.TelegraphTypeAck, msg.RequestID, ack)
+		k.publishKaimemo(tempUserID, event)
+	}
+	return nil
+}
+
+// FetchWebsocketStats implements KaimemoHandler.
+// サーバー全体の接続状況のため、管理者の利用者だけに返す
+func (k *kaimemoHandler) FetchWebsocketStats(c echo.Context) error {
+	userID, err := k.authenticator.Authenticate(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Not logged in",
+		})
+	}
+	if !k.adminUserIDs[userID] {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Forbidden",
+		})
+	}
+	return c.JSON(http.StatusOK, k.hub.Stats())
+}
+
+// FetchKaimemoPresence implements KaimemoHandler.
+// /kaimemo/wsと同じく認証し、クエリのtempUserIDの一覧を見ている利用者を返す
+func (k *kaimemoHandler) FetchKaimemoPresence(c echo.Context) error {
+	tempUserID, _, err := k.kaimemoViewer(c)
+	if err != nil {
+		return authenticationError(c, err)
+	}
+
+	res := model.KaimemoPresenceResponse{Viewers: []model.KaimemoViewer{}}
+	for _, viewer := range k.hub.Viewers(tempUserID) {
+		res.Viewers = append(res.Viewers, model.KaimemoViewer{ID: viewer.ID, Name: viewer.Name})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// KaimemoPresenceTelegraph は、入退室の通知を生成する。hub.WithPresenceに渡す
+func KaimemoPresenceTelegraph(_ string, viewer hub.Viewer, joined bool) []byte {
+	messageType := model.TelegraphTypePresenceLeft
+	if joined {
+		messageType = model.TelegraphTypePresenceJoined
+	}
+	data, err := marshalTelegraph(model.TelegraphMessage{Type: messageType}, model.KaimemoViewer{ID: viewer.ID, Name: viewer.Name})
+	if err != nil {
+		log.Printf("failed to marshal telegraph message: %v", err)
+	}
+	return data
+}
+
+// checkOrigin は、ブラウザからの接続のOriginがallowOriginsに含まれるかを確かめる。
+// 他のサイトのページから、ログイン中の利用者のクッキーで接続される（Cross-Site WebSocket Hijacking）のを防ぐ。
+// Originを送らないブラウザ以外のクライアントは、クッキーやチケットの認証のみで受け付ける
+func checkOrigin(allowOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get(echo.HeaderOrigin)
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		log.Printf("websocket origin not allowed: %s", origin)
+		return false
+	}
+}
+
+// kaimemoViewer は、接続を認証し、見る一覧のtempUserIDと在室状況に表示する利用者を求める。
+// 一覧はクエリのtempUserIDで指定し、指定がなければログイン中の利用者自身の一覧とする。
+// RESTと同じく一覧のIDを知っている家族で共有し、在室状況の利用者は認証した利用者のプロフィールから求める
+func (k *kaimemoHandler) kaimemoViewer(c echo.Context) (string, hub.Viewer, error) {
+	user, err := k.authenticator.AuthenticateUser(c)
+	if err != nil {
+		return "", hub.Viewer{}, err
+	}
+	tempUserID := c.QueryParam("tempUserID")
+	if tempUserID == "" {
+		tempUserID = user.ID
+	}
+	return tempUserID, hub.Viewer{ID: user.ID, Name: user.DisplayName}, nil
+}
+
+// authenticationError は、認証できない場合は401、利用者の取得に失敗した場合は500を返す
+func authenticationError(c echo.Context, err error) error {
+	if errors.Is(err, service.ErrUnauthenticated) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Not logged in",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{
+		"error": "Failed to fetch user",
+	})
+}
+
+// joinKaimemoRoom は、connをtempUserIDの一覧の部屋に登録する。接続への書き込みはhubが行い、他の一覧の部屋には配信されない。
+// resumeなら連番がsinceより後の変更通知を送り直し、送り直せない場合や初回の接続では一覧全体を送る
+func (k *kaimemoHandler) joinKaimemoRoom(tempUserID string, conn hub.Conn, viewer hub.Viewer, since uint64, resume bool) (*hub.Client, error) {
+	var client *hub.Client
+	replayed := false
+	if resume {
+		client, replayed = k.hub.RegisterSince(tempUserID, conn, since, hub.AsViewer(viewer))
+	} else {
+		client = k.hub.Register(tempUserID, conn, hub.AsViewer(viewer))
+	}
+	if replayed {
+		return client, nil
+	}
+	return client, k.sendKaimemoList(client, tempUserID, "")
+}
+
+// kaimemoEvent は、部屋に配信する項目単位の変更
+type kaimemoEvent struct {
+	eventType string
+	payload   any
+}
+
+// publishKaimemo は、tempUserIDの部屋に連番を付けて変更を配信する。RESTでの変更もここから配信する。
+// 配信先は変更を書き込んだ一覧の持ち主の部屋で、実際に行われた変更だけを配信するため、要求の認証は問わない
+func (k *kaimemoHandler) publishKaimemo(tempUserID string, event kaimemoEvent) {
+	payload, err := json.Marshal(event.payload)
+	if err != nil {
+		log.Printf("failed to marshal telegraph message: %v", err)
+		return
+	}
+	k.hub.Publish(tempUserID, func(seq uint64) []byte {
+		data, err := json.Marshal(model.TelegraphMessage{
+			Version: model.TelegraphVersion,
+			Type:    event.eventType,
+			Seq:     seq,
+			Cursor:  k.hub.Cursor(seq),
+			Payload: payload,
+		})
+		if err != nil {
+			log.Printf("failed to marshal telegraph message: %v", err)
+		}
+		return data
+	})
+}
+
+// handleTelegraph は、要求を実行し、ackのpayloadと配信する変更を返す
+func (k *kaimemoHandler) handleTelegraph(tempUserID string, msg model.TelegraphMessage) (any, kaimemoEvent, *model.TelegraphError) {
+	var none kaimemoEvent
+	switch msg.Type {
+	case model.TelegraphTypeCreate:
+		var payload model.TelegraphCreatePayload
+		if err := decodePayload(msg.Payload, &payload); err != nil {
+			return nil, none, err
+		}
+		if payload.Name == "" {
+			return nil, none, invalidPayload("name is required")
+		}
+		res, err := k.service.CreateKaimemo(model.CreateKaimemoRequest{
+			TempUserID: tempUserID,
+			Tag:        payload.Tag,
+			Name:       payload.Name,
+		})
+		if err != nil {
+			return nil, none, telegraphError(err)
+		}
+		return res, kaimemoEvent{eventType: model.TelegraphTypeAdded, payload: res}, nil
+
+	case model.TelegraphTypeUpdate:
+		var payload model.TelegraphUpdatePayload
+		if err := decodePayload(msg.Payload, &payload); err != nil {
+			return nil, none, err
+		}
+		if payload.ID == "" {
+			return nil, none, invalidPayload("id is required")
+		}
+		if payload.Name == nil && payload.Tag == nil && payload.Done == nil {
+			return nil, none, invalidPayload("name, tag or done is required")
+		}
+		if payload.Name != nil && *payload.Name == "" {
+			return nil, none, invalidPayload("name must not be empty")
+		}
+		res, err := k.service.UpdateKaimemo(payload.ID, model.UpdateKaimemoRequest{
+			TempUserID: tempUserID,
+			Tag:        payload.Tag,
+			Name:       payload.Name,
+			Done:       payload.Done,
+			IfMatch:    payload.Version,
+		})
+		if err != nil {
+			return nil, none, telegraphError(err)
+		}
+		return res, kaimemoEvent{eventType: model.TelegraphTypeUpdated, payload: res}, nil
+
+	case model.TelegraphTypeRemove:
+		var payload model.TelegraphRemovePayload
+		if err := decodePayload(msg.Payload, &payload); err != nil {
+			return nil, none, err
+		}
+		if payload.ID == "" {
+			return nil, none, invalidPayload("id is required")
+		}
+		if err := k.service.RemoveKaimemo(payload.ID, tempUserID, payload.Version); err != nil {
+			return nil, none, telegraphError(err)
+		}
+		return nil, kaimemoEvent{eventType: model.TelegraphTypeRemoved, payload: model.TelegraphRemovePayload{ID: payload.ID}}, nil
+
+	default:
+		return nil, none, &model.TelegraphError{
+			Code:    model.TelegraphErrorUnknownType,
+			Message: "unknown type: " + msg.Type,
+		}
+	}
+}
+
+// sendKaimemoList は、tempUserIDの買い物一覧全体をclientだけに送る。取得に失敗した場合はerrorを送る。
+// 連番は取得前に読み、それより後の変更通知を一覧の後に送り直す。
+// 一覧に反映済みの変更が重ねて届くことはあるが、漏れることはない
+func (k *kaimemoHandler) sendKaimemoList(client *hub.Client, tempUserID string, requestID string) error {
+	seq := k.hub.Seq(tempUserID)
+	res, err := k.service.FetchKaimemo(tempUserID)
+	if err != nil {
+		k.sendTelegraphError(client, requestID, telegraphError(err))
+		return err
+	}
+	if res == nil {
+		res = []model.KaimemoResponse{}
+	}
+	data, err := marshalTelegraph(model.TelegraphMessage{Type: model.TelegraphTypeList, RequestID: requestID, Seq: seq, Cursor: k.hub.Cursor(seq)}, res)
+	if err != nil {
+		log.Printf("failed to marshal telegraph message: %v", err)
+		return err
+	}
+	k.hub.SendSnapshot(client, data, seq)
+	return nil
+}
+
+func (k *kaimemoHandler) sendTelegraph(client *hub.Client, messageType string, requestID string, payload any) {
+	data, err := marshalTelegraph(model.TelegraphMessage{Type: messageType, RequestID: requestID}, payload)
+	if err != nil {
+		log.Printf("failed to marshal telegraph message: %v", err)
+		return
+	}
+	k.hub.Send(client, data)
+}
+
+func (k *kaimemoHandler) sendTelegraphError(client *hub.Client, requestID string, terr *model.TelegraphError) {
+	k.sendTelegraph(client, model.TelegraphTypeError, requestID, terr)
+}
+
+// parseSince は、再接続時に指定された位置を解釈する。空の場合や、再起動前のhubが発行した位置の場合はresumeはfalse
+func (k *kaimemoHandler) parseSince(v string) (since uint64, resume bool, err error) {
+	if v == "" {
+		return 0, false, nil
+	}
+	return k.hub.ParseCursor(v)
+}
+
+// marshalTelegraph は、msgにバージョンとpayloadを設定してエンコードする
+func marshalTelegraph(msg model.TelegraphMessage, payload any) ([]byte, error) {
+	msg.Version = model.TelegraphVersion
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload = raw
+	}
+	return json.Marshal(msg)
+}
+
+func decodePayload(raw json.RawMessage, v any) *model.TelegraphError {
+	if len(raw) == 0 {
+		return invalidPayload("payload is required")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return invalidPayload(err.Error())
+	}
+	return nil
+}
+
+func invalidPayload(message string) *model.TelegraphError {
+	return &model.TelegraphError{
+		Code:    model.TelegraphErrorInvalidPayload,
+		Message: message,
+	}
+}
+
+// telegraphError は、リポジトリのエラーをerrorメッセージのcodeに変換する
+func telegraphError(err error) *model.TelegraphError {
+	var conflict *repository.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return &model.TelegraphError{Code: model.TelegraphErrorConflict, Message: "Conflict", Current: conflict.Current}
+	case errors.Is(err, repository.ErrNotFound):
+		return &model.TelegraphError{Code: model.TelegraphErrorNotFound, Message: "Not found"}
+	case errors.Is(err, repository.ErrForbidden):
+		return &model.TelegraphError{Code: model.TelegraphErrorForbidden, Message: "Forbidden"}
+	case errors.Is(err, repository.ErrInvalidUserKey):
+		return invalidPayload("tempUserID must not contain commas")
+	default:
+		log.Printf("failed to handle telegraph message: %v", err)
+		return &model.TelegraphError{Code: model.TelegraphErrorInternal, Message: "Internal error"}
+	}
+}
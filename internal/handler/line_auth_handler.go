@@ -2,8 +2,10 @@
 package handler
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
 	"template-echo-notion-integration/internal/service"
 
 	"github.com/labstack/echo/v4"
@@ -15,6 +17,8 @@ type AuthHandler interface {
 	Callback(c echo.Context) error
 	FetchMe(c echo.Context) error
 	Logout(c echo.Context) error
+	IssueTicket(c echo.Context) error
+	LinkTempUser(c echo.Context) error
 }
 
 type lineAuthHandler struct {
@@ -33,33 +37,80 @@ func (a *lineAuthHandler) Login(c echo.Context) error {
 }
 
 // Callback implements AuthHandler.
+// IDトークンを検証できない場合は、ログインさせずに401を返す
 func (a *lineAuthHandler) Callback(c echo.Context) error {
 	err := a.lineAuthService.Callback(c, c.QueryParam("code"))
+	if errors.Is(err, service.ErrInvalidLoginState) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "state is invalid or expired"})
+	}
+	if errors.Is(err, repository.ErrInvalidIDToken) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "id token is invalid"})
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, fmt.Errorf("Callback Failed: %v", err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Callback Failed"})
 	}
 
 	// TODO : 下記はフロントエンド未実装のため、仮実装。本来はRedirectでフロントエンドのホーム画面にルーティングする
 	return c.JSON(http.StatusOK, map[string]string{"message": "Callback Success"})
 }
 
+// FetchMe implements AuthHandler.
+// ログイン中の利用者のプロフィールと、連携したtempUserIDを返す
 func (a *lineAuthHandler) FetchMe(c echo.Context) error {
-	// TODO : userInfo, errを返すように修正する
-	err := a.lineAuthService.CheckAuth(c)
-	if err != nil {
+	user, err := a.lineAuthService.CheckAuth(c)
+	if errors.Is(err, service.ErrUnauthenticated) {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
 	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check session"})
+	}
 
-	// TODO : Service層でユーザー情報を取得して返す
-	return c.JSON(http.StatusOK, map[string]string{"user": "userID"})
+	return c.JSON(http.StatusOK, user)
 }
 
 func (a *lineAuthHandler) Logout(c echo.Context) error {
-	a.lineAuthService.Logout(c)
+	if err := a.lineAuthService.Logout(c); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Logout Failed"})
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "Logged out"})
 }
 
+// IssueTicket implements AuthHandler.
+// クッキーを送れないクロスサイトのWebSocket接続のため、接続用のチケットを返す
+func (a *lineAuthHandler) IssueTicket(c echo.Context) error {
+	res, err := a.lineAuthService.IssueTicket(c)
+	if errors.Is(err, service.ErrUnauthenticated) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to issue ticket"})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// LinkTempUser implements AuthHandler.
+// ログイン前に使っていたtempUserIDのデータを、ログイン中の利用者に移行して件数を返す。何度呼び出してもよい
+func (a *lineAuthHandler) LinkTempUser(c echo.Context) error {
+	var req model.LinkTempUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	res, err := a.lineAuthService.LinkTempUser(c, req.TempUserID)
+	switch {
+	case errors.Is(err, service.ErrUnauthenticated):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
+	case errors.Is(err, service.ErrInvalidTempUserID):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tempUserID is invalid"})
+	case errors.Is(err, service.ErrTempUserIDTaken):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "tempUserID is linked to another user"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link tempUserID"})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
 func NewLineAuthHandler(lineAuthService service.LineAuthService, lineConfig *oauth2.Config) AuthHandler {
 	return &lineAuthHandler{
 		lineAuthService: lineAuthService,
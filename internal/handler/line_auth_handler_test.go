@@ -1,11 +1,17 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	service "template-echo-notion-integration/internal/mock/service"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	authservice "template-echo-notion-integration/internal/service"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -62,21 +68,50 @@ func TestAuthHandler_Login(t *testing.T) {
 	}
 }
 func TestAuthHandler_Callback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLineAuthService := service.NewMockLineAuthService(ctrl)
+	handler := NewLineAuthHandler(mockLineAuthService, nil)
+
 	tests := []struct {
 		name           string
 		code           string
+		setupMock      func()
 		expectedStatus int
 	}{
 		{
-			name:           "successful callback",
-			code:           "valid_code",
+			name: "successful callback",
+			code: "valid_code",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().Callback(gomock.Any(), "valid_code").Return(nil)
+			},
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "missing code",
-			code:           "",
+			name: "invalid state",
+			code: "valid_code",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().Callback(gomock.Any(), "valid_code").Return(authservice.ErrInvalidLoginState)
+			},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name: "invalid id token",
+			code: "valid_code",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().Callback(gomock.Any(), "valid_code").Return(repository.ErrInvalidIDToken)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "failed callback",
+			code: "valid_code",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().Callback(gomock.Any(), "valid_code").Return(errors.New("token endpoint is unavailable"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -86,7 +121,8 @@ func TestAuthHandler_Callback(t *testing.T) {
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
-			handler := NewLineAuthHandler()
+			tt.setupMock()
+
 			err := handler.Callback(c)
 
 			assert.NoError(t, err)
@@ -106,21 +142,37 @@ func TestAuthHandler_CheckAuth(t *testing.T) {
 		name           string
 		setupMock      func()
 		expectedStatus int
+		expectedBody   string
 	}{
 		{
 			name: "authenticated user",
 			setupMock: func() {
-				mockLineAuthService.EXPECT().CheckAuth(gomock.Any()).Return(nil)
+				mockLineAuthService.EXPECT().CheckAuth(gomock.Any()).Return(&model.User{
+					ID:                "user-1",
+					DisplayName:       "Taro",
+					PictureURL:        "https://profile.line-scdn.net/taro",
+					LinkedTempUserIDs: []string{"temp-1"},
+					CreatedAt:         time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+					LastLoginAt:       time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+				}, nil)
 			},
 			expectedStatus: http.StatusOK,
+			expectedBody:   `{"userId":"user-1","displayName":"Taro","pictureUrl":"https://profile.line-scdn.net/taro","linkedTempUserIds":["temp-1"],"createdAt":"2025-01-01T00:00:00Z","lastLoginAt":"2025-01-02T00:00:00Z"}`,
 		},
 		{
 			name: "unauthenticated user",
 			setupMock: func() {
-				mockLineAuthService.EXPECT().CheckAuth(gomock.Any()).Return(assert.AnError)
+				mockLineAuthService.EXPECT().CheckAuth(gomock.Any()).Return(nil, authservice.ErrUnauthenticated)
 			},
 			expectedStatus: http.StatusUnauthorized,
 		},
+		{
+			name: "service error",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().CheckAuth(gomock.Any()).Return(nil, assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -132,10 +184,13 @@ func TestAuthHandler_CheckAuth(t *testing.T) {
 
 			tt.setupMock()
 
-			err := handler.CheckAuth(c)
+			err := handler.FetchMe(c)
 
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			}
 		})
 	}
 }
@@ -159,3 +214,139 @@ func TestAuthHandler_Logout(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestAuthHandler_IssueTicket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLineAuthService := service.NewMockLineAuthService(ctrl)
+	handler := &lineAuthHandler{lineAuthService: mockLineAuthService}
+
+	tests := []struct {
+		name           string
+		setupMock      func()
+		expectedStatus int
+	}{
+		{
+			name: "logged in",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().IssueTicket(gomock.Any()).Return(&model.TicketResponse{Ticket: "ticket"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "not logged in",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().IssueTicket(gomock.Any()).Return(nil, authservice.ErrUnauthenticated)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "service error",
+			setupMock: func() {
+				mockLineAuthService.EXPECT().IssueTicket(gomock.Any()).Return(nil, assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/ticket", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.setupMock()
+
+			err := handler.IssueTicket(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestAuthHandler_LinkTempUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLineAuthService := service.NewMockLineAuthService(ctrl)
+	handler := &lineAuthHandler{lineAuthService: mockLineAuthService}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "linked",
+			body: `{"tempUserID":"temp-1"}`,
+			setupMock: func() {
+				mockLineAuthService.EXPECT().LinkTempUser(gomock.Any(), "temp-1").Return(&model.LinkTempUserResponse{TempUserID: "temp-1", MigratedItems: 3, MigratedAmounts: 2}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"tempUserID":"temp-1","migratedItems":3,"migratedAmounts":2}`,
+		},
+		{
+			name:           "invalid body",
+			body:           `{"tempUserID":`,
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "not logged in",
+			body: `{"tempUserID":"temp-1"}`,
+			setupMock: func() {
+				mockLineAuthService.EXPECT().LinkTempUser(gomock.Any(), "temp-1").Return(nil, authservice.ErrUnauthenticated)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "invalid tempUserID",
+			body: `{"tempUserID":""}`,
+			setupMock: func() {
+				mockLineAuthService.EXPECT().LinkTempUser(gomock.Any(), "").Return(nil, authservice.ErrInvalidTempUserID)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "linked to another user",
+			body: `{"tempUserID":"temp-1"}`,
+			setupMock: func() {
+				mockLineAuthService.EXPECT().LinkTempUser(gomock.Any(), "temp-1").Return(nil, authservice.ErrTempUserIDTaken)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "service error",
+			body: `{"tempUserID":"temp-1"}`,
+			setupMock: func() {
+				mockLineAuthService.EXPECT().LinkTempUser(gomock.Any(), "temp-1").Return(nil, assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/link", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.setupMock()
+
+			err := handler.LinkTempUser(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package hub
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor は、再接続時に指定された位置を解釈できない場合のエラー
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// newEpoch は、Hubごとに異なるIDを生成する。生成した時刻を使うため、再起動のたびに変わる
+func newEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Cursor は、連番seqまで受け取ったことを表す再接続用の位置を返す。
+// Hubを作り直す（サーバーを再起動する）と連番は振り直しになるため、Hubごとのepochを付けて区別する
+func (h *Hub) Cursor(seq uint64) string {
+	return h.epoch + ":" + strconv.FormatUint(seq, 10)
+}
+
+// ParseCursor は、Cursorが生成した位置から連番を取り出す。
+// 別のHubが生成した位置や、epochのない数字だけの位置はcurrentがfalseになる。
+// その連番は今の履歴と対応しないため、取りこぼしを埋めずに一覧全体を送り直す
+func (h *Hub) ParseCursor(cursor string) (seq uint64, current bool, err error) {
+	epoch, rawSeq, ok := strings.Cut(cursor, ":")
+	if !ok {
+		if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+			return 0, false, ErrInvalidCursor
+		}
+		return 0, false, nil
+	}
+	seq, err = strconv.ParseUint(rawSeq, 10, 64)
+	if err != nil || epoch == "" {
+		return 0, false, ErrInvalidCursor
+	}
+	if epoch != h.epoch {
+		return 0, false, nil
+	}
+	return seq, true, nil
+}
@@ -0,0 +1,35 @@
+package hub
+
+import "time"
+
+// eventLog は、部屋に配信したメッセージの直近の履歴
+type eventLog struct {
+	// seq は、最後に配信したメッセージの連番
+	seq uint64
+	// events は、連番がseq-len(events)+1からseqまでのメッセージ
+	events [][]byte
+	// lastUsed は、最後に配信したか、部屋の接続がなくなった時刻
+	lastUsed time.Time
+}
+
+// append は、次の連番でdataを記録し、limit件を超えた古い履歴を捨てる
+func (l *eventLog) append(data []byte, limit int) {
+	l.seq++
+	l.events = append(l.events, data)
+	if over := len(l.events) - limit; over > 0 {
+		// 古い要素を参照し続けないよう詰め直す
+		l.events = append([][]byte(nil), l.events[over:]...)
+	}
+}
+
+// since は、連番がsinceより後のメッセージを返す。捨てた履歴が必要な場合はfalseを返す
+func (l *eventLog) since(since uint64) ([][]byte, bool) {
+	if since >= l.seq {
+		return nil, since == l.seq
+	}
+	missed := l.seq - since
+	if missed > uint64(len(l.events)) {
+		return nil, false
+	}
+	return l.events[uint64(len(l.events))-missed:], true
+}
@@ -0,0 +1,558 @@
+// Package hub は、WebSocketの接続を部屋ごとに管理し、メッセージを配信する。
+//
+// 接続の登録・解除・配信はすべてチャネル経由でHubのゴルーチンが処理するため、
+// 複数のハンドラから同時に呼び出しても安全。
+//
+// Publishで配信したメッセージには部屋ごとの連番を付けて直近の分を保持し、
+// 再接続したクライアントにRegisterSinceで取りこぼした分を送り直す。
+// 連番はHubを作り直すと振り直しになるため、クライアントにはHubごとのepochを付けたCursorを渡す。
+// 接続のない部屋の履歴は、WithHistoryTTLの時間が過ぎると捨てる。
+// AsViewerで登録した接続は利用者ごとの在室状況として数え、入退室を通知する。
+//
+// 接続ごとにpingを送り、pongもメッセージも届かない接続や、
+// やり取りのないまま放置された接続は切断して部屋から外す
+package hub
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultSendBuffer は、接続ごとの送信キューの長さ
+const defaultSendBuffer = 16
+
+// defaultHistory は、部屋ごとに保持する配信履歴の件数
+const defaultHistory = 256
+
+// defaultHistoryTTL は、接続のなくなった部屋の配信履歴を保持する時間
+const defaultHistoryTTL = 10 * time.Minute
+
+// 接続の死活監視の既定値
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultPongWait     = 60 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	defaultIdleTimeout  = 30 * time.Minute
+)
+
+// Conn は、Hubが読み書きの期限を管理するWebSocketの接続。*websocket.Conn が満たす
+type Conn interface {
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// Client は、部屋に登録された接続
+type Client struct {
+	hub  *Hub
+	room string
+	conn Conn
+	send chan []byte
+	done chan struct{}
+	// viewer は、在室状況に数える利用者。IDが空なら数えない
+	viewer Viewer
+	// lastActive は、最後にメッセージをやり取りした時刻（UnixNano）
+	lastActive atomic.Int64
+}
+
+// Touch は、クライアントからメッセージを受け取ったときに呼び出し、
+// 読み取り期限とアイドル時間をリセットする。読み取りを行うゴルーチンから呼び出すこと
+func (c *Client) Touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait)); err != nil {
+		log.Printf("failed to set websocket read deadline: %v", err)
+	}
+}
+
+// Room は、クライアントが参加している部屋を返す
+func (c *Client) Room() string {
+	return c.room
+}
+
+// Done は、クライアントが部屋から外れると閉じられる
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// writePump は、送信キューのメッセージを順に書き込み、定期的にpingを送る。
+// 接続への書き込みはこのゴルーチンだけが行う
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.pingInterval)
+	defer ticker.Stop()
+
+	failed := false
+	// fail は、以降の書き込みをやめて部屋から外す。送信キューはHubが閉じるまで読み捨てる
+	fail := func(format string, args ...any) {
+		log.Printf(format, args...)
+		failed = true
+		go c.hub.Unregister(c)
+	}
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				c.conn.Close()
+				return
+			}
+			if failed {
+				continue
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				fail("failed to write websocket message: %v", err)
+				continue
+			}
+			c.lastActive.Store(time.Now().UnixNano())
+		case <-ticker.C:
+			if failed {
+				continue
+			}
+			if idle := time.Since(time.Unix(0, c.lastActive.Load())); c.hub.idleTimeout > 0 && idle > c.hub.idleTimeout {
+				fail("websocket client in room %q is idle for %s, disconnecting", c.room, idle.Round(time.Second))
+				continue
+			}
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.hub.writeTimeout)); err != nil {
+				fail("failed to write websocket ping: %v", err)
+			}
+		}
+	}
+}
+
+type message struct {
+	room   string
+	client *Client
+	data   []byte
+	// replay がtrueなら、dataに続けてsinceより後の履歴を送る
+	replay bool
+	since  uint64
+}
+
+type registration struct {
+	client *Client
+	// replay がtrueなら、sinceより後の履歴を送り直す
+	replay bool
+	since  uint64
+	reply  chan bool
+}
+
+type publication struct {
+	room  string
+	build func(seq uint64) []byte
+}
+
+type countRequest struct {
+	room  string
+	reply chan int
+}
+
+// Stats は、接続数の集計
+type Stats struct {
+	Rooms   int `json:"rooms"`
+	Clients int `json:"clients"`
+}
+
+type seqRequest struct {
+	room  string
+	reply chan uint64
+}
+
+// Hub は、部屋ごとのクライアントを保持し、配信する
+type Hub struct {
+	sendBuffer   int
+	history      int
+	historyTTL   time.Duration
+	pingInterval time.Duration
+	pongWait     time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+
+	register   chan registration
+	unregister chan *Client
+	broadcast  chan message
+	publish    chan publication
+	direct     chan message
+	count      chan countRequest
+	stats      chan chan Stats
+	viewers    chan viewersRequest
+	seq        chan seqRequest
+	stop       chan struct{}
+	stopped    chan struct{}
+
+	presence func(room string, viewer Viewer, joined bool) []byte
+
+	// epoch は、Cursorに付けるHubごとのID
+	epoch string
+
+	// rooms・logs・evictedSeq・departed はRunのゴルーチンだけが読み書きする
+	rooms map[string]map[*Client]bool
+	logs  map[string]*eventLog
+	// evictedSeq は、捨てた履歴の連番の最大値。新しく作る履歴はこの続きから振り、
+	// 捨てる前の連番で再接続したクライアントが、別の配信を受け取り済みと誤解しないようにする
+	evictedSeq uint64
+	// departed は、部屋から外れ、退室の通知を待っている利用者の接続
+	departed []*Client
+}
+
+// Option は、Newの任意設定
+type Option func(*Hub)
+
+// WithSendBuffer は、接続ごとの送信キューの長さを指定する。
+// キューがあふれた接続は、遅いクライアントとして切断する
+func WithSendBuffer(n int) Option {
+	return func(h *Hub) {
+		h.sendBuffer = n
+	}
+}
+
+// WithHistory は、部屋ごとに保持する配信履歴の件数を指定する。
+// これより前の取りこぼしは送り直せないため、クライアントは一覧全体を取得し直す
+func WithHistory(n int) Option {
+	return func(h *Hub) {
+		h.history = n
+	}
+}
+
+// WithHistoryTTL は、接続のなくなった部屋の配信履歴を保持する時間を指定する。
+// 過ぎた履歴は捨てるため、それより後に再接続したクライアントは一覧全体を取得し直す。0なら捨てない
+func WithHistoryTTL(d time.Duration) Option {
+	return func(h *Hub) {
+		h.historyTTL = d
+	}
+}
+
+// WithKeepalive は、pingを送る間隔と、pongもメッセージも届かない接続を切断するまでの時間を指定する。
+// pongWaitはpingIntervalより長くする
+func WithKeepalive(pingInterval, pongWait time.Duration) Option {
+	return func(h *Hub) {
+		h.pingInterval = pingInterval
+		h.pongWait = pongWait
+	}
+}
+
+// WithWriteTimeout は、1回の書き込みの期限を指定する。期限を過ぎた接続は切断する
+func WithWriteTimeout(d time.Duration) Option {
+	return func(h *Hub) {
+		h.writeTimeout = d
+	}
+}
+
+// WithIdleTimeout は、メッセージを送りも受け取りもしない接続を切断するまでの時間を指定する。
+// pingとpongはやり取りに含めない。0なら切断しない
+func WithIdleTimeout(d time.Duration) Option {
+	return func(h *Hub) {
+		h.idleTimeout = d
+	}
+}
+
+// New は、Hubを生成する。Runを呼び出すまで配信されない
+func New(opts ...Option) *Hub {
+	h := &Hub{
+		sendBuffer:   defaultSendBuffer,
+		history:      defaultHistory,
+		historyTTL:   defaultHistoryTTL,
+		pingInterval: defaultPingInterval,
+		pongWait:     defaultPongWait,
+		writeTimeout: defaultWriteTimeout,
+		idleTimeout:  defaultIdleTimeout,
+		register:     make(chan registration),
+		unregister:   make(chan *Client),
+		broadcast:    make(chan message),
+		publish:      make(chan publication),
+		direct:       make(chan message),
+		count:        make(chan countRequest),
+		stats:        make(chan chan Stats),
+		viewers:      make(chan viewersRequest),
+		seq:          make(chan seqRequest),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		rooms:        make(map[string]map[*Client]bool),
+		logs:         make(map[string]*eventLog),
+		epoch:        newEpoch(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Run は、Stopが呼ばれるまで登録・解除・配信を処理する
+func (h *Hub) Run() {
+	defer close(h.stopped)
+
+	// 履歴は、保持する時間の半分ごとに見直す
+	var sweep <-chan time.Time
+	if h.historyTTL > 0 {
+		ticker := time.NewTicker(h.historyTTL / 2)
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
+
+	for {
+		select {
+		case reg := <-h.register:
+			client := reg.client
+			if h.rooms[client.room] == nil {
+				h.rooms[client.room] = make(map[*Client]bool)
+			}
+			h.rooms[client.room][client] = true
+			h.announceJoin(client)
+			if reg.replay {
+				reg.reply <- h.replay(client, reg.since)
+			}
+		case client := <-h.unregister:
+			h.remove(client)
+		case msg := <-h.broadcast:
+			for client := range h.rooms[msg.room] {
+				h.enqueue(client, msg.data)
+			}
+		case pub := <-h.publish:
+			history := h.logs[pub.room]
+			if history == nil {
+				history = &eventLog{seq: h.evictedSeq}
+				h.logs[pub.room] = history
+			}
+			data := pub.build(history.seq + 1)
+			history.append(data, h.history)
+			history.lastUsed = time.Now()
+			for client := range h.rooms[pub.room] {
+				h.enqueue(client, data)
+			}
+		case req := <-h.seq:
+			if history := h.logs[req.room]; history != nil {
+				req.reply <- history.seq
+			} else {
+				req.reply <- 0
+			}
+		case msg := <-h.direct:
+			if h.rooms[msg.client.room][msg.client] {
+				h.enqueue(msg.client, msg.data)
+				if msg.replay && h.rooms[msg.client.room][msg.client] && !h.replay(msg.client, msg.since) {
+					log.Printf("failed to replay websocket messages in room %q since %d", msg.client.room, msg.since)
+				}
+			}
+		case req := <-h.count:
+			req.reply <- len(h.rooms[req.room])
+		case reply := <-h.stats:
+			stats := Stats{Rooms: len(h.rooms)}
+			for _, clients := range h.rooms {
+				stats.Clients += len(clients)
+			}
+			reply <- stats
+		case req := <-h.viewers:
+			req.reply <- h.roomViewers(req.room)
+		case now := <-sweep:
+			h.evictHistory(now)
+		case <-h.stop:
+			for _, clients := range h.rooms {
+				for client := range clients {
+					h.remove(client)
+				}
+			}
+			return
+		}
+		h.announceDepartures()
+	}
+}
+
+// Stop は、すべての接続を閉じてRunを終了する
+func (h *Hub) Stop() {
+	select {
+	case <-h.stop:
+	default:
+		close(h.stop)
+	}
+	<-h.stopped
+}
+
+// Register は、connをroomに登録する。connへの書き込みはHubが行う
+func (h *Hub) Register(room string, conn Conn, opts ...ClientOption) *Client {
+	client, _ := h.join(registration{client: h.newClient(room, conn, opts)})
+	return client
+}
+
+// RegisterSince は、connをroomに登録し、連番がsinceより後の配信履歴を続けて送る。
+// 履歴が残っておらず取りこぼしを埋められない場合はfalseを返す
+func (h *Hub) RegisterSince(room string, conn Conn, since uint64, opts ...ClientOption) (*Client, bool) {
+	return h.join(registration{
+		client: h.newClient(room, conn, opts),
+		replay: true,
+		since:  since,
+		reply:  make(chan bool, 1),
+	})
+}
+
+func (h *Hub) newClient(room string, conn Conn, opts []ClientOption) *Client {
+	client := &Client{
+		hub:  h,
+		room: room,
+		conn: conn,
+		send: make(chan []byte, h.sendBuffer),
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	// pongが届くたびに読み取り期限を延ばす。途絶えた接続は読み取りがエラーになる
+	client.Touch()
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.pongWait))
+	})
+	go client.writePump()
+	return client
+}
+
+func (h *Hub) join(reg registration) (*Client, bool) {
+	select {
+	case h.register <- reg:
+		if reg.replay {
+			return reg.client, <-reg.reply
+		}
+		return reg.client, true
+	case <-h.stopped:
+		close(reg.client.send)
+		close(reg.client.done)
+		return reg.client, false
+	}
+}
+
+// Unregister は、clientを部屋から外し、接続を閉じる。何度呼び出してもよい
+func (h *Hub) Unregister(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.stopped:
+	}
+}
+
+// Broadcast は、roomの全クライアントにdataを送る
+func (h *Hub) Broadcast(room string, data []byte) {
+	select {
+	case h.broadcast <- message{room: room, data: data}:
+	case <-h.stopped:
+	}
+}
+
+// Send は、clientだけにdataを送る
+func (h *Hub) Send(client *Client, data []byte) {
+	select {
+	case h.direct <- message{client: client, data: data}:
+	case <-h.stopped:
+	}
+}
+
+// SendSnapshot は、clientだけにdataを送り、続けて連番がseqより後の配信履歴を送る。
+// seq時点の一覧全体をdataとして送れば、取得中に配信された変更が一覧の後に届く
+func (h *Hub) SendSnapshot(client *Client, data []byte, seq uint64) {
+	select {
+	case h.direct <- message{client: client, data: data, replay: true, since: seq}:
+	case <-h.stopped:
+	}
+}
+
+// Publish は、roomの次の連番でbuildが生成したメッセージを全クライアントに送り、履歴に残す。
+// buildはHubのゴルーチンで呼ばれるため、ブロックしてはならない
+func (h *Hub) Publish(room string, build func(seq uint64) []byte) {
+	select {
+	case h.publish <- publication{room: room, build: build}:
+	case <-h.stopped:
+	}
+}
+
+// Seq は、roomで最後に配信したメッセージの連番を返す。まだ配信していなければ0
+func (h *Hub) Seq(room string) uint64 {
+	req := seqRequest{room: room, reply: make(chan uint64, 1)}
+	select {
+	case h.seq <- req:
+		return <-req.reply
+	case <-h.stopped:
+		return 0
+	}
+}
+
+// Stats は、部屋と接続の数を返す
+func (h *Hub) Stats() Stats {
+	reply := make(chan Stats, 1)
+	select {
+	case h.stats <- reply:
+		return <-reply
+	case <-h.stopped:
+		return Stats{}
+	}
+}
+
+// Count は、roomに接続しているクライアントの数を返す
+func (h *Hub) Count(room string) int {
+	req := countRequest{room: room, reply: make(chan int, 1)}
+	select {
+	case h.count <- req:
+		return <-req.reply
+	case <-h.stopped:
+		return 0
+	}
+}
+
+// enqueue は、送信キューに空きがなければクライアントを切断する
+func (h *Hub) enqueue(client *Client, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("websocket client in room %q is too slow, disconnecting", client.room)
+		h.remove(client)
+	}
+}
+
+// replay は、sinceより後の履歴をclientに送る。履歴が欠けているか、
+// 送信キューに収まらない場合は何も送らずfalseを返す
+func (h *Hub) replay(client *Client, since uint64) bool {
+	history := h.logs[client.room]
+	if history == nil {
+		// 再起動などで履歴が失われている
+		return since == 0
+	}
+	missed, ok := history.since(since)
+	if !ok {
+		return false
+	}
+	if len(missed) > cap(client.send)-len(client.send) {
+		return false
+	}
+	for _, data := range missed {
+		client.send <- data
+	}
+	return true
+}
+
+func (h *Hub) remove(client *Client) {
+	clients, ok := h.rooms[client.room]
+	if !ok || !clients[client] {
+		return
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(h.rooms, client.room)
+		if history := h.logs[client.room]; history != nil {
+			history.lastUsed = time.Now()
+		}
+	}
+	close(client.send)
+	close(client.done)
+	if client.viewer.ID != "" {
+		h.departed = append(h.departed, client)
+	}
+}
+
+// evictHistory は、接続がなく、最後の配信か退室から保持する時間が過ぎた部屋の履歴を捨てる
+func (h *Hub) evictHistory(now time.Time) {
+	for room, history := range h.logs {
+		if len(h.rooms[room]) > 0 || now.Sub(history.lastUsed) < h.historyTTL {
+			continue
+		}
+		h.evictedSeq = max(h.evictedSeq, history.seq)
+		delete(h.logs, room)
+	}
+}
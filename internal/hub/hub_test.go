@@ -0,0 +1,531 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn は、書き込まれたメッセージを記録するConn
+type fakeConn struct {
+	mu     sync.Mutex
+	closed bool
+	// block が閉じられるまで書き込みを止める（遅いクライアント）
+	block chan struct{}
+	// err を書き込みのたびに返す
+	err error
+	// written は、書き込みのたびに通知する
+	written chan string
+	// pings は、pingを送るたびに通知する
+	pings        chan struct{}
+	readDeadline time.Time
+	pongHandler  func(string) error
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{written: make(chan string, 64), pings: make(chan struct{}, 64)}
+}
+
+func (f *fakeConn) WriteMessage(_ int, data []byte) error {
+	if f.block != nil {
+		<-f.block
+	}
+	if err := f.writeErr(); err != nil {
+		return err
+	}
+	select {
+	case f.written <- string(data):
+	default:
+	}
+	return nil
+}
+
+func (f *fakeConn) WriteControl(messageType int, _ []byte, _ time.Time) error {
+	if err := f.writeErr(); err != nil {
+		return err
+	}
+	if messageType == websocket.PingMessage {
+		select {
+		case f.pings <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (f *fakeConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (f *fakeConn) SetReadDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readDeadline = t
+	return nil
+}
+
+func (f *fakeConn) SetPongHandler(h func(string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pongHandler = h
+}
+
+func (f *fakeConn) getReadDeadline() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readDeadline
+}
+
+// pong は、クライアントからpongが届いたときの処理を行う
+func (f *fakeConn) pong() error {
+	f.mu.Lock()
+	h := f.pongHandler
+	f.mu.Unlock()
+	return h("")
+}
+
+func (f *fakeConn) writeErr() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *fakeConn) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeConn) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *fakeConn) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case msg := <-f.written:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return ""
+	}
+}
+
+func (f *fakeConn) assertNoMessage(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-f.written:
+		t.Fatalf("unexpected message: %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newRunningHub(t *testing.T, opts ...Option) *Hub {
+	t.Helper()
+
+	h := New(opts...)
+	go h.Run()
+	t.Cleanup(h.Stop)
+	return h
+}
+
+func waitDone(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case <-client.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("client was not removed")
+	}
+}
+
+func TestHub_BroadcastToRoom(t *testing.T) {
+	h := newRunningHub(t)
+	a1, a2, b := newFakeConn(), newFakeConn(), newFakeConn()
+	h.Register("room-a", a1)
+	h.Register("room-a", a2)
+	h.Register("room-b", b)
+
+	h.Broadcast("room-a", []byte("hello a"))
+	assert.Equal(t, "hello a", a1.next(t))
+	assert.Equal(t, "hello a", a2.next(t))
+	b.assertNoMessage(t)
+
+	assert.Equal(t, 2, h.Count("room-a"))
+	assert.Equal(t, 1, h.Count("room-b"))
+	assert.Equal(t, 0, h.Count("room-c"))
+}
+
+func TestHub_Send(t *testing.T) {
+	h := newRunningHub(t)
+	a1, a2 := newFakeConn(), newFakeConn()
+	client := h.Register("room-a", a1)
+	h.Register("room-a", a2)
+
+	h.Send(client, []byte("only a1"))
+	assert.Equal(t, "only a1", a1.next(t))
+	a2.assertNoMessage(t)
+}
+
+func TestHub_Unregister(t *testing.T) {
+	h := newRunningHub(t)
+	conn := newFakeConn()
+	client := h.Register("room-a", conn)
+	require.Equal(t, 1, h.Count("room-a"))
+
+	h.Unregister(client)
+	waitDone(t, client)
+	assert.Equal(t, 0, h.Count("room-a"))
+	assert.Eventually(t, conn.isClosed, time.Second, 10*time.Millisecond)
+
+	// 解除済みのクライアントへの操作は無視される
+	h.Unregister(client)
+	h.Send(client, []byte("ignored"))
+	conn.assertNoMessage(t)
+}
+
+func TestHub_DropSlowConsumer(t *testing.T) {
+	h := newRunningHub(t, WithSendBuffer(1))
+	slow := newFakeConn()
+	slow.block = make(chan struct{})
+	defer close(slow.block)
+	fast := newFakeConn()
+	slowClient := h.Register("room-a", slow)
+	fastClient := h.Register("room-a", fast)
+
+	// 1件目は書き込み中で止まり、2件目でキューが埋まり、3件目であふれる
+	for i := 0; i < 3; i++ {
+		h.Broadcast("room-a", []byte(fmt.Sprintf("message-%d", i)))
+		assert.Equal(t, fmt.Sprintf("message-%d", i), fast.next(t))
+	}
+
+	waitDone(t, slowClient)
+	assert.Equal(t, 1, h.Count("room-a"))
+	select {
+	case <-fastClient.Done():
+		t.Fatal("fast client must not be dropped")
+	default:
+	}
+}
+
+func TestHub_WriteErrorUnregisters(t *testing.T) {
+	h := newRunningHub(t)
+	conn := newFakeConn()
+	conn.err = errors.New("broken pipe")
+	client := h.Register("room-a", conn)
+
+	h.Broadcast("room-a", []byte("hello"))
+	waitDone(t, client)
+	assert.Equal(t, 0, h.Count("room-a"))
+	assert.Eventually(t, conn.isClosed, time.Second, 10*time.Millisecond)
+}
+
+func TestHub_Stop(t *testing.T) {
+	h := New()
+	go h.Run()
+	conn := newFakeConn()
+	client := h.Register("room-a", conn)
+
+	h.Stop()
+	waitDone(t, client)
+	assert.Eventually(t, conn.isClosed, time.Second, 10*time.Millisecond)
+
+	// 停止後の呼び出しはブロックしない
+	h.Broadcast("room-a", []byte("ignored"))
+	assert.Equal(t, 0, h.Count("room-a"))
+	late := h.Register("room-a", newFakeConn())
+	waitDone(t, late)
+	h.Stop()
+}
+
+// go test -race で、登録・解除・配信を並行に行ってもデータ競合がないことを確認する
+func TestHub_Concurrent(t *testing.T) {
+	h := newRunningHub(t, WithSendBuffer(256))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			room := fmt.Sprintf("room-%d", i%4)
+			client := h.Register(room, newFakeConn())
+			for j := 0; j < 20; j++ {
+				h.Broadcast(room, []byte("hello"))
+				h.Send(client, []byte("direct"))
+				h.Count(room)
+			}
+			h.Unregister(client)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, 0, h.Count(fmt.Sprintf("room-%d", i)))
+	}
+}
+
+func publishText(h *Hub, room string, text string) {
+	h.Publish(room, func(seq uint64) []byte {
+		return []byte(fmt.Sprintf("%d:%s", seq, text))
+	})
+}
+
+func TestHub_Publish(t *testing.T) {
+	h := newRunningHub(t)
+	a, b := newFakeConn(), newFakeConn()
+	h.Register("room-a", a)
+	h.Register("room-b", b)
+
+	publishText(h, "room-a", "milk")
+	publishText(h, "room-a", "egg")
+	publishText(h, "room-b", "bread")
+
+	// 連番は部屋ごとに振られる
+	assert.Equal(t, "1:milk", a.next(t))
+	assert.Equal(t, "2:egg", a.next(t))
+	assert.Equal(t, "1:bread", b.next(t))
+	assert.Equal(t, uint64(2), h.Seq("room-a"))
+	assert.Equal(t, uint64(1), h.Seq("room-b"))
+	assert.Equal(t, uint64(0), h.Seq("room-c"))
+}
+
+func TestHub_RegisterSince(t *testing.T) {
+	h := newRunningHub(t, WithHistory(3), WithSendBuffer(2))
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		publishText(h, "room-a", text)
+	}
+
+	tests := []struct {
+		name     string
+		room     string
+		since    uint64
+		ok       bool
+		expected []string
+	}{
+		{name: "up to date", room: "room-a", since: 5, ok: true},
+		{name: "replay missed", room: "room-a", since: 3, ok: true, expected: []string{"4:d", "5:e"}},
+		{name: "history dropped", room: "room-a", since: 1, ok: false},
+		{name: "does not fit in send queue", room: "room-a", since: 2, ok: false},
+		{name: "seq from before restart", room: "room-a", since: 9, ok: false},
+		{name: "new room", room: "room-b", since: 0, ok: true},
+		{name: "unknown room with seq", room: "room-b", since: 1, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newFakeConn()
+			client, ok := h.RegisterSince(tt.room, conn, tt.since)
+			defer h.Unregister(client)
+			assert.Equal(t, tt.ok, ok)
+			for _, expected := range tt.expected {
+				assert.Equal(t, expected, conn.next(t))
+			}
+			conn.assertNoMessage(t)
+
+			// 取りこぼしを埋められなくても、以降の配信は届く
+			h.Broadcast(tt.room, []byte("live"))
+			assert.Equal(t, "live", conn.next(t))
+		})
+	}
+}
+
+func TestHub_SendSnapshot(t *testing.T) {
+	h := newRunningHub(t)
+	publishText(h, "room-a", "milk")
+	conn := newFakeConn()
+	client := h.Register("room-a", conn)
+
+	// 一覧の取得中に配信された変更は、一覧の後にもう一度届く
+	seq := h.Seq("room-a")
+	publishText(h, "room-a", "egg")
+	h.SendSnapshot(client, []byte("snapshot"), seq)
+
+	assert.Equal(t, "2:egg", conn.next(t))
+	assert.Equal(t, "snapshot", conn.next(t))
+	assert.Equal(t, "2:egg", conn.next(t))
+	conn.assertNoMessage(t)
+}
+
+func TestHub_HistoryTTL(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	h := newRunningHub(t, WithHistoryTTL(ttl))
+	conn := newFakeConn()
+	client := h.Register("room-a", conn)
+	publishText(h, "room-a", "milk")
+	assert.Equal(t, "1:milk", conn.next(t))
+	for _, text := range []string{"a", "b", "c"} {
+		publishText(h, "room-b", text)
+	}
+
+	// 接続のない部屋の履歴は捨てる。接続のある部屋の履歴は残す
+	assert.Eventually(t, func() bool { return h.Seq("room-b") == 0 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(2 * ttl)
+	assert.Equal(t, uint64(1), h.Seq("room-a"))
+
+	// 最後の接続が外れてから保持する時間が過ぎると捨てる
+	h.Unregister(client)
+	waitDone(t, client)
+	assert.Eventually(t, func() bool { return h.Seq("room-a") == 0 }, 2*time.Second, 10*time.Millisecond)
+
+	// 捨てた履歴の連番で再接続したクライアントは、取りこぼしを埋められない
+	stale, ok := h.RegisterSince("room-a", newFakeConn(), 1)
+	defer h.Unregister(stale)
+	assert.False(t, ok)
+
+	// 新しく作る履歴の連番は、捨てた履歴の続きから振る
+	publishText(h, "room-a", "egg")
+	assert.Equal(t, uint64(4), h.Seq("room-a"))
+	_, ok = h.RegisterSince("room-a", newFakeConn(), 1)
+	assert.False(t, ok)
+}
+
+func TestHub_Cursor(t *testing.T) {
+	before := newRunningHub(t)
+	for _, text := range []string{"a", "b", "c"} {
+		publishText(before, "room-a", text)
+	}
+	stale := before.Cursor(before.Seq("room-a"))
+	before.Stop()
+
+	// 再起動後の連番は1から振り直すため、古い位置の連番は今の履歴と対応しない
+	h := newRunningHub(t)
+	for _, text := range []string{"d", "e", "f", "g"} {
+		publishText(h, "room-a", text)
+	}
+
+	seq, current, err := h.ParseCursor(h.Cursor(2))
+	require.NoError(t, err)
+	assert.True(t, current)
+	assert.Equal(t, uint64(2), seq)
+
+	for _, cursor := range []string{stale, "3"} {
+		_, current, err := h.ParseCursor(cursor)
+		require.NoError(t, err, cursor)
+		assert.False(t, current, cursor)
+	}
+	for _, cursor := range []string{"", "-1", "abc", ":3", h.Cursor(2) + "x"} {
+		_, _, err := h.ParseCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
+
+func TestHub_Keepalive(t *testing.T) {
+	h := newRunningHub(t, WithKeepalive(10*time.Millisecond, time.Minute))
+	conn := newFakeConn()
+	client := h.Register("room-a", conn)
+
+	// 登録時に読み取り期限が設定され、pongが届くたびに延びる
+	registered := conn.getReadDeadline()
+	assert.WithinDuration(t, time.Now().Add(time.Minute), registered, time.Second)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-conn.pings:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for ping")
+		}
+	}
+	require.NoError(t, conn.pong())
+	assert.True(t, conn.getReadDeadline().After(registered))
+
+	client.Touch()
+	assert.Equal(t, 1, h.Count("room-a"))
+}
+
+func TestHub_PingErrorUnregisters(t *testing.T) {
+	h := newRunningHub(t, WithKeepalive(10*time.Millisecond, time.Minute))
+	conn := newFakeConn()
+	conn.err = errors.New("connection reset")
+	client := h.Register("room-a", conn)
+
+	waitDone(t, client)
+	assert.Equal(t, 0, h.Count("room-a"))
+	assert.Eventually(t, conn.isClosed, time.Second, 10*time.Millisecond)
+}
+
+func TestHub_IdleTimeout(t *testing.T) {
+	h := newRunningHub(t, WithKeepalive(10*time.Millisecond, time.Minute), WithIdleTimeout(100*time.Millisecond))
+	idle, active := newFakeConn(), newFakeConn()
+	idleClient := h.Register("room-a", idle)
+	activeClient := h.Register("room-b", active)
+
+	// メッセージをやり取りしている間は切断されない
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		activeClient.Touch()
+		time.Sleep(20 * time.Millisecond)
+	}
+	waitDone(t, idleClient)
+	assert.Eventually(t, idle.isClosed, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, h.Count("room-b"))
+}
+
+func TestHub_Stats(t *testing.T) {
+	h := newRunningHub(t)
+	assert.Equal(t, Stats{}, h.Stats())
+
+	h.Register("room-a", newFakeConn())
+	h.Register("room-a", newFakeConn())
+	client := h.Register("room-b", newFakeConn())
+	assert.Equal(t, Stats{Rooms: 2, Clients: 3}, h.Stats())
+
+	h.Unregister(client)
+	waitDone(t, client)
+	assert.Equal(t, Stats{Rooms: 1, Clients: 2}, h.Stats())
+}
+
+func TestHub_Presence(t *testing.T) {
+	h := newRunningHub(t, WithPresence(func(room string, viewer Viewer, joined bool) []byte {
+		if joined {
+			return []byte("join:" + viewer.ID)
+		}
+		return []byte("leave:" + viewer.ID)
+	}))
+	mom, momTablet, dad, anonymous, other := newFakeConn(), newFakeConn(), newFakeConn(), newFakeConn(), newFakeConn()
+
+	momClient := h.Register("room-a", mom, AsViewer(Viewer{ID: "mom", Name: "Mom"}))
+	assert.Equal(t, "join:mom", mom.next(t))
+	h.Register("room-b", other, AsViewer(Viewer{ID: "mom"}))
+	assert.Equal(t, "join:mom", other.next(t))
+	dadClient := h.Register("room-a", dad, AsViewer(Viewer{ID: "dad"}))
+	assert.Equal(t, "join:dad", mom.next(t))
+	assert.Equal(t, "join:dad", dad.next(t))
+
+	// 2台目の端末や、利用者を指定しない接続では通知しない
+	momTabletClient := h.Register("room-a", momTablet, AsViewer(Viewer{ID: "mom", Name: "Mom"}))
+	h.Register("room-a", anonymous)
+	mom.assertNoMessage(t)
+
+	assert.Equal(t, []Viewer{{ID: "dad"}, {ID: "mom", Name: "Mom"}}, h.Viewers("room-a"))
+	assert.Equal(t, []Viewer{}, h.Viewers("room-c"))
+
+	// 最後の接続が外れたときだけ退室を通知する
+	h.Unregister(momClient)
+	waitDone(t, momClient)
+	dad.assertNoMessage(t)
+	h.Unregister(momTabletClient)
+	assert.Equal(t, "leave:mom", dad.next(t))
+	assert.Equal(t, []Viewer{{ID: "dad"}}, h.Viewers("room-a"))
+	other.assertNoMessage(t)
+
+	// 書き込みに失敗して外れた場合も通知する
+	dad.setErr(errors.New("broken pipe"))
+	h.Broadcast("room-a", []byte("hello"))
+	waitDone(t, dadClient)
+	assert.Equal(t, []Viewer{}, h.Viewers("room-a"))
+	assert.Equal(t, "leave:mom", anonymous.next(t))
+	assert.Equal(t, "hello", anonymous.next(t))
+	assert.Equal(t, "leave:dad", anonymous.next(t))
+}
@@ -0,0 +1,99 @@
+package hub
+
+import "sort"
+
+// Viewer は、部屋に接続している利用者または端末
+type Viewer struct {
+	ID   string
+	Name string
+}
+
+// ClientOption は、Register・RegisterSinceの任意設定
+type ClientOption func(*Client)
+
+// AsViewer は、接続をviewerのものとして在室状況に数える。
+// 同じIDの接続が複数あっても1人として扱う。指定しない接続は数えない
+func AsViewer(viewer Viewer) ClientOption {
+	return func(c *Client) {
+		c.viewer = viewer
+	}
+}
+
+// WithPresence は、部屋に利用者が入ったとき（joined）と、最後の接続が外れたときに、
+// buildが生成したメッセージを部屋の全クライアントに送る。在室状況は履歴に残さない。
+// buildはHubのゴルーチンで呼ばれるため、ブロックしてはならない
+func WithPresence(build func(room string, viewer Viewer, joined bool) []byte) Option {
+	return func(h *Hub) {
+		h.presence = build
+	}
+}
+
+type viewersRequest struct {
+	room  string
+	reply chan []Viewer
+}
+
+// Viewers は、roomに接続している利用者をID順に返す
+func (h *Hub) Viewers(room string) []Viewer {
+	req := viewersRequest{room: room, reply: make(chan []Viewer, 1)}
+	select {
+	case h.viewers <- req:
+		return <-req.reply
+	case <-h.stopped:
+		return nil
+	}
+}
+
+func (h *Hub) roomViewers(room string) []Viewer {
+	seen := make(map[string]bool)
+	viewers := []Viewer{}
+	for client := range h.rooms[room] {
+		if client.viewer.ID == "" || seen[client.viewer.ID] {
+			continue
+		}
+		seen[client.viewer.ID] = true
+		viewers = append(viewers, client.viewer)
+	}
+	sort.Slice(viewers, func(i, j int) bool { return viewers[i].ID < viewers[j].ID })
+	return viewers
+}
+
+// connections は、roomにあるviewerIDの接続の数を返す
+func (h *Hub) connections(room string, viewerID string) int {
+	n := 0
+	for client := range h.rooms[room] {
+		if client.viewer.ID == viewerID {
+			n++
+		}
+	}
+	return n
+}
+
+// announceJoin は、登録したclientがその利用者の最初の接続なら入室を通知する
+func (h *Hub) announceJoin(client *Client) {
+	if h.presence == nil || client.viewer.ID == "" || h.connections(client.room, client.viewer.ID) > 1 {
+		return
+	}
+	h.announce(client.room, client.viewer, true)
+}
+
+// announceDepartures は、部屋から外れた接続のうち、その利用者の最後の接続だったものの退室を通知する。
+// 通知であふれたクライアントも外れるため、なくなるまで繰り返す
+func (h *Hub) announceDepartures() {
+	for len(h.departed) > 0 {
+		client := h.departed[0]
+		h.departed = h.departed[1:]
+		if h.presence == nil || h.connections(client.room, client.viewer.ID) > 0 {
+			continue
+		}
+		h.announce(client.room, client.viewer, false)
+	}
+	h.departed = nil
+}
+
+func (h *Hub) announce(room string, viewer Viewer, joined bool) {
+	data := h.presence(room, viewer, joined)
+	for client := range h.rooms[room] {
+		h.enqueue(client, data)
+	}
+}
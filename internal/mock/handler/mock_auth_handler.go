@@ -54,18 +54,46 @@ func (mr *MockAuthHandlerMockRecorder) Callback(c any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Callback", reflect.TypeOf((*MockAuthHandler)(nil).Callback), c)
 }
 
-// CheckAuth mocks base method.
-func (m *MockAuthHandler) CheckAuth(c echo.Context) error {
+// FetchMe mocks base method.
+func (m *MockAuthHandler) FetchMe(c echo.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CheckAuth", c)
+	ret := m.ctrl.Call(m, "FetchMe", c)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// CheckAuth indicates an expected call of CheckAuth.
-func (mr *MockAuthHandlerMockRecorder) CheckAuth(c any) *gomock.Call {
+// FetchMe indicates an expected call of FetchMe.
+func (mr *MockAuthHandlerMockRecorder) FetchMe(c any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAuth", reflect.TypeOf((*MockAuthHandler)(nil).CheckAuth), c)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchMe", reflect.TypeOf((*MockAuthHandler)(nil).FetchMe), c)
+}
+
+// IssueTicket mocks base method.
+func (m *MockAuthHandler) IssueTicket(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueTicket", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IssueTicket indicates an expected call of IssueTicket.
+func (mr *MockAuthHandlerMockRecorder) IssueTicket(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueTicket", reflect.TypeOf((*MockAuthHandler)(nil).IssueTicket), c)
+}
+
+// LinkTempUser mocks base method.
+func (m *MockAuthHandler) LinkTempUser(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkTempUser", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkTempUser indicates an expected call of LinkTempUser.
+func (mr *MockAuthHandlerMockRecorder) LinkTempUser(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkTempUser", reflect.TypeOf((*MockAuthHandler)(nil).LinkTempUser), c)
 }
 
 // Login mocks base method.
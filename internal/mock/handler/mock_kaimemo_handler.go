@@ -82,6 +82,34 @@ func (mr *MockKaimemoHandlerMockRecorder) FetchKaimemo(c any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemo", reflect.TypeOf((*MockKaimemoHandler)(nil).FetchKaimemo), c)
 }
 
+// FetchKaimemoPage mocks base method.
+func (m *MockKaimemoHandler) FetchKaimemoPage(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchKaimemoPage", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FetchKaimemoPage indicates an expected call of FetchKaimemoPage.
+func (mr *MockKaimemoHandlerMockRecorder) FetchKaimemoPage(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemoPage", reflect.TypeOf((*MockKaimemoHandler)(nil).FetchKaimemoPage), c)
+}
+
+// FetchKaimemoPresence mocks base method.
+func (m *MockKaimemoHandler) FetchKaimemoPresence(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchKaimemoPresence", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FetchKaimemoPresence indicates an expected call of FetchKaimemoPresence.
+func (mr *MockKaimemoHandlerMockRecorder) FetchKaimemoPresence(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemoPresence", reflect.TypeOf((*MockKaimemoHandler)(nil).FetchKaimemoPresence), c)
+}
+
 // FetchKaimemoSummaryRecord mocks base method.
 func (m *MockKaimemoHandler) FetchKaimemoSummaryRecord(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -96,6 +124,20 @@ func (mr *MockKaimemoHandlerMockRecorder) FetchKaimemoSummaryRecord(c any) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemoSummaryRecord", reflect.TypeOf((*MockKaimemoHandler)(nil).FetchKaimemoSummaryRecord), c)
 }
 
+// FetchWebsocketStats mocks base method.
+func (m *MockKaimemoHandler) FetchWebsocketStats(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchWebsocketStats", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FetchWebsocketStats indicates an expected call of FetchWebsocketStats.
+func (mr *MockKaimemoHandlerMockRecorder) FetchWebsocketStats(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchWebsocketStats", reflect.TypeOf((*MockKaimemoHandler)(nil).FetchWebsocketStats), c)
+}
+
 // RemoveKaimemo mocks base method.
 func (m *MockKaimemoHandler) RemoveKaimemo(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -124,6 +166,48 @@ func (mr *MockKaimemoHandlerMockRecorder) RemoveKaimemoAmount(c any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemoAmount", reflect.TypeOf((*MockKaimemoHandler)(nil).RemoveKaimemoAmount), c)
 }
 
+// StreamKaimemoEvents mocks base method.
+func (m *MockKaimemoHandler) StreamKaimemoEvents(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamKaimemoEvents", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamKaimemoEvents indicates an expected call of StreamKaimemoEvents.
+func (mr *MockKaimemoHandlerMockRecorder) StreamKaimemoEvents(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamKaimemoEvents", reflect.TypeOf((*MockKaimemoHandler)(nil).StreamKaimemoEvents), c)
+}
+
+// UpdateKaimemo mocks base method.
+func (m *MockKaimemoHandler) UpdateKaimemo(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKaimemo", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateKaimemo indicates an expected call of UpdateKaimemo.
+func (mr *MockKaimemoHandlerMockRecorder) UpdateKaimemo(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKaimemo", reflect.TypeOf((*MockKaimemoHandler)(nil).UpdateKaimemo), c)
+}
+
+// UpdateKaimemoAmount mocks base method.
+func (m *MockKaimemoHandler) UpdateKaimemoAmount(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKaimemoAmount", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateKaimemoAmount indicates an expected call of UpdateKaimemoAmount.
+func (mr *MockKaimemoHandlerMockRecorder) UpdateKaimemoAmount(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKaimemoAmount", reflect.TypeOf((*MockKaimemoHandler)(nil).UpdateKaimemoAmount), c)
+}
+
 // WebsocketTelegraph mocks base method.
 func (m *MockKaimemoHandler) WebsocketTelegraph(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,71 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: line_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=line_repository.go -destination=../mock/repository/mock_line_repository.go -package=mock
+//
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	reflect "reflect"
+	model "template-echo-notion-integration/internal/model"
+	repository "template-echo-notion-integration/internal/repository"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLineRepository is a mock of LineRepository interface.
+type MockLineRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLineRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockLineRepositoryMockRecorder is the mock recorder for MockLineRepository.
+type MockLineRepositoryMockRecorder struct {
+	mock *MockLineRepository
+}
+
+// NewMockLineRepository creates a new mock instance.
+func NewMockLineRepository(ctrl *gomock.Controller) *MockLineRepository {
+	mock := &MockLineRepository{ctrl: ctrl}
+	mock.recorder = &MockLineRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLineRepository) EXPECT() *MockLineRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetAuthCodeUrl mocks base method.
+func (m *MockLineRepository) GetAuthCodeUrl(loginState model.LoginState) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuthCodeUrl", loginState)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetAuthCodeUrl indicates an expected call of GetAuthCodeUrl.
+func (mr *MockLineRepositoryMockRecorder) GetAuthCodeUrl(loginState any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthCodeUrl", reflect.TypeOf((*MockLineRepository)(nil).GetAuthCodeUrl), loginState)
+}
+
+// GetUserInfo mocks base method.
+func (m *MockLineRepository) GetUserInfo(code string, loginState model.LoginState) (*repository.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserInfo", code, loginState)
+	ret0, _ := ret[0].(*repository.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserInfo indicates an expected call of GetUserInfo.
+func (mr *MockLineRepositoryMockRecorder) GetUserInfo(code, loginState any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserInfo", reflect.TypeOf((*MockLineRepository)(nil).GetUserInfo), code, loginState)
+}
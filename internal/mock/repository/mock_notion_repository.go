@@ -12,6 +12,7 @@ package mock
 import (
 	reflect "reflect"
 	model "template-echo-notion-integration/internal/model"
+	repository "template-echo-notion-integration/internal/repository"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -70,12 +71,28 @@ func (mr *MockKaimemoRepositoryMockRecorder) FetchKaimemoAmountRecords(userID an
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemoAmountRecords", reflect.TypeOf((*MockKaimemoRepository)(nil).FetchKaimemoAmountRecords), userID)
 }
 
+// FetchKaimemoPage mocks base method.
+func (m *MockKaimemoRepository) FetchKaimemoPage(userID, cursor string, limit int) (*model.KaimemoPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchKaimemoPage", userID, cursor, limit)
+	ret0, _ := ret[0].(*model.KaimemoPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchKaimemoPage indicates an expected call of FetchKaimemoPage.
+func (mr *MockKaimemoRepositoryMockRecorder) FetchKaimemoPage(userID, cursor, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemoPage", reflect.TypeOf((*MockKaimemoRepository)(nil).FetchKaimemoPage), userID, cursor, limit)
+}
+
 // InsertKaimemo mocks base method.
-func (m *MockKaimemoRepository) InsertKaimemo(req model.CreateKaimemoRequest) error {
+func (m *MockKaimemoRepository) InsertKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "InsertKaimemo", req)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*model.KaimemoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // InsertKaimemo indicates an expected call of InsertKaimemo.
@@ -98,18 +115,33 @@ func (mr *MockKaimemoRepositoryMockRecorder) InsertKaimemoAmount(req any) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertKaimemoAmount", reflect.TypeOf((*MockKaimemoRepository)(nil).InsertKaimemoAmount), req)
 }
 
+// ReassignUser mocks base method.
+func (m *MockKaimemoRepository) ReassignUser(fromUserID, toUserID string) (*repository.UserMigrationResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReassignUser", fromUserID, toUserID)
+	ret0, _ := ret[0].(*repository.UserMigrationResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReassignUser indicates an expected call of ReassignUser.
+func (mr *MockKaimemoRepositoryMockRecorder) ReassignUser(fromUserID, toUserID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReassignUser", reflect.TypeOf((*MockKaimemoRepository)(nil).ReassignUser), fromUserID, toUserID)
+}
+
 // RemoveKaimemo mocks base method.
-func (m *MockKaimemoRepository) RemoveKaimemo(id, userID string) error {
+func (m *MockKaimemoRepository) RemoveKaimemo(id, userID, ifMatch string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RemoveKaimemo", id, userID)
+	ret := m.ctrl.Call(m, "RemoveKaimemo", id, userID, ifMatch)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RemoveKaimemo indicates an expected call of RemoveKaimemo.
-func (mr *MockKaimemoRepositoryMockRecorder) RemoveKaimemo(id, userID any) *gomock.Call {
+func (mr *MockKaimemoRepositoryMockRecorder) RemoveKaimemo(id, userID, ifMatch any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemo", reflect.TypeOf((*MockKaimemoRepository)(nil).RemoveKaimemo), id, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemo", reflect.TypeOf((*MockKaimemoRepository)(nil).RemoveKaimemo), id, userID, ifMatch)
 }
 
 // RemoveKaimemoAmount mocks base method.
@@ -125,3 +157,33 @@ func (mr *MockKaimemoRepositoryMockRecorder) RemoveKaimemoAmount(id, userID any)
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemoAmount", reflect.TypeOf((*MockKaimemoRepository)(nil).RemoveKaimemoAmount), id, userID)
 }
+
+// UpdateKaimemo mocks base method.
+func (m *MockKaimemoRepository) UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKaimemo", id, req)
+	ret0, _ := ret[0].(*model.KaimemoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateKaimemo indicates an expected call of UpdateKaimemo.
+func (mr *MockKaimemoRepositoryMockRecorder) UpdateKaimemo(id, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKaimemo", reflect.TypeOf((*MockKaimemoRepository)(nil).UpdateKaimemo), id, req)
+}
+
+// UpdateKaimemoAmount mocks base method.
+func (m *MockKaimemoRepository) UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (*model.KaimemoAmountRecords, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKaimemoAmount", id, req)
+	ret0, _ := ret[0].(*model.KaimemoAmountRecords)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateKaimemoAmount indicates an expected call of UpdateKaimemoAmount.
+func (mr *MockKaimemoRepositoryMockRecorder) UpdateKaimemoAmount(id, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKaimemoAmount", reflect.TypeOf((*MockKaimemoRepository)(nil).UpdateKaimemoAmount), id, req)
+}
@@ -0,0 +1,86 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: user_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=user_repository.go -destination=../mock/repository/mock_user_repository.go -package=mock
+//
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	reflect "reflect"
+	model "template-echo-notion-integration/internal/model"
+	repository "template-echo-notion-integration/internal/repository"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockUserRepository is a mock of UserRepository interface.
+type MockUserRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockUserRepositoryMockRecorder is the mock recorder for MockUserRepository.
+type MockUserRepositoryMockRecorder struct {
+	mock *MockUserRepository
+}
+
+// NewMockUserRepository creates a new mock instance.
+func NewMockUserRepository(ctrl *gomock.Controller) *MockUserRepository {
+	mock := &MockUserRepository{ctrl: ctrl}
+	mock.recorder = &MockUserRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
+	return m.recorder
+}
+
+// FindUser mocks base method.
+func (m *MockUserRepository) FindUser(userID string) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUser", userID)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUser indicates an expected call of FindUser.
+func (mr *MockUserRepositoryMockRecorder) FindUser(userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUser", reflect.TypeOf((*MockUserRepository)(nil).FindUser), userID)
+}
+
+// LinkTempUserID mocks base method.
+func (m *MockUserRepository) LinkTempUserID(userID, tempUserID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkTempUserID", userID, tempUserID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkTempUserID indicates an expected call of LinkTempUserID.
+func (mr *MockUserRepositoryMockRecorder) LinkTempUserID(userID, tempUserID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkTempUserID", reflect.TypeOf((*MockUserRepository)(nil).LinkTempUserID), userID, tempUserID)
+}
+
+// UpsertUser mocks base method.
+func (m *MockUserRepository) UpsertUser(info repository.UserInfo) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertUser", info)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpsertUser indicates an expected call of UpsertUser.
+func (mr *MockUserRepositoryMockRecorder) UpsertUser(info any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertUser", reflect.TypeOf((*MockUserRepository)(nil).UpsertUser), info)
+}
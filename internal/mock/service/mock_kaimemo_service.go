@@ -41,11 +41,12 @@ func (m *MockKaimemoService) EXPECT() *MockKaimemoServiceMockRecorder {
 }
 
 // CreateKaimemo mocks base method.
-func (m *MockKaimemoService) CreateKaimemo(req model.CreateKaimemoRequest) error {
+func (m *MockKaimemoService) CreateKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CreateKaimemo", req)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*model.KaimemoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // CreateKaimemo indicates an expected call of CreateKaimemo.
@@ -83,6 +84,21 @@ func (mr *MockKaimemoServiceMockRecorder) FetchKaimemo(userID any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemo", reflect.TypeOf((*MockKaimemoService)(nil).FetchKaimemo), userID)
 }
 
+// FetchKaimemoPage mocks base method.
+func (m *MockKaimemoService) FetchKaimemoPage(userID, cursor string, limit int) (*model.KaimemoPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchKaimemoPage", userID, cursor, limit)
+	ret0, _ := ret[0].(*model.KaimemoPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchKaimemoPage indicates an expected call of FetchKaimemoPage.
+func (mr *MockKaimemoServiceMockRecorder) FetchKaimemoPage(userID, cursor, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchKaimemoPage", reflect.TypeOf((*MockKaimemoService)(nil).FetchKaimemoPage), userID, cursor, limit)
+}
+
 // FetchKaimemoSummaryRecord mocks base method.
 func (m *MockKaimemoService) FetchKaimemoSummaryRecord(userID string) (model.KaimemoSummaryResponse, error) {
 	m.ctrl.T.Helper()
@@ -99,17 +115,17 @@ func (mr *MockKaimemoServiceMockRecorder) FetchKaimemoSummaryRecord(userID any)
 }
 
 // RemoveKaimemo mocks base method.
-func (m *MockKaimemoService) RemoveKaimemo(id, userID string) error {
+func (m *MockKaimemoService) RemoveKaimemo(id, userID, ifMatch string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RemoveKaimemo", id, userID)
+	ret := m.ctrl.Call(m, "RemoveKaimemo", id, userID, ifMatch)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RemoveKaimemo indicates an expected call of RemoveKaimemo.
-func (mr *MockKaimemoServiceMockRecorder) RemoveKaimemo(id, userID any) *gomock.Call {
+func (mr *MockKaimemoServiceMockRecorder) RemoveKaimemo(id, userID, ifMatch any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemo", reflect.TypeOf((*MockKaimemoService)(nil).RemoveKaimemo), id, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemo", reflect.TypeOf((*MockKaimemoService)(nil).RemoveKaimemo), id, userID, ifMatch)
 }
 
 // RemoveKaimemoAmount mocks base method.
@@ -125,3 +141,33 @@ func (mr *MockKaimemoServiceMockRecorder) RemoveKaimemoAmount(id, userID any) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveKaimemoAmount", reflect.TypeOf((*MockKaimemoService)(nil).RemoveKaimemoAmount), id, userID)
 }
+
+// UpdateKaimemo mocks base method.
+func (m *MockKaimemoService) UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKaimemo", id, req)
+	ret0, _ := ret[0].(*model.KaimemoResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateKaimemo indicates an expected call of UpdateKaimemo.
+func (mr *MockKaimemoServiceMockRecorder) UpdateKaimemo(id, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKaimemo", reflect.TypeOf((*MockKaimemoService)(nil).UpdateKaimemo), id, req)
+}
+
+// UpdateKaimemoAmount mocks base method.
+func (m *MockKaimemoService) UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (model.KaimemoSummaryResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKaimemoAmount", id, req)
+	ret0, _ := ret[0].(model.KaimemoSummaryResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateKaimemoAmount indicates an expected call of UpdateKaimemoAmount.
+func (mr *MockKaimemoServiceMockRecorder) UpdateKaimemoAmount(id, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKaimemoAmount", reflect.TypeOf((*MockKaimemoService)(nil).UpdateKaimemoAmount), id, req)
+}
@@ -11,6 +11,7 @@ package mock
 
 import (
 	reflect "reflect"
+	model "template-echo-notion-integration/internal/model"
 
 	echo "github.com/labstack/echo/v4"
 	gomock "go.uber.org/mock/gomock"
@@ -41,12 +42,11 @@ func (m *MockLineAuthService) EXPECT() *MockLineAuthServiceMockRecorder {
 }
 
 // Callback mocks base method.
-func (m *MockLineAuthService) Callback(c echo.Context, code string) (string, error) {
+func (m *MockLineAuthService) Callback(c echo.Context, code string) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Callback", c, code)
-	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Callback indicates an expected call of Callback.
@@ -56,11 +56,12 @@ func (mr *MockLineAuthServiceMockRecorder) Callback(c, code any) *gomock.Call {
 }
 
 // CheckAuth mocks base method.
-func (m *MockLineAuthService) CheckAuth(c echo.Context) error {
+func (m *MockLineAuthService) CheckAuth(c echo.Context) (*model.User, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CheckAuth", c)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // CheckAuth indicates an expected call of CheckAuth.
@@ -69,6 +70,36 @@ func (mr *MockLineAuthServiceMockRecorder) CheckAuth(c any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAuth", reflect.TypeOf((*MockLineAuthService)(nil).CheckAuth), c)
 }
 
+// IssueTicket mocks base method.
+func (m *MockLineAuthService) IssueTicket(c echo.Context) (*model.TicketResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueTicket", c)
+	ret0, _ := ret[0].(*model.TicketResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueTicket indicates an expected call of IssueTicket.
+func (mr *MockLineAuthServiceMockRecorder) IssueTicket(c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueTicket", reflect.TypeOf((*MockLineAuthService)(nil).IssueTicket), c)
+}
+
+// LinkTempUser mocks base method.
+func (m *MockLineAuthService) LinkTempUser(c echo.Context, tempUserID string) (*model.LinkTempUserResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkTempUser", c, tempUserID)
+	ret0, _ := ret[0].(*model.LinkTempUserResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LinkTempUser indicates an expected call of LinkTempUser.
+func (mr *MockLineAuthServiceMockRecorder) LinkTempUser(c, tempUserID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkTempUser", reflect.TypeOf((*MockLineAuthService)(nil).LinkTempUser), c, tempUserID)
+}
+
 // Login mocks base method.
 func (m *MockLineAuthService) Login(c echo.Context) (string, error) {
 	m.ctrl.T.Helper()
@@ -85,9 +116,11 @@ func (mr *MockLineAuthServiceMockRecorder) Login(c any) *gomock.Call {
 }
 
 // Logout mocks base method.
-func (m *MockLineAuthService) Logout(c echo.Context) {
+func (m *MockLineAuthService) Logout(c echo.Context) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Logout", c)
+	ret := m.ctrl.Call(m, "Logout", c)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Logout indicates an expected call of Logout.
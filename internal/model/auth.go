@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// TicketResponse は、WebSocket・Server-Sent Eventsの接続に使う短命のチケット。
+// 接続先のクエリにticketとして指定する
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Session は、LINEログインで作るサーバー側のセッション。IDをクッキーに保存する
+type Session struct {
+	ID        string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// LoginState は、/line/loginで生成し、/line/callbackで検証して使い切る値。ログインのたびに作り直す
+type LoginState struct {
+	// State は、CSRF対策としてコールバックのstateと照合する
+	State string `json:"state"`
+	// Nonce は、IDトークンのnonceと照合する
+	Nonce string `json:"nonce"`
+	// CodeVerifier は、PKCEでトークンの取得時に送る。認可要求にはそのハッシュ（code_challenge）を送る
+	CodeVerifier string `json:"codeVerifier"`
+}
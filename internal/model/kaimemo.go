@@ -11,6 +11,27 @@ type KaimemoResponse struct {
 	Tag  string `json:"tag"`
 	Name string `json:"name"`
 	Done bool   `json:"done"`
+	// Version は、変更のたびに変わる値。更新・削除のIf-Matchに指定すると、
+	// その後に別の変更があった場合は競合になる
+	Version string `json:"version"`
+}
+
+// KaimemoPage は、カーソルページングされた買い物一覧
+type KaimemoPage struct {
+	Items      []KaimemoResponse `json:"items"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+	HasMore    bool              `json:"hasMore"`
+}
+
+// KaimemoViewer は、買い物一覧を開いている利用者。IDはログインした利用者のID、NameはLINEの表示名
+type KaimemoViewer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// KaimemoPresenceResponse は、買い物一覧を開いている利用者の一覧
+type KaimemoPresenceResponse struct {
+	Viewers []KaimemoViewer `json:"viewers"`
 }
 
 type CreateKaimemoRequest struct {
@@ -19,11 +40,14 @@ type CreateKaimemoRequest struct {
 	Name       string `json:"name"`
 }
 
-type TelegraphRequest struct {
-	MethodType string  `json:"methodType" validate:"required"` // 1 : 登録 2 : 削除	TempUserID *string `json:"tempUserID"`
-	ID         *string `json:"id"`
+// UpdateKaimemoRequest は、買い物の部分更新。nilの項目は変更しない
+type UpdateKaimemoRequest struct {
+	TempUserID string  `json:"tempUserID"`
 	Tag        *string `json:"tag"`
 	Name       *string `json:"name"`
+	Done       *bool   `json:"done"`
+	// IfMatch が空でなければ、現在のVersionと一致する場合だけ更新する。If-Matchヘッダーから設定する
+	IfMatch string `json:"-"`
 }
 
 type RemoveKaimemoRequest struct {
@@ -42,6 +66,14 @@ type CreateKaimemoAmountRequest struct {
 	Amount     int    `json:"amount"`
 }
 
+// UpdateKaimemoAmountRequest は、金額レコードの更新。すべての項目を置き換える
+type UpdateKaimemoAmountRequest struct {
+	TempUserID string `json:"tempUserID"`
+	Date       string `json:"date"`
+	Tag        string `json:"tag"`
+	Amount     int    `json:"amount"`
+}
+
 type RemoveKaimemoAmountRequest struct {
 	TempUserID string `json:"tempUserID"`
 }
@@ -0,0 +1,86 @@
+package model
+
+import "encoding/json"
+
+// TelegraphVersion は、WebSocketでやり取りするメッセージの形式のバージョン
+const TelegraphVersion = 1
+
+// TelegraphMessage のtype
+const (
+	// クライアントからの要求
+	TelegraphTypeCreate = "kaimemo.create"
+	TelegraphTypeUpdate = "kaimemo.update"
+	TelegraphTypeRemove = "kaimemo.remove"
+	// TelegraphTypeSync は、一覧全体の再送を要求する。kaimemo.listで応答する
+	TelegraphTypeSync = "kaimemo.sync"
+
+	// サーバーからの通知
+	// TelegraphTypeList は、一覧全体。接続時とkaimemo.syncの応答でだけ送る
+	TelegraphTypeList = "kaimemo.list"
+	// 項目単位の変更。クライアントは手元の一覧に反映する
+	TelegraphTypeAdded   = "kaimemo.added"
+	TelegraphTypeUpdated = "kaimemo.updated"
+	TelegraphTypeRemoved = "kaimemo.removed"
+	// 在室状況。payloadはKaimemoViewer。連番は付かず、再接続時にも送り直さない
+	TelegraphTypePresenceJoined = "presence.joined"
+	TelegraphTypePresenceLeft   = "presence.left"
+	TelegraphTypeAck            = "ack"
+	TelegraphTypeError          = "error"
+)
+
+// TelegraphError のcode
+const (
+	TelegraphErrorInvalidMessage     = "invalid_message"
+	TelegraphErrorUnsupportedVersion = "unsupported_version"
+	TelegraphErrorUnknownType        = "unknown_type"
+	TelegraphErrorInvalidPayload     = "invalid_payload"
+	TelegraphErrorNotFound           = "not_found"
+	TelegraphErrorForbidden          = "forbidden"
+	TelegraphErrorConflict           = "conflict"
+	TelegraphErrorInternal           = "internal"
+)
+
+// TelegraphMessage は、WebSocketでやり取りするメッセージの封筒。
+// 要求に付けたrequestIdは、対応するack/errorにそのまま返される。
+//
+// seqは、部屋ごとの変更通知の連番。kaimemo.listでは一覧に反映済みの連番を示す。
+// cursorは、seqにサーバーの起動ごとのIDを付けた再接続用の位置。
+// 再接続時に/kaimemo/ws?since=<cursor>を指定すると、それより後の変更通知が送り直される。
+// サーバーの再起動をまたいだcursorでは、一覧全体が送り直される
+type TelegraphMessage struct {
+	Version   int             `json:"version"`
+	Type      string          `json:"type"`
+	RequestID string          `json:"requestId,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	Cursor    string          `json:"cursor,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// TelegraphCreatePayload は、kaimemo.createのpayload
+type TelegraphCreatePayload struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+}
+
+// TelegraphUpdatePayload は、kaimemo.updateのpayload。nilの項目は変更しない。
+// versionを指定すると、その後に別の変更があった場合はconflictになる
+type TelegraphUpdatePayload struct {
+	ID      string  `json:"id"`
+	Name    *string `json:"name"`
+	Tag     *string `json:"tag"`
+	Done    *bool   `json:"done"`
+	Version string  `json:"version"`
+}
+
+// TelegraphRemovePayload は、kaimemo.removeとkaimemo.removedのpayload
+type TelegraphRemovePayload struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+}
+
+// TelegraphError は、errorのpayload。conflictの場合はcurrentに現在の状態が入る
+type TelegraphError struct {
+	Code    string           `json:"code"`
+	Message string           `json:"message"`
+	Current *KaimemoResponse `json:"current,omitempty"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// User は、LINEログインした利用者
+type User struct {
+	// ID は、LINEのユーザーID（IDトークンのsub）
+	ID          string `json:"userId"`
+	DisplayName string `json:"displayName"`
+	PictureURL  string `json:"pictureUrl"`
+	// LinkedTempUserIDs は、アカウントに連携したログイン前の端末のtempUserID
+	LinkedTempUserIDs []string  `json:"linkedTempUserIds"`
+	CreatedAt         time.Time `json:"createdAt"`
+	LastLoginAt       time.Time `json:"lastLoginAt"`
+}
+
+// LinkTempUserRequest は、ログイン前の端末のtempUserIDをアカウントに連携するリクエスト
+type LinkTempUserRequest struct {
+	TempUserID string `json:"tempUserID"`
+}
+
+// LinkTempUserResponse は、連携で利用者のIDへ付け替えた件数
+type LinkTempUserResponse struct {
+	TempUserID      string `json:"tempUserID"`
+	MigratedItems   int    `json:"migratedItems"`
+	MigratedAmounts int    `json:"migratedAmounts"`
+}
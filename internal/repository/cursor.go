@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidCursor は、クライアントから渡されたカーソルが不正な場合に返す
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor は、バックエンド固有のカーソルをクライアント向けの不透明な文字列に変換する
+func encodeCursor(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor は、encodeCursorで生成したカーソルを元に戻す。空文字は先頭を表す
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(raw), nil
+}
+
+// decodeOffsetCursor は、数値の位置を表すカーソルを取り出す
+func decodeOffsetCursor(cursor string) (int64, error) {
+	raw, err := decodeCursor(cursor)
+	if err != nil || raw == "" {
+		return 0, err
+	}
+	offset, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+func encodeOffsetCursor(offset int64) string {
+	return encodeCursor(strconv.FormatInt(offset, 10))
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"errors"
+	"template-echo-notion-integration/internal/model"
+)
+
+var (
+	// ErrNotFound は、指定したIDのレコードが存在しない（アーカイブ済みを含む）場合に返す
+	ErrNotFound = errors.New("record not found")
+	// ErrForbidden は、指定したIDのレコードが別のユーザーのものである場合に返す
+	ErrForbidden = errors.New("record belongs to another user")
+	// ErrConflict は、指定したバージョンの後に別の変更が行われていた場合に返す。
+	// 実際には現在の状態を持つ*ConflictErrorを返すため、errors.Isで判定する
+	ErrConflict = errors.New("record was modified by someone else")
+	// ErrInvalidUserKey は、ユーザーIDをNotionのセレクトの選択肢として保存できない（カンマを含む）場合に返す
+	ErrInvalidUserKey = errors.New("user ID cannot be stored as a Notion select option")
+)
+
+// ConflictError は、更新・削除の前提にしたバージョンが古かった場合のエラー
+type ConflictError struct {
+	// Current は、レコードの現在の状態
+	Current *model.KaimemoResponse
+}
+
+func (e *ConflictError) Error() string {
+	return ErrConflict.Error()
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
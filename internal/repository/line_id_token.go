@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// lineIssuer は、LINEのIDトークンのiss
+const lineIssuer = "https://access.line.me"
+
+// ErrInvalidIDToken は、IDトークンの署名・発行者・対象・期限・nonceのいずれかが正しくない場合のエラー
+var ErrInvalidIDToken = errors.New("id token is invalid")
+
+// IDTokenClaims は、検証済みのIDトークンの内容
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce   string `json:"nonce"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+// IDTokenVerifier は、openidスコープで受け取ったIDトークンを検証する
+type IDTokenVerifier interface {
+	Verify(rawIDToken string, nonce string) (*IDTokenClaims, error)
+}
+
+type lineIDTokenVerifier struct {
+	channelID     string
+	channelSecret string
+	keys          KeySet
+	now           func() time.Time
+}
+
+// NewLineIDTokenVerifier は、LINEのIDトークンを検証するIDTokenVerifierを生成する。
+// ES256の署名はkeysの公開鍵で、ウェブログインで使われるHS256の署名はチャネルシークレットで検証する
+func NewLineIDTokenVerifier(channelID string, channelSecret string, keys KeySet) IDTokenVerifier {
+	return &lineIDTokenVerifier{
+		channelID:     channelID,
+		channelSecret: channelSecret,
+		keys:          keys,
+		now:           time.Now,
+	}
+}
+
+// Verify implements IDTokenVerifier.
+func (l *lineIDTokenVerifier) Verify(rawIDToken string, nonce string) (*IDTokenClaims, error) {
+	var claims IDTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, l.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg(), jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(lineIssuer),
+		jwt.WithAudience(l.channelID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+		jwt.WithTimeFunc(l.now),
+	)
+	if err != nil {
+		log.Printf("failed to verify id token: %v", err)
+		return nil, ErrInvalidIDToken
+	}
+	// nonceを指定しない認可要求は送らないため、空のnonceも受け付けない
+	if claims.Subject == "" || nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrInvalidIDToken
+	}
+	return &claims, nil
+}
+
+// key は、IDトークンのalgとkidから検証に使う鍵を返す
+func (l *lineIDTokenVerifier) key(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if l.channelSecret == "" {
+			return nil, ErrUnknownKey
+		}
+		return []byte(l.channelSecret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	return l.keys.PublicKey(kid)
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"template-echo-notion-integration/internal/model"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// testJWKS は、keysをJWKSのJSONにする
+func testJWKS(t *testing.T, keys map[string]*ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		jwks.Keys = append(jwks.Keys, jwk{
+			Kid: kid,
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	return data
+}
+
+func newTestECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// signIDToken は、claimsをLINEのIDトークンとして署名する
+func signIDToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	require.NoError(t, err)
+	return raw
+}
+
+func validIDTokenClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":     "https://access.line.me",
+		"sub":     "U1234567890",
+		"aud":     "channel-id",
+		"exp":     now.Add(time.Hour).Unix(),
+		"iat":     now.Unix(),
+		"nonce":   "nonce-1",
+		"name":    "Taro",
+		"picture": "https://profile.line-scdn.net/taro",
+	}
+}
+
+func TestLineIDTokenVerifier(t *testing.T) {
+	now := time.Now()
+	key := newTestECKey(t)
+	otherKey := newTestECKey(t)
+	keys, err := ParseJWKS(testJWKS(t, map[string]*ecdsa.PrivateKey{"kid-1": key}))
+	require.NoError(t, err)
+	verifier := NewLineIDTokenVerifier("channel-id", "channel-secret", NewStaticKeySet(keys))
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validIDTokenClaims(now)
+		claims[name] = value
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr bool
+	}{
+		{name: "es256", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, validIDTokenClaims(now)), nonce: "nonce-1"},
+		{name: "hs256 with channel secret", token: signIDToken(t, jwt.SigningMethodHS256, "", []byte("channel-secret"), validIDTokenClaims(now)), nonce: "nonce-1"},
+		{name: "nonce mismatch", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, validIDTokenClaims(now)), nonce: "nonce-2", wantErr: true},
+		{name: "no nonce", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, with("nonce", "")), nonce: "", wantErr: true},
+		{name: "other audience", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, with("aud", "other-channel")), nonce: "nonce-1", wantErr: true},
+		{name: "other issuer", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, with("iss", "https://evil.example")), nonce: "nonce-1", wantErr: true},
+		{name: "expired", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, with("exp", now.Add(-time.Hour).Unix())), nonce: "nonce-1", wantErr: true},
+		{name: "no subject", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", key, with("sub", "")), nonce: "nonce-1", wantErr: true},
+		{name: "signed by other key", token: signIDToken(t, jwt.SigningMethodES256, "kid-1", otherKey, validIDTokenClaims(now)), nonce: "nonce-1", wantErr: true},
+		{name: "unknown kid", token: signIDToken(t, jwt.SigningMethodES256, "kid-2", otherKey, validIDTokenClaims(now)), nonce: "nonce-1", wantErr: true},
+		{name: "other channel secret", token: signIDToken(t, jwt.SigningMethodHS256, "", []byte("other-secret"), validIDTokenClaims(now)), nonce: "nonce-1", wantErr: true},
+		{name: "alg none", token: signIDToken(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validIDTokenClaims(now)), nonce: "nonce-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token, tt.nonce)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidIDToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "U1234567890", claims.Subject)
+			assert.Equal(t, "Taro", claims.Name)
+		})
+	}
+}
+
+func TestJWKSKeySet(t *testing.T) {
+	key := newTestECKey(t)
+	rotated := newTestECKey(t)
+	var requests atomic.Int32
+	var jwks atomic.Value
+	jwks.Store(testJWKS(t, map[string]*ecdsa.PrivateKey{"kid-1": key}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if data := jwks.Load().([]byte); data != nil {
+			w.Write(data)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	keySet := NewJWKSKeySet(server.URL, server.Client(), time.Hour).(*jwksKeySet)
+	keySet.now = func() time.Time { return now }
+	publicKey := func(kid string) (crypto.PublicKey, error) { return keySet.PublicKey(kid) }
+
+	// 期限内はキャッシュを使う
+	for i := 0; i < 3; i++ {
+		got, err := publicKey("kid-1")
+		require.NoError(t, err)
+		assert.True(t, key.PublicKey.Equal(got))
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	// 知らないkidでの取得し直しは、間隔を空ける
+	jwks.Store(testJWKS(t, map[string]*ecdsa.PrivateKey{"kid-1": key, "kid-2": rotated}))
+	_, err := publicKey("kid-2")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Equal(t, int32(1), requests.Load())
+	now = now.Add(2 * time.Minute)
+	got, err := publicKey("kid-2")
+	require.NoError(t, err)
+	assert.True(t, rotated.PublicKey.Equal(got))
+	assert.Equal(t, int32(2), requests.Load())
+
+	// 期限が切れて取得に失敗しても、キャッシュの鍵を使う
+	jwks.Store([]byte(nil))
+	now = now.Add(2 * time.Hour)
+	got, err = publicKey("kid-1")
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(got))
+	_, err = publicKey("kid-3")
+	assert.Error(t, err)
+}
+
+func TestLineRepository_GetUserInfo(t *testing.T) {
+	key := newTestECKey(t)
+	keys, err := ParseJWKS(testJWKS(t, map[string]*ecdsa.PrivateKey{"kid-1": key}))
+	require.NoError(t, err)
+	verifier := NewLineIDTokenVerifier("channel-id", "", NewStaticKeySet(keys))
+	loginState := model.LoginState{State: "state-1", Nonce: "nonce-1", CodeVerifier: oauth2.GenerateVerifier()}
+
+	newRepository := func(t *testing.T, idToken string) LineRepository {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !assert.NoError(t, r.ParseForm()) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			assert.Equal(t, "code-1", r.PostForm.Get("code"))
+			assert.Equal(t, loginState.CodeVerifier, r.PostForm.Get("code_verifier"))
+			w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+			w.Write([]byte(url.Values{"access_token": {"access"}, "token_type": {"Bearer"}, "id_token": {idToken}}.Encode()))
+		}))
+		t.Cleanup(server.Close)
+		return NewLineRepository(&oauth2.Config{
+			ClientID: "channel-id",
+			Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+		}, verifier)
+	}
+
+	// 利用者はIDトークンのsubで識別する
+	repo := newRepository(t, signIDToken(t, jwt.SigningMethodES256, "kid-1", key, validIDTokenClaims(time.Now())))
+	userInfo, err := repo.GetUserInfo("code-1", loginState)
+	require.NoError(t, err)
+	assert.Equal(t, &UserInfo{UserID: "U1234567890", DisplayName: "Taro", PictureURL: "https://profile.line-scdn.net/taro"}, userInfo)
+
+	// 他のログインのnonceを持つIDトークンは受け付けない
+	claims := validIDTokenClaims(time.Now())
+	claims["nonce"] = "nonce-2"
+	repo = newRepository(t, signIDToken(t, jwt.SigningMethodES256, "kid-1", key, claims))
+	_, err = repo.GetUserInfo("code-1", loginState)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+	repo = newRepository(t, "")
+	_, err = repo.GetUserInfo("code-1", loginState)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey は、IDトークンのkidに対応する公開鍵がない場合のエラー
+var ErrUnknownKey = errors.New("signing key not found")
+
+// KeySet は、IDトークンの署名を検証する公開鍵をkidから返す
+type KeySet interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
+// jwksKeySet は、JWKSを取得してttlの間キャッシュするKeySet。
+// 鍵の入れ替えに備え、知らないkidのときは期限内でも取得し直す。ただし取得はminRefreshに1回までにする
+type jwksKeySet struct {
+	url        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWKSKeySet は、urlのJWKSをttlの間キャッシュするKeySetを生成する
+func NewJWKSKeySet(url string, client *http.Client, ttl time.Duration) KeySet {
+	return &jwksKeySet{
+		url:        url,
+		client:     client,
+		ttl:        ttl,
+		minRefresh: time.Minute,
+		now:        time.Now,
+	}
+}
+
+// PublicKey implements KeySet.
+func (j *jwksKeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	key, ok := j.keys[kid]
+	fresh := j.keys != nil && now.Sub(j.fetchedAt) < j.ttl
+	if ok && fresh {
+		return key, nil
+	}
+	if !ok && fresh && now.Sub(j.fetchedAt) < j.minRefresh {
+		return nil, ErrUnknownKey
+	}
+
+	keys, err := j.fetch()
+	if err != nil {
+		// 取得に失敗しても、期限切れのキャッシュに鍵があればそれを使う
+		log.Printf("failed to fetch jwks: %v", err)
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	j.keys = keys
+	j.fetchedAt = now
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (j *jwksKeySet) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, j.url)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// staticKeySet は、固定の公開鍵を返すKeySet
+type staticKeySet map[string]crypto.PublicKey
+
+// NewStaticKeySet は、keysだけを使うKeySetを生成する。テストや、LINEに接続しないローカル開発で使う
+func NewStaticKeySet(keys map[string]crypto.PublicKey) KeySet {
+	return staticKeySet(keys)
+}
+
+// NewFileKeySet は、pathのJWKSファイルの公開鍵だけを使うKeySetを生成する
+func NewFileKeySet(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeySet(keys), nil
+}
+
+// PublicKey implements KeySet.
+func (s staticKeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	key, ok := s[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// jwk は、JWKSの鍵のうち、LINEが使うES256（EC）の検証に使う項目
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS は、JWKSのJSONをkidごとの公開鍵に変換する。対応していない種類の鍵は無視する
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "EC" {
+			continue
+		}
+		key, err := k.ecdsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse jwk %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+	}
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	// 曲線上にない点は拒否する
+	if _, err := key.ECDH(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
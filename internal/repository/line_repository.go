@@ -3,73 +3,67 @@ package repository
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"io"
+	"log"
+	"template-echo-notion-integration/internal/model"
 
 	"golang.org/x/oauth2"
 )
 
+// LineRepository は、LINEログインのOAuth2.0の通信を行う。
+// stateの照合はservice層が行い、ここではログインごとのstate・nonce・code_verifierをLINEに送るだけ
 type LineRepository interface {
-	GetUserInfo(code string) (*UserInfo, error)
-	MatchState(state string) bool
-	GetAuthCodeUrl() string
+	GetUserInfo(code string, loginState model.LoginState) (*UserInfo, error)
+	GetAuthCodeUrl(loginState model.LoginState) string
 }
 
 type lineRepository struct {
 	lineConfig *oauth2.Config
-	state      string
+	verifier   IDTokenVerifier
 }
 
-func NewLineRepository(lineConfig *oauth2.Config) LineRepository {
+// NewLineRepository は、トークンと一緒に受け取るIDトークンをverifierで検証する
+func NewLineRepository(lineConfig *oauth2.Config, verifier IDTokenVerifier) LineRepository {
 	return &lineRepository{
 		lineConfig: lineConfig,
-		state:      generateState(),
+		verifier:   verifier,
 	}
 }
 
 // GetUserInfo implements LineRepository.
-func (l *lineRepository) GetUserInfo(code string) (*UserInfo, error) {
+// PKCEのcode_verifierを送り、認可要求を送ったクライアント以外が認可コードを使えないようにする。
+// 利用者は、検証したIDトークンのsubで識別する
+func (l *lineRepository) GetUserInfo(code string, loginState model.LoginState) (*UserInfo, error) {
 	// Call OAuth2.0 Token Endpoint
-	token, err := l.lineConfig.Exchange(oauth2.NoContext, code)
+	token, err := l.lineConfig.Exchange(context.Background(), code, oauth2.VerifierOption(loginState.CodeVerifier))
 	if err != nil {
+		log.Printf("failed to exchange line token: %v", err)
 		return nil, errors.New("Token Exchange Failed")
 	}
 
-	// Call User Profile Endpoint
-	client := l.lineConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://api.line.me/v2/profile")
-	if err != nil {
-		return nil, errors.New("Failed to get user info")
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrInvalidIDToken
 	}
-	defer resp.Body.Close()
-
-	data, err := io.ReadAll(resp.Body)
+	claims, err := l.verifier.Verify(rawIDToken, loginState.Nonce)
 	if err != nil {
-		return nil, errors.New("Failed to read user info")
+		return nil, err
 	}
 
-	var userInfo UserInfo
-	if err := json.Unmarshal(data, &userInfo); err != nil {
-		return nil, errors.New("Failed to parse user info")
-	}
-
-	return &userInfo, nil
-}
-
-// MatchState implements LineRepository.
-func (l *lineRepository) MatchState(state string) bool {
-	if state != l.state {
-		return false
-	}
-	return true
+	return &UserInfo{
+		UserID:      claims.Subject,
+		DisplayName: claims.Name,
+		PictureURL:  claims.Picture,
+	}, nil
 }
 
 // GetAuthCode implements LineRepository.
-func (l *lineRepository) GetAuthCodeUrl() string {
-	url := l.lineConfig.AuthCodeURL(l.state)
+func (l *lineRepository) GetAuthCodeUrl(loginState model.LoginState) string {
+	url := l.lineConfig.AuthCodeURL(
+		loginState.State,
+		oauth2.S256ChallengeOption(loginState.CodeVerifier),
+		oauth2.SetAuthURLParam("nonce", loginState.Nonce),
+	)
 	return url
 }
 
@@ -79,12 +73,3 @@ type UserInfo struct {
 	DisplayName string `json:"displayName"`
 	PictureURL  string `json:"pictureUrl"`
 }
-
-func generateState() string {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return ""
-	}
-	// base64 Encoding
-	return base64.URLEncoding.EncodeToString(b)
-}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"net/url"
+	"template-echo-notion-integration/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestLineRepository_GetAuthCodeUrl(t *testing.T) {
+	repo := NewLineRepository(&oauth2.Config{
+		ClientID:    "client-id",
+		RedirectURL: "https://example.com/line/callback",
+		Scopes:      []string{"profile", "openid"},
+		Endpoint:    oauth2.Endpoint{AuthURL: "https://access.line.me/oauth2/v2.1/authorize"},
+	}, NewLineIDTokenVerifier("client-id", "", NewStaticKeySet(nil)))
+	verifier := oauth2.GenerateVerifier()
+
+	res, err := url.Parse(repo.GetAuthCodeUrl(model.LoginState{State: "state-1", Nonce: "nonce-1", CodeVerifier: verifier}))
+	require.NoError(t, err)
+	query := res.Query()
+	assert.Equal(t, "state-1", query.Get("state"))
+	assert.Equal(t, "nonce-1", query.Get("nonce"))
+	// code_verifierそのものは送らない
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, oauth2.S256ChallengeFromVerifier(verifier), query.Get("code_challenge"))
+	assert.NotContains(t, res.String(), verifier)
+}
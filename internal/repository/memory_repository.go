@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"template-echo-notion-integration/internal/model"
+)
+
+type memoryKaimemo struct {
+	userID   string
+	archived bool
+	version  int
+	item     model.KaimemoResponse
+}
+
+// bump は、変更のたびにバージョンを進める
+func (k *memoryKaimemo) bump() {
+	k.version++
+	k.item.Version = strconv.Itoa(k.version)
+}
+
+// checkVersion は、ifMatchが空でなく現在のバージョンと異なる場合に*ConflictErrorを返す
+func (k *memoryKaimemo) checkVersion(ifMatch string) error {
+	if ifMatch == "" || ifMatch == k.item.Version {
+		return nil
+	}
+	current := k.item
+	return &ConflictError{Current: &current}
+}
+
+type memoryKaimemoAmount struct {
+	userID   string
+	archived bool
+	record   model.KaimemoAmount
+}
+
+// memoryRepository は、ローカル開発・結合テスト用のインメモリ実装
+type memoryRepository struct {
+	mu       sync.RWMutex
+	seq      int
+	kaimemos []*memoryKaimemo
+	amounts  []*memoryKaimemoAmount
+}
+
+// FetchKaimemoAmountRecords implements KaimemoRepository.
+func (m *memoryRepository) FetchKaimemoAmountRecords(userID string) (*model.KaimemoAmountRecords, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.amountRecords(userID), nil
+}
+
+// amountRecords は、userIDの金額レコードを返す。呼び出し側でロックを取得しておく
+func (m *memoryRepository) amountRecords(userID string) *model.KaimemoAmountRecords {
+	var kaimemoAmounts []model.KaimemoAmount
+	for _, amount := range m.amounts {
+		if amount.archived || amount.userID != userID {
+			continue
+		}
+		kaimemoAmounts = append(kaimemoAmounts, amount.record)
+	}
+
+	return &model.KaimemoAmountRecords{
+		Records: kaimemoAmounts,
+	}
+}
+
+// InsertKaimemoAmount implements KaimemoRepository.
+func (m *memoryRepository) InsertKaimemoAmount(req model.CreateKaimemoAmountRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.amounts = append(m.amounts, &memoryKaimemoAmount{
+		userID: req.TempUserID,
+		record: model.KaimemoAmount{
+			ID:     m.nextID(),
+			Date:   req.Date,
+			Tag:    req.Tag,
+			Amount: req.Amount,
+		},
+	})
+	return nil
+}
+
+// UpdateKaimemoAmount implements KaimemoRepository.
+func (m *memoryRepository) UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (*model.KaimemoAmountRecords, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, amount := range m.amounts {
+		if amount.archived || amount.record.ID != id {
+			continue
+		}
+		if amount.userID != req.TempUserID {
+			return nil, ErrForbidden
+		}
+		amount.record.Date = req.Date
+		amount.record.Tag = req.Tag
+		amount.record.Amount = req.Amount
+		return m.amountRecords(req.TempUserID), nil
+	}
+	return nil, ErrNotFound
+}
+
+// RemoveKaimemoAmount implements KaimemoRepository.
+func (m *memoryRepository) RemoveKaimemoAmount(id string, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, amount := range m.amounts {
+		if amount.archived || amount.record.ID != id {
+			continue
+		}
+		if amount.userID != userID {
+			return ErrForbidden
+		}
+		amount.archived = true
+		return nil
+	}
+	return ErrNotFound
+}
+
+// FetchKaimemo implements KaimemoRepository.
+func (m *memoryRepository) FetchKaimemo(userID string) ([]model.KaimemoResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var kaimemoResponses []model.KaimemoResponse
+	for _, kaimemo := range m.kaimemos {
+		if kaimemo.archived || kaimemo.userID != userID {
+			continue
+		}
+		kaimemoResponses = append(kaimemoResponses, kaimemo.item)
+	}
+
+	return kaimemoResponses, nil
+}
+
+// FetchKaimemoPage implements KaimemoRepository.
+func (m *memoryRepository) FetchKaimemoPage(userID string, cursor string, limit int) (*model.KaimemoPage, error) {
+	start, err := decodeOffsetCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// カーソルはm.kaimemos上の位置。追記のみのため、アーカイブされてもずれない
+	page := &model.KaimemoPage{Items: []model.KaimemoResponse{}}
+	for i := int(start); i < len(m.kaimemos); i++ {
+		kaimemo := m.kaimemos[i]
+		if kaimemo.archived || kaimemo.userID != userID {
+			continue
+		}
+		if len(page.Items) == limit {
+			page.HasMore = true
+			page.NextCursor = encodeOffsetCursor(int64(i))
+			break
+		}
+		page.Items = append(page.Items, kaimemo.item)
+	}
+
+	return page, nil
+}
+
+// InsertKaimemo implements KaimemoRepository.
+func (m *memoryRepository) InsertKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kaimemo := &memoryKaimemo{
+		userID: req.TempUserID,
+		item: model.KaimemoResponse{
+			ID:   m.nextID(),
+			Tag:  req.Tag,
+			Name: req.Name,
+		},
+	}
+	kaimemo.bump()
+	m.kaimemos = append(m.kaimemos, kaimemo)
+
+	item := kaimemo.item
+	return &item, nil
+}
+
+// UpdateKaimemo implements KaimemoRepository.
+func (m *memoryRepository) UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, kaimemo := range m.kaimemos {
+		if kaimemo.archived || kaimemo.item.ID != id {
+			continue
+		}
+		if kaimemo.userID != req.TempUserID {
+			return nil, ErrForbidden
+		}
+		if err := kaimemo.checkVersion(req.IfMatch); err != nil {
+			return nil, err
+		}
+		if req.Name != nil {
+			kaimemo.item.Name = *req.Name
+		}
+		if req.Tag != nil {
+			kaimemo.item.Tag = *req.Tag
+		}
+		if req.Done != nil {
+			kaimemo.item.Done = *req.Done
+		}
+		kaimemo.bump()
+		item := kaimemo.item
+		return &item, nil
+	}
+	return nil, ErrNotFound
+}
+
+// RemoveKaimemo implements KaimemoRepository.
+func (m *memoryRepository) RemoveKaimemo(id string, userID string, ifMatch string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, kaimemo := range m.kaimemos {
+		if kaimemo.archived || kaimemo.item.ID != id {
+			continue
+		}
+		if kaimemo.userID != userID {
+			return ErrForbidden
+		}
+		if err := kaimemo.checkVersion(ifMatch); err != nil {
+			return err
+		}
+		kaimemo.archived = true
+		return nil
+	}
+	return ErrNotFound
+}
+
+// ReassignUser implements KaimemoRepository.
+func (m *memoryRepository) ReassignUser(fromUserID string, toUserID string) (*UserMigrationResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &UserMigrationResult{}
+	for _, kaimemo := range m.kaimemos {
+		if kaimemo.archived || kaimemo.userID != fromUserID {
+			continue
+		}
+		kaimemo.userID = toUserID
+		result.Items++
+	}
+	for _, amount := range m.amounts {
+		if amount.archived || amount.userID != fromUserID {
+			continue
+		}
+		amount.userID = toUserID
+		result.Amounts++
+	}
+	return result, nil
+}
+
+// nextID は、連番のIDを払い出す。呼び出し側でロックを取得していること
+func (m *memoryRepository) nextID() string {
+	m.seq++
+	return fmt.Sprintf("memory-%d", m.seq)
+}
+
+// NewMemoryRepository は、プロセス内でデータを保持するKaimemoRepositoryを生成する
+func NewMemoryRepository() KaimemoRepository {
+	return &memoryRepository{}
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"template-echo-notion-integration/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepository_Kaimemo(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "milk"})
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "daily", Name: "soap"})
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-2", Tag: "food", Name: "egg"})
+
+	res, err := repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{
+		{ID: "memory-1", Tag: "food", Name: "milk", Version: "1"},
+		{ID: "memory-2", Tag: "daily", Name: "soap", Version: "1"},
+	}, res)
+
+	// 他のユーザーのIDではアーカイブされない
+	assert.ErrorIs(t, repo.RemoveKaimemo("memory-1", "user-2", ""), ErrForbidden)
+	res, err = repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+
+	assert.NoError(t, repo.RemoveKaimemo("memory-1", "user-1", ""))
+	assert.ErrorIs(t, repo.RemoveKaimemo("memory-1", "user-1", ""), ErrNotFound)
+	assert.ErrorIs(t, repo.RemoveKaimemo("unknown", "user-1", ""), ErrNotFound)
+	res, err = repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{{ID: "memory-2", Tag: "daily", Name: "soap", Version: "1"}}, res)
+
+	// アーカイブしてもIDは再利用されない
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "bread"})
+	res, err = repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "memory-4", res[1].ID)
+}
+
+func TestMemoryRepository_KaimemoAmount(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	assert.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-15", Tag: "food", Amount: 1000}))
+	assert.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-2", Date: "2023-05-16", Tag: "food", Amount: 3000}))
+
+	res, err := repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoAmount{{ID: "memory-1", Date: "2023-05-15", Tag: "food", Amount: 1000}}, res.Records)
+
+	assert.ErrorIs(t, repo.RemoveKaimemoAmount("memory-1", "user-2"), ErrForbidden)
+	assert.NoError(t, repo.RemoveKaimemoAmount("memory-1", "user-1"))
+	assert.ErrorIs(t, repo.RemoveKaimemoAmount("memory-1", "user-1"), ErrNotFound)
+	res, err = repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	assert.Empty(t, res.Records)
+}
+
+func TestMemoryRepository_Concurrent(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user-%d", i%2)
+			insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: userID, Name: "item"})
+			_, err := repo.FetchKaimemo(userID)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	res, err := repo.FetchKaimemo("user-0")
+	require.NoError(t, err)
+	assert.Len(t, res, 10)
+}
+
+// testFetchKaimemoPage は、バックエンド共通のページング動作を検証する
+func testFetchKaimemoPage(t *testing.T, repo KaimemoRepository) {
+	t.Helper()
+
+	for i := 0; i < 5; i++ {
+		insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Name: fmt.Sprintf("item-%d", i)})
+		insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-2", Name: "other"})
+	}
+
+	var names []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		page, err := repo.FetchKaimemoPage("user-1", cursor, 2)
+		require.NoError(t, err)
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		if !page.HasMore {
+			assert.Empty(t, page.NextCursor)
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"item-0", "item-1", "item-2", "item-3", "item-4"}, names)
+
+	_, err := repo.FetchKaimemoPage("user-1", "not-a-cursor", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestMemoryRepository_FetchKaimemoPage(t *testing.T) {
+	testFetchKaimemoPage(t, NewMemoryRepository())
+}
+
+func TestMemoryRepository_UpdateKaimemo(t *testing.T) {
+	testUpdateKaimemo(t, NewMemoryRepository())
+}
+
+// testUpdateKaimemo は、UpdateKaimemoの振る舞いを実装ごとに検証する
+func testUpdateKaimemo(t *testing.T, repo KaimemoRepository) {
+	t.Helper()
+
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "milk"})
+	items, err := repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	id := items[0].ID
+
+	done := true
+	res, err := repo.UpdateKaimemo(id, model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done})
+	require.NoError(t, err)
+	assert.Equal(t, &model.KaimemoResponse{ID: id, Tag: "food", Name: "milk", Done: true, Version: "2"}, res)
+
+	// 指定しない項目は変更されない
+	name, tag := "oat milk", "drink"
+	res, err = repo.UpdateKaimemo(id, model.UpdateKaimemoRequest{TempUserID: "user-1", Name: &name, Tag: &tag})
+	require.NoError(t, err)
+	assert.Equal(t, &model.KaimemoResponse{ID: id, Tag: "drink", Name: "oat milk", Done: true, Version: "3"}, res)
+
+	items, err = repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{*res}, items)
+
+	_, err = repo.UpdateKaimemo(id, model.UpdateKaimemoRequest{TempUserID: "user-2", Done: &done})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = repo.UpdateKaimemo("unknown", model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, repo.RemoveKaimemo(id, "user-1", ""))
+	_, err = repo.UpdateKaimemo(id, model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryRepository_KaimemoVersion(t *testing.T) {
+	testKaimemoVersion(t, NewMemoryRepository())
+}
+
+// testKaimemoVersion は、バージョンを指定した更新・削除の振る舞いを実装ごとに検証する
+func testKaimemoVersion(t *testing.T, repo KaimemoRepository) {
+	t.Helper()
+
+	created := insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "milk"})
+	require.NotEmpty(t, created.Version)
+
+	done := true
+	updated, err := repo.UpdateKaimemo(created.ID, model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done, IfMatch: created.Version})
+	require.NoError(t, err)
+	assert.NotEqual(t, created.Version, updated.Version)
+
+	// 古いバージョンでの更新・削除は、現在の状態とともに競合になる
+	name := "oat milk"
+	_, err = repo.UpdateKaimemo(created.ID, model.UpdateKaimemoRequest{TempUserID: "user-1", Name: &name, IfMatch: created.Version})
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Equal(t, updated, conflict.Current)
+
+	err = repo.RemoveKaimemo(created.ID, "user-1", created.Version)
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, updated, conflict.Current)
+
+	items, err := repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{*updated}, items)
+
+	// 所有者の確認は、バージョンより先に行う
+	_, err = repo.UpdateKaimemo(created.ID, model.UpdateKaimemoRequest{TempUserID: "user-2", Name: &name, IfMatch: created.Version})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	require.NoError(t, repo.RemoveKaimemo(created.ID, "user-1", updated.Version))
+	assert.ErrorIs(t, repo.RemoveKaimemo(created.ID, "user-1", updated.Version), ErrNotFound)
+}
+
+func TestMemoryRepository_UpdateKaimemoAmount(t *testing.T) {
+	testUpdateKaimemoAmount(t, NewMemoryRepository())
+}
+
+// testUpdateKaimemoAmount は、UpdateKaimemoAmountの振る舞いを実装ごとに検証する
+func testUpdateKaimemoAmount(t *testing.T, repo KaimemoRepository) {
+	t.Helper()
+
+	require.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-15", Tag: "food", Amount: 1000}))
+	require.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-15", Tag: "daily", Amount: 500}))
+	require.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-2", Date: "2023-05-15", Tag: "food", Amount: 300}))
+	res, err := repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	id, other := res.Records[0].ID, res.Records[1]
+
+	// 更新後の利用者の金額レコードを返す
+	res, err = repo.UpdateKaimemoAmount(id, model.UpdateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "daily", Amount: 100})
+	require.NoError(t, err)
+	expected := []model.KaimemoAmount{{ID: id, Date: "2023-05-16", Tag: "daily", Amount: 100}, other}
+	assert.Equal(t, expected, res.Records)
+	res, err = repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, expected, res.Records)
+
+	_, err = repo.UpdateKaimemoAmount(id, model.UpdateKaimemoAmountRequest{TempUserID: "user-2", Date: "2023-05-16", Tag: "food", Amount: 1})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = repo.UpdateKaimemoAmount("unknown", model.UpdateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "food", Amount: 1})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, repo.RemoveKaimemoAmount(id, "user-1"))
+	_, err = repo.UpdateKaimemoAmount(id, model.UpdateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "food", Amount: 1})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// insertKaimemo は、買い物を登録し、登録された内容を返す
+func insertKaimemo(t *testing.T, repo KaimemoRepository, req model.CreateKaimemoRequest) *model.KaimemoResponse {
+	t.Helper()
+
+	res, err := repo.InsertKaimemo(req)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.ID)
+	assert.Equal(t, req.Name, res.Name)
+	assert.Equal(t, req.Tag, res.Tag)
+	assert.False(t, res.Done)
+	return res
+}
+
+func TestMemoryRepository_ReassignUser(t *testing.T) {
+	testReassignUser(t, NewMemoryRepository())
+}
+
+// testReassignUser は、ReassignUserの振る舞いを実装ごとに検証する
+func testReassignUser(t *testing.T, repo KaimemoRepository) {
+	t.Helper()
+
+	milk := insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "temp-1", Tag: "food", Name: "milk"})
+	removed := insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "temp-1", Tag: "food", Name: "egg"})
+	require.NoError(t, repo.RemoveKaimemo(removed.ID, "temp-1", ""))
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "line-user-1", Tag: "daily", Name: "soap"})
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "temp-2", Tag: "food", Name: "bread"})
+	require.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "temp-1", Date: "2023-05-15", Tag: "food", Amount: 1000}))
+	require.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "temp-1", Date: "2023-05-16", Tag: "food", Amount: 500}))
+
+	result, err := repo.ReassignUser("temp-1", "line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &UserMigrationResult{Items: 1, Amounts: 2}, result)
+
+	items, err := repo.FetchKaimemo("line-user-1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"milk", "soap"}, []string{items[0].Name, items[1].Name})
+	amounts, err := repo.FetchKaimemoAmountRecords("line-user-1")
+	require.NoError(t, err)
+	assert.Len(t, amounts.Records, 2)
+
+	items, err = repo.FetchKaimemo("temp-1")
+	require.NoError(t, err)
+	assert.Empty(t, items)
+	items, err = repo.FetchKaimemo("temp-2")
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	// 付け替えた後は新しいIDで更新でき、元のIDでは操作できない
+	done := true
+	_, err = repo.UpdateKaimemo(milk.ID, model.UpdateKaimemoRequest{TempUserID: "line-user-1", Done: &done})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, repo.RemoveKaimemo(milk.ID, "temp-1", ""), ErrForbidden)
+
+	// 再実行しても付け替えるものはない
+	result, err = repo.ReassignUser("temp-1", "line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &UserMigrationResult{}, result)
+}
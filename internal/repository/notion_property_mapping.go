@@ -0,0 +1,104 @@
+package repository
+
+// NotionPropertyMapping は、リポジトリが読み書きするNotionのプロパティ名。
+// 既存のデータベースの列名（日本語も可）に合わせて変更できる
+type NotionPropertyMapping struct {
+	Input   NotionInputProperties
+	Summary NotionSummaryProperties
+	Users   NotionUserProperties
+}
+
+// NotionInputProperties は、買い物メモのデータベースのプロパティ名
+type NotionInputProperties struct {
+	TempUserID string
+	UserKey    string
+	Name       string
+	Tag        string
+	Done       string
+}
+
+// NotionSummaryProperties は、買い物集計のデータベースのプロパティ名
+type NotionSummaryProperties struct {
+	TempUserID string
+	UserKey    string
+	Date       string
+	Tag        string
+	Amount     string
+}
+
+// NotionUserProperties は、利用者のデータベースのプロパティ名
+type NotionUserProperties struct {
+	Name              string
+	UserID            string
+	PictureURL        string
+	LinkedTempUserIDs string
+	LastLoginAt       string
+}
+
+// DefaultNotionPropertyMapping は、テンプレートのデータベースのプロパティ名を返す
+func DefaultNotionPropertyMapping() NotionPropertyMapping {
+	return NotionPropertyMapping{
+		Input: NotionInputProperties{
+			TempUserID: "tempUserID",
+			UserKey:    "userKey",
+			Name:       "name",
+			Tag:        "tag",
+			Done:       "done",
+		},
+		Summary: NotionSummaryProperties{
+			TempUserID: "tempUserID",
+			UserKey:    "userKey",
+			Date:       "date",
+			Tag:        "tag",
+			Amount:     "amount",
+		},
+		Users: NotionUserProperties{
+			Name:              "name",
+			UserID:            "userId",
+			PictureURL:        "pictureUrl",
+			LinkedTempUserIDs: "linkedTempUserIds",
+			LastLoginAt:       "lastLoginAt",
+		},
+	}
+}
+
+// withDefaults は、未指定のプロパティ名をデフォルトで補う
+func (m NotionPropertyMapping) withDefaults() NotionPropertyMapping {
+	d := DefaultNotionPropertyMapping()
+	fill := func(name *string, def string) {
+		if *name == "" {
+			*name = def
+		}
+	}
+
+	fill(&m.Input.TempUserID, d.Input.TempUserID)
+	fill(&m.Input.UserKey, d.Input.UserKey)
+	fill(&m.Input.Name, d.Input.Name)
+	fill(&m.Input.Tag, d.Input.Tag)
+	fill(&m.Input.Done, d.Input.Done)
+	fill(&m.Summary.TempUserID, d.Summary.TempUserID)
+	fill(&m.Summary.UserKey, d.Summary.UserKey)
+	fill(&m.Summary.Date, d.Summary.Date)
+	fill(&m.Summary.Tag, d.Summary.Tag)
+	fill(&m.Summary.Amount, d.Summary.Amount)
+	fill(&m.Users.Name, d.Users.Name)
+	fill(&m.Users.UserID, d.Users.UserID)
+	fill(&m.Users.PictureURL, d.Users.PictureURL)
+	fill(&m.Users.LinkedTempUserIDs, d.Users.LinkedTempUserIDs)
+	fill(&m.Users.LastLoginAt, d.Users.LastLoginAt)
+	return m
+}
+
+// notionUserProperties は、データベースごとのユーザーのプロパティ名
+type notionUserProperties struct {
+	userID  string
+	userKey string
+}
+
+func (p NotionInputProperties) user() notionUserProperties {
+	return notionUserProperties{userID: p.TempUserID, userKey: p.UserKey}
+}
+
+func (p NotionSummaryProperties) user() notionUserProperties {
+	return notionUserProperties{userID: p.TempUserID, userKey: p.UserKey}
+}
@@ -3,55 +3,43 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"template-echo-notion-integration/internal/model"
+	"time"
 
 	"github.com/jomei/notionapi"
 )
 
+// notionMaxPageSize は、Notion APIのDatabase.Queryで指定できる最大件数
+const notionMaxPageSize = 100
+
+// notionErrorCodeValidation は、Notion APIがリクエストの値を受け付けなかった場合のエラーコード
+const notionErrorCodeValidation notionapi.ErrorCode = "validation_error"
+
 type kaimemoRepository struct {
 	client                         *notionapi.Client
-	query                          *notionapi.DatabaseQueryRequest
+	userPropertyType               string
+	properties                     NotionPropertyMapping
 	databaseKaimemoInputID         string
 	databaseKaimemoSummaryRecordID string
 }
 
 // FetchKaimemoAmount implements KaimemoRepository.
 func (k *kaimemoRepository) FetchKaimemoAmountRecords(userID string) (*model.KaimemoAmountRecords, error) {
-	k.query.Filter = &notionapi.PropertyFilter{
-		Property: "tempUserID",
-		RichText: &notionapi.TextFilterCondition{
-			Contains: userID,
-		},
-	}
-
-	resp, err := k.client.Database.Query(context.Background(), notionapi.DatabaseID(k.databaseKaimemoSummaryRecordID), k.query)
+	results, err := k.queryAll(k.databaseKaimemoSummaryRecordID, k.userFilter(k.properties.Summary.user(), userID))
 	if err != nil {
-		log.Printf("failed to notion query database: %v", err)
 		return nil, err
 	}
 
 	var kaimemoAmounts []model.KaimemoAmount
-	for _, result := range resp.Results {
-		properties := result.Properties
-
-		data := model.KaimemoAmount{}
-		data.ID = string(result.ID)
-		for _, property := range properties {
-			switch prop := property.(type) {
-			case *notionapi.TitleProperty:
-				for _, text := range prop.Title {
-					data.Date = text.Text.Content
-				}
-			case *notionapi.NumberProperty:
-				data.Amount = int(prop.Number)
-			case *notionapi.SelectProperty:
-				data.Tag = prop.Select.Name
-			default:
-				// Unhandled property type
-			}
-		}
-		kaimemoAmounts = append(kaimemoAmounts, data)
+	for _, result := range results {
+		kaimemoAmounts = append(kaimemoAmounts, k.toKaimemoAmount(result))
 	}
 
 	return &model.KaimemoAmountRecords{
@@ -61,21 +49,55 @@ func (k *kaimemoRepository) FetchKaimemoAmountRecords(userID string) (*model.Kai
 
 // InsertKaimemoAmount implements KaimemoRepository.
 func (k *kaimemoRepository) InsertKaimemoAmount(req model.CreateKaimemoAmountRequest) error {
+	names := k.properties.Summary
+	properties := notionapi.Properties{
+		names.Date: &notionapi.TitleProperty{
+			Title: []notionapi.RichText{
+				{
+					Text: &notionapi.Text{
+						Content: req.Date,
+					},
+				},
+			},
+		},
+		names.Tag: &notionapi.SelectProperty{
+			Select: notionapi.Option{
+				Name: req.Tag,
+			},
+		},
+		names.Amount: &notionapi.NumberProperty{
+			Number: float64(req.Amount),
+		},
+	}
+	if err := k.setUserProperties(properties, names.user(), req.TempUserID); err != nil {
+		return err
+	}
+
 	_, err := k.client.Page.Create(context.Background(), &notionapi.PageCreateRequest{
 		Parent: notionapi.Parent{
 			DatabaseID: notionapi.DatabaseID(k.databaseKaimemoSummaryRecordID),
 		},
+		Properties: properties,
+	})
+
+	if err != nil {
+		log.Printf("failed to notion create page: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateKaimemoAmount implements KaimemoRepository.
+// データベースの検索には直前の更新が反映されていないことがあるため、更新したレコードは更新の応答の値で差し替える
+func (k *kaimemoRepository) UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (*model.KaimemoAmountRecords, error) {
+	if _, err := k.fetchOwnedPage(k.databaseKaimemoSummaryRecordID, k.properties.Summary.user(), id, req.TempUserID); err != nil {
+		return nil, err
+	}
+
+	names := k.properties.Summary
+	page, err := k.client.Page.Update(context.Background(), notionapi.PageID(id), &notionapi.PageUpdateRequest{
 		Properties: notionapi.Properties{
-			"tempUserID": &notionapi.RichTextProperty{
-				RichText: []notionapi.RichText{
-					{
-						Text: &notionapi.Text{
-							Content: req.TempUserID,
-						},
-					},
-				},
-			},
-			"date": &notionapi.TitleProperty{
+			names.Date: &notionapi.TitleProperty{
 				Title: []notionapi.RichText{
 					{
 						Text: &notionapi.Text{
@@ -84,26 +106,40 @@ func (k *kaimemoRepository) InsertKaimemoAmount(req model.CreateKaimemoAmountReq
 					},
 				},
 			},
-			"tag": &notionapi.SelectProperty{
+			names.Tag: &notionapi.SelectProperty{
 				Select: notionapi.Option{
 					Name: req.Tag,
 				},
 			},
-			"amount": &notionapi.NumberProperty{
+			names.Amount: &notionapi.NumberProperty{
 				Number: float64(req.Amount),
 			},
 		},
 	})
+	if err != nil {
+		log.Printf("failed to notion update page: %v", err)
+		return nil, err
+	}
 
+	res, err := k.FetchKaimemoAmountRecords(req.TempUserID)
 	if err != nil {
-		log.Printf("failed to notion create page: %v", err)
-		return err
+		return nil, err
 	}
-	return nil
+	updated := k.toKaimemoAmount(*page)
+	for i := range res.Records {
+		if res.Records[i].ID == updated.ID {
+			res.Records[i] = updated
+		}
+	}
+	return res, nil
 }
 
 // RemoveKaimemoAmount implements KaimemoRepository.
 func (k *kaimemoRepository) RemoveKaimemoAmount(id string, userID string) error {
+	if _, err := k.fetchOwnedPage(k.databaseKaimemoSummaryRecordID, k.properties.Summary.user(), id, userID); err != nil {
+		return err
+	}
+
 	_, err := k.client.Page.Update(context.Background(), notionapi.PageID(id), &notionapi.PageUpdateRequest{
 		Archived: true,
 	})
@@ -118,88 +154,107 @@ func (k *kaimemoRepository) RemoveKaimemoAmount(id string, userID string) error
 
 // FetchKaimemo implements KaimemoRepository.
 func (k *kaimemoRepository) FetchKaimemo(userID string) ([]model.KaimemoResponse, error) {
-	k.query.Filter = &notionapi.PropertyFilter{
-		Property: "tempUserID",
-		RichText: &notionapi.TextFilterCondition{
-			Contains: userID,
-		},
+	results, err := k.queryAll(k.databaseKaimemoInputID, k.userFilter(k.properties.Input.user(), userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var kaimemoResponses []model.KaimemoResponse
+	for _, result := range results {
+		kaimemoResponses = append(kaimemoResponses, k.toKaimemoResponse(result))
+	}
+
+	return kaimemoResponses, nil
+}
+
+// FetchKaimemoPage implements KaimemoRepository.
+func (k *kaimemoRepository) FetchKaimemoPage(userID string, cursor string, limit int) (*model.KaimemoPage, error) {
+	startCursor, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := k.client.Database.Query(context.Background(), notionapi.DatabaseID(k.databaseKaimemoInputID), k.query)
+
+	query := &notionapi.DatabaseQueryRequest{
+		Filter:      k.userFilter(k.properties.Input.user(), userID),
+		StartCursor: notionapi.Cursor(startCursor),
+		PageSize:    limit,
+	}
+
+	resp, err := k.client.Database.Query(context.Background(), notionapi.DatabaseID(k.databaseKaimemoInputID), query)
 	if err != nil {
+		// 期限切れや改ざんされたカーソルは、Notionが入力の検証エラーとして返す
+		var apiErr *notionapi.Error
+		if startCursor != "" && errors.As(err, &apiErr) && apiErr.Status == http.StatusBadRequest && apiErr.Code == notionErrorCodeValidation {
+			return nil, ErrInvalidCursor
+		}
 		log.Printf("failed to notion query database: %v", err)
 		return nil, err
 	}
 
-	var kaimemoResponses []model.KaimemoResponse
+	page := &model.KaimemoPage{
+		Items:   []model.KaimemoResponse{},
+		HasMore: resp.HasMore,
+	}
 	for _, result := range resp.Results {
-		properties := result.Properties
-
-		data := model.KaimemoResponse{}
-		data.ID = string(result.ID)
-		for _, property := range properties {
-			switch prop := property.(type) {
-			case *notionapi.TitleProperty:
-				for _, text := range prop.Title {
-					data.Name = text.Text.Content
-				}
-			case *notionapi.SelectProperty:
-				data.Tag = prop.Select.Name
-			case *notionapi.CheckboxProperty:
-				data.Done = prop.Checkbox
-			default:
-				// fmt.Printf("  %s: Unhandled property type\n", key)
-			}
-		}
-		kaimemoResponses = append(kaimemoResponses, data)
+		page.Items = append(page.Items, k.toKaimemoResponse(result))
+	}
+	if resp.HasMore {
+		page.NextCursor = encodeCursor(string(resp.NextCursor))
 	}
 
-	return kaimemoResponses, nil
+	return page, nil
 }
 
 // InsertKaimemo implements KaimemoRepository.
-func (k *kaimemoRepository) InsertKaimemo(req model.CreateKaimemoRequest) error {
-	_, err := k.client.Page.Create(context.Background(), &notionapi.PageCreateRequest{
-		Parent: notionapi.Parent{
-			DatabaseID: notionapi.DatabaseID(k.databaseKaimemoInputID), // 既存のデータベースID
-		},
-		Properties: notionapi.Properties{
-			"tempUserID": &notionapi.RichTextProperty{
-				RichText: []notionapi.RichText{
-					{
-						Text: &notionapi.Text{
-							Content: req.TempUserID,
-						},
+func (k *kaimemoRepository) InsertKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error) {
+	names := k.properties.Input
+	properties := notionapi.Properties{
+		names.Name: &notionapi.TitleProperty{
+			Title: []notionapi.RichText{
+				{
+					Text: &notionapi.Text{
+						Content: req.Name,
 					},
 				},
 			},
-			"name": &notionapi.TitleProperty{
-				Title: []notionapi.RichText{
-					{
-						Text: &notionapi.Text{
-							Content: req.Name,
-						},
-					},
-				},
-			},
-			"tag": &notionapi.SelectProperty{
-				Select: notionapi.Option{
-					Name: req.Tag,
-				},
+		},
+		names.Tag: &notionapi.SelectProperty{
+			Select: notionapi.Option{
+				Name: req.Tag,
 			},
 		},
+	}
+	if err := k.setUserProperties(properties, names.user(), req.TempUserID); err != nil {
+		return nil, err
+	}
+
+	page, err := k.client.Page.Create(context.Background(), &notionapi.PageCreateRequest{
+		Parent: notionapi.Parent{
+			DatabaseID: notionapi.DatabaseID(k.databaseKaimemoInputID), // 既存のデータベースID
+		},
+		Properties: properties,
 	})
 
 	if err != nil {
 		log.Printf("failed to notion create page: %v", err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	res := k.toKaimemoResponse(*page)
+	return &res, nil
 }
 
 // RemoveKaimemo implements KaimemoRepository.
-func (k *kaimemoRepository) RemoveKaimemo(id string, userID string) error {
-	_, err := k.client.Page.Update(context.Background(), notionapi.PageID(id), &notionapi.PageUpdateRequest{
+func (k *kaimemoRepository) RemoveKaimemo(id string, userID string, ifMatch string) error {
+	current, err := k.fetchOwnedPage(k.databaseKaimemoInputID, k.properties.Input.user(), id, userID)
+	if err != nil {
+		return err
+	}
+	if err := k.checkVersion(current, ifMatch); err != nil {
+		return err
+	}
+
+	_, err = k.client.Page.Update(context.Background(), notionapi.PageID(id), &notionapi.PageUpdateRequest{
 		Archived: true,
 	})
 
@@ -211,18 +266,276 @@ func (k *kaimemoRepository) RemoveKaimemo(id string, userID string) error {
 	return nil
 }
 
+// UpdateKaimemo implements KaimemoRepository.
+func (k *kaimemoRepository) UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error) {
+	current, err := k.fetchOwnedPage(k.databaseKaimemoInputID, k.properties.Input.user(), id, req.TempUserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.checkVersion(current, req.IfMatch); err != nil {
+		return nil, err
+	}
+
+	names := k.properties.Input
+	properties := notionapi.Properties{}
+	if req.Name != nil {
+		properties[names.Name] = &notionapi.TitleProperty{
+			Title: []notionapi.RichText{
+				{
+					Text: &notionapi.Text{
+						Content: *req.Name,
+					},
+				},
+			},
+		}
+	}
+	if req.Tag != nil {
+		properties[names.Tag] = &notionapi.SelectProperty{
+			Select: notionapi.Option{
+				Name: *req.Tag,
+			},
+		}
+	}
+	if req.Done != nil {
+		properties[names.Done] = &notionapi.CheckboxProperty{
+			Checkbox: *req.Done,
+		}
+	}
+
+	page, err := k.client.Page.Update(context.Background(), notionapi.PageID(id), &notionapi.PageUpdateRequest{
+		Properties: properties,
+	})
+	if err != nil {
+		log.Printf("failed to notion update page: %v", err)
+		return nil, err
+	}
+
+	res := k.toKaimemoResponse(*page)
+	return &res, nil
+}
+
+// ReassignUser implements KaimemoRepository.
+// ページごとに更新するため、失敗した場合はそれまでの件数とエラーを返す
+func (k *kaimemoRepository) ReassignUser(fromUserID string, toUserID string) (*UserMigrationResult, error) {
+	result := &UserMigrationResult{}
+
+	databases := []struct {
+		id       string
+		user     notionUserProperties
+		migrated *int
+	}{
+		{id: k.databaseKaimemoInputID, user: k.properties.Input.user(), migrated: &result.Items},
+		{id: k.databaseKaimemoSummaryRecordID, user: k.properties.Summary.user(), migrated: &result.Amounts},
+	}
+
+	for _, database := range databases {
+		pages, err := k.queryAll(database.id, k.userFilter(database.user, fromUserID))
+		if err != nil {
+			return result, err
+		}
+
+		for _, page := range pages {
+			properties := notionapi.Properties{}
+			if err := k.setUserProperties(properties, database.user, toUserID); err != nil {
+				return result, err
+			}
+			_, err := k.client.Page.Update(context.Background(), notionapi.PageID(page.ID), &notionapi.PageUpdateRequest{
+				Properties: properties,
+			})
+			if err != nil {
+				log.Printf("failed to notion update page: %v", err)
+				return result, err
+			}
+			*database.migrated++
+		}
+	}
+
+	return result, nil
+}
+
+// queryAll は、HasMore/NextCursorをたどってデータベースの全ページを取得する
+func (k *kaimemoRepository) queryAll(databaseID string, filter notionapi.Filter) ([]notionapi.Page, error) {
+	return queryAllPages(k.client, databaseID, filter)
+}
+
+// queryAllPages は、HasMore/NextCursorをたどってfilterに一致する全ページを取得する。
+// リクエストは呼び出しごとに生成するため、並行に呼び出しても安全
+func queryAllPages(client *notionapi.Client, databaseID string, filter notionapi.Filter) ([]notionapi.Page, error) {
+	var results []notionapi.Page
+
+	query := &notionapi.DatabaseQueryRequest{
+		Filter:   filter,
+		PageSize: notionMaxPageSize,
+	}
+	for {
+		resp, err := client.Database.Query(context.Background(), notionapi.DatabaseID(databaseID), query)
+		if err != nil {
+			log.Printf("failed to notion query database: %v", err)
+			return nil, err
+		}
+		results = append(results, resp.Results...)
+
+		if !resp.HasMore || resp.NextCursor == "" {
+			return results, nil
+		}
+		query.StartCursor = resp.NextCursor
+	}
+}
+
+// fetchOwnedPage は、ページを取得し、指定したデータベースに属していてuserIDのものであることを確認する
+func (k *kaimemoRepository) fetchOwnedPage(databaseID string, user notionUserProperties, id string, userID string) (*notionapi.Page, error) {
+	page, err := k.client.Page.Get(context.Background(), notionapi.PageID(id))
+	if err != nil {
+		var apiErr *notionapi.Error
+		if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusBadRequest) {
+			return nil, ErrNotFound
+		}
+		log.Printf("failed to notion get page: %v", err)
+		return nil, err
+	}
+
+	if page.Archived || normalizeNotionID(string(page.Parent.DatabaseID)) != normalizeNotionID(databaseID) {
+		return nil, ErrNotFound
+	}
+	if k.pageUserID(page, user) != userID {
+		return nil, ErrForbidden
+	}
+	return page, nil
+}
+
+// normalizeNotionID は、ハイフンの有無が異なるNotionのIDを比較できる形にそろえる
+func normalizeNotionID(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+// toKaimemoResponse は、プロパティ名で値を読み取る。同じ型のプロパティが複数あっても取り違えない
+func (k *kaimemoRepository) toKaimemoResponse(result notionapi.Page) model.KaimemoResponse {
+	names := k.properties.Input
+	data := model.KaimemoResponse{}
+	data.ID = string(result.ID)
+	if prop, ok := result.Properties[names.Name].(*notionapi.TitleProperty); ok {
+		data.Name = plainText(prop.Title)
+	}
+	if prop, ok := result.Properties[names.Tag].(*notionapi.SelectProperty); ok {
+		data.Tag = prop.Select.Name
+	}
+	if prop, ok := result.Properties[names.Done].(*notionapi.CheckboxProperty); ok {
+		data.Done = prop.Checkbox
+	}
+	data.Version = notionVersion(result.LastEditedTime, data)
+	return data
+}
+
+// notionVersion は、ページのlast_edited_timeと値からバージョンを求める。
+// last_edited_timeは分単位に丸められるため、同じ分のうちの変更も値の違いで見分ける。
+//
+// ただし、同じ分のうちに値を変えて元に戻された場合は、バージョンも元に戻る（ABA）。
+// Notionのバージョンは競合を見つけやすくするためのもので、取りこぼしがないことは保証しない
+func notionVersion(lastEditedTime time.Time, data model.KaimemoResponse) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%t", lastEditedTime.UTC().Format(time.RFC3339Nano), data.Name, data.Tag, data.Done)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkVersion は、ifMatchが空でなく、pageの現在のバージョンと異なる場合に*ConflictErrorを返す。
+// Notionには条件付き更新がないため、確認と更新は不可分ではなく、その間の変更は検出できない。
+// SQLite・インメモリと違い、Notionでの確認はベストエフォートになる
+func (k *kaimemoRepository) checkVersion(page *notionapi.Page, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+	current := k.toKaimemoResponse(*page)
+	if current.Version != ifMatch {
+		return &ConflictError{Current: &current}
+	}
+	return nil
+}
+
+func (k *kaimemoRepository) toKaimemoAmount(result notionapi.Page) model.KaimemoAmount {
+	names := k.properties.Summary
+	data := model.KaimemoAmount{}
+	data.ID = string(result.ID)
+	if prop, ok := result.Properties[names.Date].(*notionapi.TitleProperty); ok {
+		data.Date = plainText(prop.Title)
+	}
+	if prop, ok := result.Properties[names.Tag].(*notionapi.SelectProperty); ok {
+		data.Tag = prop.Select.Name
+	}
+	if prop, ok := result.Properties[names.Amount].(*notionapi.NumberProperty); ok {
+		data.Amount = int(prop.Number)
+	}
+	return data
+}
+
+// plainText は、リッチテキストの文字列を連結する
+func plainText(texts []notionapi.RichText) string {
+	var content string
+	for _, text := range texts {
+		if text.Text != nil {
+			content += text.Text.Content
+		}
+	}
+	return content
+}
+
 type KaimemoRepository interface {
 	FetchKaimemo(userID string) ([]model.KaimemoResponse, error)
-	InsertKaimemo(req model.CreateKaimemoRequest) error
-	RemoveKaimemo(id string, userID string) error
+	FetchKaimemoPage(userID string, cursor string, limit int) (*model.KaimemoPage, error)
+	InsertKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error)
+	UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error)
+	// RemoveKaimemo は、ifMatchが空でなければ、現在のVersionと一致する場合だけ削除する
+	RemoveKaimemo(id string, userID string, ifMatch string) error
 	FetchKaimemoAmountRecords(userID string) (*model.KaimemoAmountRecords, error)
 	InsertKaimemoAmount(req model.CreateKaimemoAmountRequest) error
+	// UpdateKaimemoAmount は、金額レコードを更新し、集計し直せるよう更新後の利用者の金額レコードを返す
+	UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (*model.KaimemoAmountRecords, error)
 	RemoveKaimemoAmount(id string, userID string) error
+	// ReassignUser は、fromUserIDの買い物メモと集計をtoUserIDのものに付け替える。
+	// 付け替え済みのレコードは対象外のため、途中で失敗しても再実行すれば残りだけを移行する
+	ReassignUser(fromUserID string, toUserID string) (*UserMigrationResult, error)
 }
 
-func NewNotionRepository(apiKey string, databaseKaimemoInputID string, databaseKaimemoSummaryRecordID string) KaimemoRepository {
-	client := notionapi.NewClient(notionapi.Token(apiKey))
-	query := &notionapi.DatabaseQueryRequest{}
+// UserMigrationResult は、ReassignUserで付け替えた件数
+type UserMigrationResult struct {
+	Items   int `json:"items"`
+	Amounts int `json:"amounts"`
+}
+
+// NotionOption は、NewNotionRepositoryの任意設定
+type NotionOption func(*notionOptions)
+
+type notionOptions struct {
+	clientOptions    []notionapi.ClientOption
+	userPropertyType string
+	properties       NotionPropertyMapping
+}
+
+// WithNotionClientOptions は、notionapi.Clientの生成時に渡すオプションを指定する
+func WithNotionClientOptions(opts ...notionapi.ClientOption) NotionOption {
+	return func(o *notionOptions) {
+		o.clientOptions = append(o.clientOptions, opts...)
+	}
+}
+
+// WithUserPropertyType は、ユーザーの絞り込みに使うプロパティの型を指定する
+func WithUserPropertyType(userPropertyType string) NotionOption {
+	return func(o *notionOptions) {
+		o.userPropertyType = userPropertyType
+	}
+}
+
+// WithPropertyMapping は、読み書きするプロパティ名を指定する。未指定の項目はデフォルトの名前を使う
+func WithPropertyMapping(mapping NotionPropertyMapping) NotionOption {
+	return func(o *notionOptions) {
+		o.properties = mapping
+	}
+}
+
+func NewNotionRepository(apiKey string, databaseKaimemoInputID string, databaseKaimemoSummaryRecordID string, opts ...NotionOption) KaimemoRepository {
+	options := &notionOptions{userPropertyType: UserPropertyRichText}
+	for _, opt := range opts {
+		opt(options)
+	}
+	client := notionapi.NewClient(notionapi.Token(apiKey), options.clientOptions...)
 
-	return &kaimemoRepository{client: client, databaseKaimemoInputID: databaseKaimemoInputID, databaseKaimemoSummaryRecordID: databaseKaimemoSummaryRecordID, query: query}
+	return &kaimemoRepository{client: client, databaseKaimemoInputID: databaseKaimemoInputID, databaseKaimemoSummaryRecordID: databaseKaimemoSummaryRecordID, userPropertyType: options.userPropertyType, properties: options.properties.withDefaults()}
 }
@@ -1,6 +1,14 @@
 package repository
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"template-echo-notion-integration/internal/model"
 	"testing"
 	"time"
@@ -8,6 +16,7 @@ import (
 	"github.com/jomei/notionapi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewNotionRepository(t *testing.T) {
@@ -95,3 +104,675 @@ func TestMockKaimemoRepository(t *testing.T) {
 	// モックの呼び出しを検証
 	mockRepo.AssertExpectations(t)
 }
+
+// rewriteTransport は、Notion APIへのリクエストをテストサーバーに向ける
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (r rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newStubNotionRepository は、handlerをNotion APIとして扱うkaimemoRepositoryを生成する
+func newStubNotionRepository(t *testing.T, handler http.Handler, opts ...NotionOption) *kaimemoRepository {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	opts = append(opts, WithNotionClientOptions(
+		notionapi.WithHTTPClient(&http.Client{Transport: rewriteTransport{target: target}}),
+		notionapi.WithRetry(0),
+	))
+	repo := NewNotionRepository("test-api-key", "input-db", "summary-db", opts...)
+	return repo.(*kaimemoRepository)
+}
+
+func notionKaimemoPage(id, name, tag string, done bool) notionapi.Page {
+	return notionapi.Page{
+		Object: notionapi.ObjectTypePage,
+		ID:     notionapi.ObjectID(id),
+		Properties: notionapi.Properties{
+			"name": &notionapi.TitleProperty{
+				Type:  notionapi.PropertyTypeTitle,
+				Title: []notionapi.RichText{{Text: &notionapi.Text{Content: name}}},
+			},
+			"tag": &notionapi.SelectProperty{
+				Type:   notionapi.PropertyTypeSelect,
+				Select: notionapi.Option{Name: tag},
+			},
+			"done": &notionapi.CheckboxProperty{
+				Type:     notionapi.PropertyTypeCheckbox,
+				Checkbox: done,
+			},
+		},
+	}
+}
+
+// notionItem は、last_edited_timeのないページから読み取った場合のバージョンを設定する
+func notionItem(item model.KaimemoResponse) model.KaimemoResponse {
+	item.Version = notionVersion(time.Time{}, item)
+	return item
+}
+
+func notionKaimemoAmountPage(id, date, tag string, amount int) notionapi.Page {
+	return notionapi.Page{
+		Object: notionapi.ObjectTypePage,
+		ID:     notionapi.ObjectID(id),
+		Properties: notionapi.Properties{
+			"date": &notionapi.TitleProperty{
+				Type:  notionapi.PropertyTypeTitle,
+				Title: []notionapi.RichText{{Text: &notionapi.Text{Content: date}}},
+			},
+			"tag": &notionapi.SelectProperty{
+				Type:   notionapi.PropertyTypeSelect,
+				Select: notionapi.Option{Name: tag},
+			},
+			"amount": &notionapi.NumberProperty{
+				Type:   notionapi.PropertyTypeNumber,
+				Number: float64(amount),
+			},
+		},
+	}
+}
+
+// stubQueryRequest は、スタブが受け取るDatabase.Queryのリクエストボディ
+type stubQueryRequest struct {
+	Filter      json.RawMessage  `json:"filter"`
+	StartCursor notionapi.Cursor `json:"start_cursor"`
+	PageSize    int              `json:"page_size"`
+}
+
+// decodeStubRequest は、スタブが受け取ったリクエストボディをvに読み込む。
+// スタブはサーバーのゴルーチンで動きrequireでテストを止められないため、失敗はassertで記録して400を返す
+func decodeStubRequest(t *testing.T, w http.ResponseWriter, r *http.Request, v any) bool {
+	if !assert.NoError(t, json.NewDecoder(r.Body).Decode(v)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// pagedQueryHandler は、pagesをpage_sizeずつ返すDatabase.Queryのスタブ
+func pagedQueryHandler(t *testing.T, pages []notionapi.Page, requests *[]stubQueryRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req stubQueryRequest
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		if requests != nil {
+			*requests = append(*requests, req)
+		}
+
+		start := 0
+		if req.StartCursor != "" {
+			var err error
+			start, err = strconv.Atoi(string(req.StartCursor))
+			if err != nil || start < 0 || start > len(pages) {
+				// Notionは、発行していないカーソルを検証エラーとして返す
+				w.WriteHeader(http.StatusBadRequest)
+				assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Error{Object: notionapi.ObjectTypeError, Status: http.StatusBadRequest, Code: "validation_error", Message: "start_cursor provided is invalid"}))
+				return
+			}
+		}
+		end := start + req.PageSize
+		resp := notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList}
+		if end < len(pages) {
+			resp.HasMore = true
+			resp.NextCursor = notionapi.Cursor(strconv.Itoa(end))
+		} else {
+			end = len(pages)
+		}
+		resp.Results = pages[start:end]
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(resp))
+	}
+}
+
+func TestKaimemoRepository_FetchKaimemoAmountRecords_AllPages(t *testing.T) {
+	var pages []notionapi.Page
+	for i := 0; i < 250; i++ {
+		pages = append(pages, notionKaimemoAmountPage(fmt.Sprintf("page-%d", i), "2023-05-15", "food", 100))
+	}
+	var requests []stubQueryRequest
+	repo := newStubNotionRepository(t, pagedQueryHandler(t, pages, &requests))
+
+	res, err := repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	assert.Len(t, res.Records, 250)
+	assert.Equal(t, "page-249", res.Records[249].ID)
+	assert.Equal(t, 100, res.Records[249].Amount)
+
+	require.Len(t, requests, 3)
+	assert.Equal(t, notionapi.Cursor(""), requests[0].StartCursor)
+	assert.Equal(t, notionapi.Cursor("100"), requests[1].StartCursor)
+	assert.Equal(t, notionapi.Cursor("200"), requests[2].StartCursor)
+}
+
+func TestKaimemoRepository_FetchKaimemoPage(t *testing.T) {
+	pages := []notionapi.Page{
+		notionKaimemoPage("page-0", "milk", "food", false),
+		notionKaimemoPage("page-1", "soap", "daily", true),
+		notionKaimemoPage("page-2", "egg", "food", false),
+	}
+	repo := newStubNotionRepository(t, pagedQueryHandler(t, pages, nil))
+
+	first, err := repo.FetchKaimemoPage("user-1", "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{
+		notionItem(model.KaimemoResponse{ID: "page-0", Tag: "food", Name: "milk"}),
+		notionItem(model.KaimemoResponse{ID: "page-1", Tag: "daily", Name: "soap", Done: true}),
+	}, first.Items)
+	assert.True(t, first.HasMore)
+	assert.NotEmpty(t, first.NextCursor)
+
+	second, err := repo.FetchKaimemoPage("user-1", first.NextCursor, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{notionItem(model.KaimemoResponse{ID: "page-2", Tag: "food", Name: "egg"})}, second.Items)
+	assert.False(t, second.HasMore)
+	assert.Empty(t, second.NextCursor)
+
+	_, err = repo.FetchKaimemoPage("user-1", "!!", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// 形式は正しいがNotionが受け付けないカーソル
+	_, err = repo.FetchKaimemoPage("user-1", encodeCursor("stale-cursor"), 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+// userScopedQueryHandler は、フィルタに指定されたユーザーのページだけを返すDatabase.Queryのスタブ。
+// ページごとに1件ずつ返し、カーソルをたどる処理も並行に走らせる
+func userScopedQueryHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req stubQueryRequest
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		var filter struct {
+			RichText struct {
+				Equals string `json:"equals"`
+			} `json:"rich_text"`
+		}
+		if !assert.NoError(t, json.Unmarshal(req.Filter, &filter)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		userID := filter.RichText.Equals
+
+		resp := notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList}
+		if req.StartCursor == "" {
+			resp.Results = []notionapi.Page{notionKaimemoPage(userID+"-0", userID, "food", false)}
+			resp.HasMore = true
+			resp.NextCursor = notionapi.Cursor(userID)
+		} else {
+			// カーソルが別ユーザーのものに書き換わっていれば検知する
+			assert.Equal(t, userID, string(req.StartCursor))
+			resp.Results = []notionapi.Page{notionKaimemoPage(userID+"-1", userID, "food", false)}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(resp))
+	}
+}
+
+// go test -race で実行すると、リクエストの共有によるデータ競合も検出される
+func TestKaimemoRepository_ConcurrentFetch(t *testing.T) {
+	repo := newStubNotionRepository(t, userScopedQueryHandler(t))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(userID string) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				items, err := repo.FetchKaimemo(userID)
+				if assert.NoError(t, err) && assert.Len(t, items, 2) {
+					for _, item := range items {
+						assert.Equal(t, userID, item.Name)
+					}
+				}
+
+				amounts, err := repo.FetchKaimemoAmountRecords(userID)
+				if assert.NoError(t, err) {
+					assert.Len(t, amounts.Records, 2)
+				}
+
+				page, err := repo.FetchKaimemoPage(userID, "", 1)
+				if assert.NoError(t, err) && assert.Len(t, page.Items, 1) {
+					assert.Equal(t, userID, page.Items[0].Name)
+				}
+			}
+		}(fmt.Sprintf("user-%d", i))
+	}
+	wg.Wait()
+}
+
+// pageStubHandler は、pagesをPage.Get/Page.Updateで操作できるNotion APIのスタブ
+func pageStubHandler(t *testing.T, pages map[string]*notionapi.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id := strings.TrimPrefix(r.URL.Path, "/v1/pages/")
+		page, ok := pages[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Error{
+				Object: notionapi.ObjectTypeError, Status: http.StatusNotFound, Code: "object_not_found",
+			}))
+			return
+		}
+
+		if r.Method == http.MethodPatch {
+			var req struct {
+				Archived   bool                       `json:"archived"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			}
+			if !decodeStubRequest(t, w, r, &req) {
+				return
+			}
+			page.Archived = req.Archived
+			// 既存のプロパティと同じ型として上書きする
+			for name, raw := range req.Properties {
+				if !assert.Contains(t, page.Properties, name) || !assert.NoError(t, json.Unmarshal(raw, page.Properties[name])) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(page))
+	}
+}
+
+func withOwner(page notionapi.Page, databaseID, userID string) *notionapi.Page {
+	page.Parent = notionapi.Parent{Type: notionapi.ParentTypeDatabaseID, DatabaseID: notionapi.DatabaseID(databaseID)}
+	page.Properties["tempUserID"] = &notionapi.RichTextProperty{
+		Type:     notionapi.PropertyTypeRichText,
+		RichText: []notionapi.RichText{{Text: &notionapi.Text{Content: userID}}},
+	}
+	return &page
+}
+
+func TestKaimemoRepository_KaimemoVersion(t *testing.T) {
+	page := withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "user-1")
+	page.LastEditedTime = time.Date(2023, 5, 15, 10, 20, 0, 0, time.UTC)
+	pages := map[string]*notionapi.Page{"item-1": page}
+	repo := newStubNotionRepository(t, pageStubHandler(t, pages))
+	stale := repo.toKaimemoResponse(*page).Version
+
+	done := true
+	updated, err := repo.UpdateKaimemo("item-1", model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done, IfMatch: stale})
+	require.NoError(t, err)
+	// last_edited_timeが同じ分のままでも、値が変わればバージョンも変わる
+	assert.Equal(t, page.LastEditedTime, time.Date(2023, 5, 15, 10, 20, 0, 0, time.UTC))
+	assert.NotEqual(t, stale, updated.Version)
+
+	name := "oat milk"
+	_, err = repo.UpdateKaimemo("item-1", model.UpdateKaimemoRequest{TempUserID: "user-1", Name: &name, IfMatch: stale})
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, updated, conflict.Current)
+	assert.Equal(t, "milk", plainText(page.Properties["name"].(*notionapi.TitleProperty).Title))
+
+	require.ErrorIs(t, repo.RemoveKaimemo("item-1", "user-1", stale), ErrConflict)
+	assert.False(t, page.Archived)
+	require.NoError(t, repo.RemoveKaimemo("item-1", "user-1", updated.Version))
+	assert.True(t, page.Archived)
+}
+
+func TestKaimemoRepository_RemoveOwnership(t *testing.T) {
+	pages := map[string]*notionapi.Page{
+		"item-1":   withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "user-1"),
+		"amount-1": withOwner(notionKaimemoAmountPage("amount-1", "2023-05-15", "food", 100), "summary-db", "user-1"),
+	}
+	repo := newStubNotionRepository(t, pageStubHandler(t, pages))
+
+	assert.ErrorIs(t, repo.RemoveKaimemo("item-1", "user-2", ""), ErrForbidden)
+	assert.ErrorIs(t, repo.RemoveKaimemo("unknown", "user-1", ""), ErrNotFound)
+	// 別のデータベースのページは対象外
+	assert.ErrorIs(t, repo.RemoveKaimemo("amount-1", "user-1", ""), ErrNotFound)
+	assert.False(t, pages["item-1"].Archived)
+
+	assert.NoError(t, repo.RemoveKaimemo("item-1", "user-1", ""))
+	assert.True(t, pages["item-1"].Archived)
+	assert.ErrorIs(t, repo.RemoveKaimemo("item-1", "user-1", ""), ErrNotFound)
+
+	assert.ErrorIs(t, repo.RemoveKaimemoAmount("amount-1", "user-2"), ErrForbidden)
+	assert.NoError(t, repo.RemoveKaimemoAmount("amount-1", "user-1"))
+	assert.True(t, pages["amount-1"].Archived)
+}
+
+func TestKaimemoRepository_UpdateKaimemo(t *testing.T) {
+	pages := map[string]*notionapi.Page{
+		"item-1":   withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "user-1"),
+		"amount-1": withOwner(notionKaimemoAmountPage("amount-1", "2023-05-15", "food", 100), "summary-db", "user-1"),
+	}
+	repo := newStubNotionRepository(t, pageStubHandler(t, pages))
+
+	done := true
+	res, err := repo.UpdateKaimemo("item-1", model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done})
+	require.NoError(t, err)
+	assert.Equal(t, notionItem(model.KaimemoResponse{ID: "item-1", Tag: "food", Name: "milk", Done: true}), *res)
+
+	name := "oat milk"
+	res, err = repo.UpdateKaimemo("item-1", model.UpdateKaimemoRequest{TempUserID: "user-1", Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, notionItem(model.KaimemoResponse{ID: "item-1", Tag: "food", Name: "oat milk", Done: true}), *res)
+
+	_, err = repo.UpdateKaimemo("item-1", model.UpdateKaimemoRequest{TempUserID: "user-2", Done: &done})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = repo.UpdateKaimemo("amount-1", model.UpdateKaimemoRequest{TempUserID: "user-1", Done: &done})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestKaimemoRepository_UpdateKaimemoAmount(t *testing.T) {
+	pages := map[string]*notionapi.Page{
+		"item-1":   withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "user-1"),
+		"amount-1": withOwner(notionKaimemoAmountPage("amount-1", "2023-05-15", "food", 100), "summary-db", "user-1"),
+	}
+	// 検索には直前の更新がまだ反映されていない
+	stale := []notionapi.Page{
+		*withOwner(notionKaimemoAmountPage("amount-1", "2023-05-15", "food", 100), "summary-db", "user-1"),
+		*withOwner(notionKaimemoAmountPage("amount-2", "2023-05-15", "daily", 50), "summary-db", "user-1"),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/v1/pages/", pageStubHandler(t, pages))
+	mux.HandleFunc("POST /v1/databases/summary-db/query", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList, Results: stale}))
+	})
+	repo := newStubNotionRepository(t, mux)
+
+	req := model.UpdateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "daily", Amount: 250}
+	res, err := repo.UpdateKaimemoAmount("amount-1", req)
+	require.NoError(t, err)
+	assert.Equal(t, model.KaimemoAmount{ID: "amount-1", Date: "2023-05-16", Tag: "daily", Amount: 250}, repo.toKaimemoAmount(*pages["amount-1"]))
+	assert.Equal(t, []model.KaimemoAmount{
+		{ID: "amount-1", Date: "2023-05-16", Tag: "daily", Amount: 250},
+		{ID: "amount-2", Date: "2023-05-15", Tag: "daily", Amount: 50},
+	}, res.Records)
+
+	req.TempUserID = "user-2"
+	_, err = repo.UpdateKaimemoAmount("amount-1", req)
+	assert.ErrorIs(t, err, ErrForbidden)
+	req.TempUserID = "user-1"
+	_, err = repo.UpdateKaimemoAmount("item-1", req)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestKaimemoRepository_UserFilterIsExactMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []NotionOption
+		expected string
+	}{
+		{
+			name:     "rich text",
+			expected: `{"property":"tempUserID","rich_text":{"equals":"user-1"}}`,
+		},
+		{
+			name:     "select",
+			opts:     []NotionOption{WithUserPropertyType(UserPropertySelect)},
+			expected: `{"property":"userKey","select":{"equals":"user-1"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []stubQueryRequest
+			repo := newStubNotionRepository(t, pagedQueryHandler(t, nil, &requests), tt.opts...)
+
+			_, err := repo.FetchKaimemo("user-1")
+			require.NoError(t, err)
+			_, err = repo.FetchKaimemoAmountRecords("user-1")
+			require.NoError(t, err)
+			_, err = repo.FetchKaimemoPage("user-1", "", 10)
+			require.NoError(t, err)
+
+			require.Len(t, requests, 3)
+			for _, req := range requests {
+				assert.JSONEq(t, tt.expected, string(req.Filter))
+			}
+		})
+	}
+}
+
+func TestKaimemoRepository_SelectModeOwnership(t *testing.T) {
+	page := withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "user-1")
+	page.Properties["userKey"] = &notionapi.SelectProperty{
+		Type:   notionapi.PropertyTypeSelect,
+		Select: notionapi.Option{Name: "user-1"},
+	}
+	pages := map[string]*notionapi.Page{"item-1": page}
+	repo := newStubNotionRepository(t, pageStubHandler(t, pages), WithUserPropertyType(UserPropertySelect))
+
+	assert.ErrorIs(t, repo.RemoveKaimemo("item-1", "user-10", ""), ErrForbidden)
+	assert.NoError(t, repo.RemoveKaimemo("item-1", "user-1", ""))
+}
+
+func TestKaimemoRepository_SelectModeRejectsCommas(t *testing.T) {
+	// Notionはカンマを含む選択肢を作れないため、要求を送らずに拒否する
+	repo := newStubNotionRepository(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+	}), WithUserPropertyType(UserPropertySelect))
+
+	_, err := repo.InsertKaimemo(model.CreateKaimemoRequest{TempUserID: "user,1", Tag: "food", Name: "milk"})
+	assert.ErrorIs(t, err, ErrInvalidUserKey)
+	err = repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user,1", Date: "2023-05-15", Tag: "food", Amount: 100})
+	assert.ErrorIs(t, err, ErrInvalidUserKey)
+}
+
+func TestKaimemoRepository_MigrateUserKey(t *testing.T) {
+	pages := map[string][]notionapi.Page{
+		"input-db": {
+			*withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "user-1"),
+			notionKaimemoPage("item-2", "orphan", "food", false),
+			*withOwner(notionKaimemoPage("item-3", "egg", "food", false), "input-db", "user,3"),
+		},
+		"summary-db": {
+			*withOwner(notionKaimemoAmountPage("amount-1", "2023-05-15", "food", 100), "summary-db", "user-2"),
+		},
+	}
+	databaseUpdated := map[string]bool{}
+	pageUpdates := map[string]string{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/databases/{id}", func(w http.ResponseWriter, r *http.Request) {
+		properties := notionapi.PropertyConfigs{}
+		// summary-dbには既にuserKeyがある
+		if r.PathValue("id") == "summary-db" {
+			properties["userKey"] = &notionapi.SelectPropertyConfig{Type: notionapi.PropertyConfigTypeSelect}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Database{Object: notionapi.ObjectTypeDatabase, Properties: properties}))
+	})
+	mux.HandleFunc("PATCH /v1/databases/{id}", func(w http.ResponseWriter, r *http.Request) {
+		databaseUpdated[r.PathValue("id")] = true
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Database{Object: notionapi.ObjectTypeDatabase}))
+	})
+	mux.HandleFunc("POST /v1/databases/{id}/query", func(w http.ResponseWriter, r *http.Request) {
+		var req stubQueryRequest
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		assert.JSONEq(t, `{"property":"userKey","select":{"is_empty":true}}`, string(req.Filter))
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList, Results: pages[r.PathValue("id")]}))
+	})
+	mux.HandleFunc("PATCH /v1/pages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Properties struct {
+				UserKey struct {
+					Select struct {
+						Name string `json:"name"`
+					} `json:"select"`
+				} `json:"userKey"`
+			} `json:"properties"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		pageUpdates[r.PathValue("id")] = req.Properties.UserKey.Select.Name
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Page{Object: notionapi.ObjectTypePage}))
+	})
+	repo := newStubNotionRepository(t, mux)
+
+	result, err := repo.MigrateUserKey()
+	require.NoError(t, err)
+	assert.Equal(t, &UserKeyMigrationResult{Migrated: 2, Skipped: 2}, result)
+	assert.Equal(t, map[string]bool{"input-db": true}, databaseUpdated)
+	assert.Equal(t, map[string]string{"item-1": "user-1", "amount-1": "user-2"}, pageUpdates)
+}
+
+func TestKaimemoRepository_PropertyMapping(t *testing.T) {
+	mapping := NotionPropertyMapping{
+		Input:   NotionInputProperties{TempUserID: "ユーザー", Name: "品名", Tag: "分類", Done: "購入済み"},
+		Summary: NotionSummaryProperties{Date: "日付", Tag: "分類", Amount: "金額"},
+	}
+
+	var created []map[string]json.RawMessage
+	var filters []json.RawMessage
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/pages", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		created = append(created, req.Properties)
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Page{Object: notionapi.ObjectTypePage, ID: "created"}))
+	})
+	mux.HandleFunc("POST /v1/databases/{id}/query", func(w http.ResponseWriter, r *http.Request) {
+		var req stubQueryRequest
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		filters = append(filters, req.Filter)
+
+		// 同じ型のプロパティ（店舗もセレクト）があっても、名前で読み分ける
+		page := notionapi.Page{
+			Object: notionapi.ObjectTypePage,
+			ID:     "item-1",
+			Properties: notionapi.Properties{
+				"品名":   &notionapi.TitleProperty{Type: notionapi.PropertyTypeTitle, Title: []notionapi.RichText{{Text: &notionapi.Text{Content: "牛乳"}}}},
+				"分類":   &notionapi.SelectProperty{Type: notionapi.PropertyTypeSelect, Select: notionapi.Option{Name: "食費"}},
+				"店舗":   &notionapi.SelectProperty{Type: notionapi.PropertyTypeSelect, Select: notionapi.Option{Name: "スーパー"}},
+				"購入済み": &notionapi.CheckboxProperty{Type: notionapi.PropertyTypeCheckbox, Checkbox: true},
+				"重要":   &notionapi.CheckboxProperty{Type: notionapi.PropertyTypeCheckbox, Checkbox: false},
+			},
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList, Results: []notionapi.Page{page}}))
+	})
+	repo := newStubNotionRepository(t, mux, WithPropertyMapping(mapping))
+
+	_, err := repo.InsertKaimemo(model.CreateKaimemoRequest{TempUserID: "user-1", Name: "牛乳", Tag: "食費"})
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-15", Tag: "食費", Amount: 300}))
+	require.Len(t, created, 2)
+	assert.ElementsMatch(t, []string{"ユーザー", "品名", "分類"}, mapKeys(created[0]))
+	// 未指定のプロパティ名はデフォルトのまま
+	assert.ElementsMatch(t, []string{"tempUserID", "日付", "分類", "金額"}, mapKeys(created[1]))
+
+	items, err := repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{notionItem(model.KaimemoResponse{ID: "item-1", Name: "牛乳", Tag: "食費", Done: true})}, items)
+	require.Len(t, filters, 1)
+	assert.JSONEq(t, `{"property":"ユーザー","rich_text":{"equals":"user-1"}}`, string(filters[0]))
+}
+
+func mapKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestKaimemoRepository_ReassignUser(t *testing.T) {
+	pages := map[string]*notionapi.Page{
+		"item-1":   withOwner(notionKaimemoPage("item-1", "milk", "food", false), "input-db", "temp-1"),
+		"item-2":   withOwner(notionKaimemoPage("item-2", "egg", "food", false), "input-db", "temp-1"),
+		"item-3":   withOwner(notionKaimemoPage("item-3", "soap", "daily", false), "input-db", "temp-2"),
+		"amount-1": withOwner(notionKaimemoAmountPage("amount-1", "2023-05-15", "food", 100), "summary-db", "temp-1"),
+	}
+	failOnce := map[string]bool{"item-2": true}
+
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/databases/{id}/query", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var req struct {
+			Filter struct {
+				Property string `json:"property"`
+				RichText struct {
+					Equals string `json:"equals"`
+				} `json:"rich_text"`
+			} `json:"filter"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		assert.Equal(t, "tempUserID", req.Filter.Property)
+
+		results := []notionapi.Page{}
+		for _, id := range []string{"item-1", "item-2", "item-3", "amount-1"} {
+			page := pages[id]
+			if string(page.Parent.DatabaseID) == r.PathValue("id") && notionOwner(page) == req.Filter.RichText.Equals {
+				results = append(results, *page)
+			}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList, Results: results}))
+	})
+	mux.HandleFunc("PATCH /v1/pages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := r.PathValue("id")
+		if failOnce[id] {
+			failOnce[id] = false
+			w.WriteHeader(http.StatusInternalServerError)
+			assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Error{Object: "error", Status: http.StatusInternalServerError, Code: "internal_server_error"}))
+			return
+		}
+
+		var req struct {
+			Properties struct {
+				TempUserID struct {
+					RichText []notionapi.RichText `json:"rich_text"`
+				} `json:"tempUserID"`
+			} `json:"properties"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		page := withOwner(*pages[id], string(pages[id].Parent.DatabaseID), plainText(req.Properties.TempUserID.RichText))
+		pages[id] = page
+		assert.NoError(t, json.NewEncoder(w).Encode(page))
+	})
+	repo := newStubNotionRepository(t, mux)
+
+	// 途中で失敗しても、それまでの件数を返す
+	result, err := repo.ReassignUser("temp-1", "line-user-1")
+	assert.Error(t, err)
+	assert.Equal(t, &UserMigrationResult{Items: 1}, result)
+
+	// 再実行すると残りだけを付け替える
+	result, err = repo.ReassignUser("temp-1", "line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &UserMigrationResult{Items: 1, Amounts: 1}, result)
+
+	result, err = repo.ReassignUser("temp-1", "line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &UserMigrationResult{}, result)
+	assert.Equal(t, "line-user-1", notionOwner(pages["item-2"]))
+	assert.Equal(t, "temp-2", notionOwner(pages["item-3"]))
+}
+
+// notionOwner は、withOwnerで設定したtempUserIDを返す
+func notionOwner(page *notionapi.Page) string {
+	return plainText(page.Properties["tempUserID"].(*notionapi.RichTextProperty).RichText)
+}
@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// SchemaValidator は、Notionデータベースのプロパティ構成を検証する
+type SchemaValidator interface {
+	// ValidateSchema は、データベースに必要なプロパティがそろっているかを検証する
+	ValidateSchema() error
+}
+
+// SchemaManager は、Notionデータベースのプロパティ構成を検証・修正する
+type SchemaManager interface {
+	SchemaValidator
+	// BootstrapSchema は、データベースを期待する構成に作成・修正する。
+	// データベースIDが未設定の場合、parentPageIDのページ配下に作成する。
+	// 型の異なるプロパティは値が失われるおそれがあるため、forceを指定した場合だけ変更する
+	BootstrapSchema(parentPageID string, force bool) (*BootstrapResult, error)
+}
+
+// BootstrapResult は、BootstrapSchemaで行った変更
+type BootstrapResult struct {
+	// CreatedDatabases は、新規作成したデータベースの用途とID
+	CreatedDatabases map[string]string
+	// Changes は、既存のデータベースに対して行った変更の説明
+	Changes []string
+}
+
+// SchemaError は、データベースのプロパティ構成の不備をまとめたエラー
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return "notion schema mismatch:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type notionPropertySpec struct {
+	name       string
+	configType notionapi.PropertyConfigType
+}
+
+type notionDatabaseSpec struct {
+	label      string
+	title      string
+	databaseID string
+	properties []notionPropertySpec
+}
+
+// databaseSpecs は、リポジトリが読み書きするプロパティの一覧を返す
+func (k *kaimemoRepository) databaseSpecs() []notionDatabaseSpec {
+	inputNames := k.properties.Input
+	summaryNames := k.properties.Summary
+	input := notionDatabaseSpec{
+		label:      "kaimemo input",
+		title:      "買い物メモ",
+		databaseID: k.databaseKaimemoInputID,
+		properties: []notionPropertySpec{
+			{name: inputNames.TempUserID, configType: notionapi.PropertyConfigTypeRichText},
+			{name: inputNames.Name, configType: notionapi.PropertyConfigTypeTitle},
+			{name: inputNames.Tag, configType: notionapi.PropertyConfigTypeSelect},
+			{name: inputNames.Done, configType: notionapi.PropertyConfigTypeCheckbox},
+		},
+	}
+	summary := notionDatabaseSpec{
+		label:      "kaimemo summary record",
+		title:      "買い物集計",
+		databaseID: k.databaseKaimemoSummaryRecordID,
+		properties: []notionPropertySpec{
+			{name: summaryNames.TempUserID, configType: notionapi.PropertyConfigTypeRichText},
+			{name: summaryNames.Date, configType: notionapi.PropertyConfigTypeTitle},
+			{name: summaryNames.Tag, configType: notionapi.PropertyConfigTypeSelect},
+			{name: summaryNames.Amount, configType: notionapi.PropertyConfigTypeNumber},
+		},
+	}
+
+	if k.userPropertyType == UserPropertySelect {
+		input.properties = append(input.properties, notionPropertySpec{name: inputNames.UserKey, configType: notionapi.PropertyConfigTypeSelect})
+		summary.properties = append(summary.properties, notionPropertySpec{name: summaryNames.UserKey, configType: notionapi.PropertyConfigTypeSelect})
+	}
+	return []notionDatabaseSpec{input, summary}
+}
+
+// ValidateSchema implements SchemaManager.
+func (k *kaimemoRepository) ValidateSchema() error {
+	return validateDatabases(k.client, k.databaseSpecs())
+}
+
+// validateDatabases は、specsのデータベースのプロパティ構成を検証する。
+// データベースが見つからない場合やプロパティの不備はSchemaErrorで返す。
+// 通信の失敗やレート制限・Notion側の障害で取得できない場合は、SchemaErrorではないエラーを返す
+func validateDatabases(client *notionapi.Client, specs []notionDatabaseSpec) error {
+	var problems []string
+
+	for _, spec := range specs {
+		database, err := client.Database.Get(context.Background(), notionapi.DatabaseID(spec.databaseID))
+		if err != nil && !isDefiniteNotionError(err) {
+			log.Printf("failed to notion get database: %v", err)
+			return fmt.Errorf("%s database (%s): failed to fetch: %w", spec.label, spec.databaseID, err)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s database (%s): failed to fetch: %v", spec.label, spec.databaseID, err))
+			continue
+		}
+
+		for _, property := range spec.properties {
+			config, ok := database.Properties[property.name]
+			if !ok {
+				problem := fmt.Sprintf("%s database (%s): property %q is missing (expected %s)", spec.label, spec.databaseID, property.name, property.configType)
+				if candidate := renameCandidate(spec, database.Properties, property.configType); candidate != "" {
+					problem += fmt.Sprintf("; rename %q to %q or map it in NOTION_PROPERTY_MAPPING", candidate, property.name)
+				}
+				problems = append(problems, problem)
+				continue
+			}
+			if config.GetType() != property.configType {
+				problems = append(problems, fmt.Sprintf("%s database (%s): property %q is %s (expected %s)", spec.label, spec.databaseID, property.name, config.GetType(), property.configType))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &SchemaError{Problems: problems}
+	}
+	return nil
+}
+
+// isDefiniteNotionError は、再試行しても変わらない失敗（データベースが見つからない・共有されていないなど）かを返す
+func isDefiniteNotionError(err error) bool {
+	var notionErr *notionapi.Error
+	if !errors.As(err, &notionErr) {
+		return false
+	}
+	return notionErr.Status >= 400 && notionErr.Status < 500 && notionErr.Status != http.StatusTooManyRequests
+}
+
+// renameCandidate は、specのどのプロパティにも使われていないconfigTypeのプロパティが1つだけあれば、その名前を返す。
+// 名前の異なる既存のプロパティ（以前の完了のチェックボックスなど）を使い続けられるよう、不備の説明に添える
+func renameCandidate(spec notionDatabaseSpec, properties notionapi.PropertyConfigs, configType notionapi.PropertyConfigType) string {
+	used := map[string]bool{}
+	for _, property := range spec.properties {
+		used[property.name] = true
+	}
+
+	var candidates []string
+	for name, config := range properties {
+		if !used[name] && config.GetType() == configType {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) != 1 {
+		return ""
+	}
+	return candidates[0]
+}
+
+// BootstrapSchema implements SchemaManager.
+// 変更できない不備が1つでもある場合は、どのデータベースも変更せずにSchemaErrorを返す
+func (k *kaimemoRepository) BootstrapSchema(parentPageID string, force bool) (*BootstrapResult, error) {
+	result := &BootstrapResult{CreatedDatabases: map[string]string{}}
+
+	specs := k.databaseSpecs()
+	patches := make([]*databasePatch, len(specs))
+	var problems []string
+	for i, spec := range specs {
+		if spec.databaseID == "" {
+			if parentPageID == "" {
+				return result, fmt.Errorf("%s database: database id is not set and no parent page is given", spec.label)
+			}
+			continue
+		}
+		patch, err := k.planDatabasePatch(spec, force)
+		if err != nil {
+			return result, err
+		}
+		patches[i] = patch
+		problems = append(problems, patch.problems...)
+	}
+	if len(problems) > 0 {
+		return result, &SchemaError{Problems: problems}
+	}
+
+	for i, spec := range specs {
+		if patches[i] == nil {
+			id, err := k.createDatabase(spec, parentPageID)
+			if err != nil {
+				return result, err
+			}
+			result.CreatedDatabases[spec.label] = id
+			continue
+		}
+
+		if err := k.patchDatabase(spec, patches[i]); err != nil {
+			return result, err
+		}
+		result.Changes = append(result.Changes, patches[i].changes...)
+	}
+
+	return result, nil
+}
+
+func (k *kaimemoRepository) createDatabase(spec notionDatabaseSpec, parentPageID string) (string, error) {
+	properties := notionapi.PropertyConfigs{}
+	for _, property := range spec.properties {
+		properties[property.name] = newPropertyConfig(property.configType)
+	}
+
+	database, err := k.client.Database.Create(context.Background(), &notionapi.DatabaseCreateRequest{
+		Parent: notionapi.Parent{
+			Type:   notionapi.ParentTypePageID,
+			PageID: notionapi.PageID(parentPageID),
+		},
+		Title: []notionapi.RichText{
+			{
+				Text: &notionapi.Text{
+					Content: spec.title,
+				},
+			},
+		},
+		Properties: properties,
+	})
+	if err != nil {
+		log.Printf("failed to notion create database: %v", err)
+		return "", err
+	}
+	return string(database.ID), nil
+}
+
+// databasePatch は、既存のデータベースに対して行う変更
+type databasePatch struct {
+	properties notionapi.PropertyConfigs
+	changes    []string
+	// problems は、変更できないために修正を見送ったプロパティの説明
+	problems []string
+}
+
+// planDatabasePatch は、不足しているプロパティの追加と、型の異なるプロパティの変更を組み立てる。
+// 型の変更はforceを指定した場合だけ行う。タイトルの名前の変更は、変更後の名前が使われていない場合だけ行う
+func (k *kaimemoRepository) planDatabasePatch(spec notionDatabaseSpec, force bool) (*databasePatch, error) {
+	database, err := k.client.Database.Get(context.Background(), notionapi.DatabaseID(spec.databaseID))
+	if err != nil {
+		log.Printf("failed to notion get database: %v", err)
+		return nil, err
+	}
+
+	patch := &databasePatch{properties: notionapi.PropertyConfigs{}}
+	for _, property := range spec.properties {
+		config, ok := database.Properties[property.name]
+		switch {
+		case ok && config.GetType() == property.configType:
+			continue
+		case property.configType == notionapi.PropertyConfigTypeTitle:
+			// タイトルはデータベースに1つだけのため、既存のタイトルの名前を変更する
+			current := titlePropertyName(database.Properties)
+			if current == "" {
+				return nil, fmt.Errorf("%s database (%s): title property not found", spec.label, spec.databaseID)
+			}
+			if ok {
+				patch.problems = append(patch.problems, fmt.Sprintf("%s database (%s): cannot rename title %q to %q because property %q already exists as %s; rename or remove it first", spec.label, spec.databaseID, current, property.name, property.name, config.GetType()))
+				continue
+			}
+			patch.properties[current] = renamePropertyConfig{Name: property.name}
+			patch.changes = append(patch.changes, fmt.Sprintf("%s: rename title %q to %q", spec.label, current, property.name))
+		case ok && config.GetType() == notionapi.PropertyConfigTypeTitle:
+			// タイトルの型は変更できないため、別のプロパティをタイトルにしてから名前を空ける必要がある
+			patch.problems = append(patch.problems, fmt.Sprintf("%s database (%s): property %q is the title (expected %s); rename it first", spec.label, spec.databaseID, property.name, property.configType))
+		case ok && !force:
+			patch.problems = append(patch.problems, fmt.Sprintf("%s database (%s): property %q is %s (expected %s); rerun with --force to change its type, existing values may be lost", spec.label, spec.databaseID, property.name, config.GetType(), property.configType))
+		case ok:
+			patch.properties[property.name] = newPropertyConfig(property.configType)
+			patch.changes = append(patch.changes, fmt.Sprintf("%s: change %q from %s to %s", spec.label, property.name, config.GetType(), property.configType))
+		default:
+			patch.properties[property.name] = newPropertyConfig(property.configType)
+			patch.changes = append(patch.changes, fmt.Sprintf("%s: add %q (%s)", spec.label, property.name, property.configType))
+		}
+	}
+	sort.Strings(patch.changes)
+	return patch, nil
+}
+
+// patchDatabase は、planDatabasePatchで組み立てた変更をデータベースに反映する
+func (k *kaimemoRepository) patchDatabase(spec notionDatabaseSpec, patch *databasePatch) error {
+	if len(patch.properties) == 0 {
+		return nil
+	}
+
+	_, err := k.client.Database.Update(context.Background(), notionapi.DatabaseID(spec.databaseID), &notionapi.DatabaseUpdateRequest{
+		Properties: patch.properties,
+	})
+	if err != nil {
+		log.Printf("failed to notion update database: %v", err)
+		return err
+	}
+	return nil
+}
+
+// renamePropertyConfig は、プロパティの名前だけを変更するリクエスト
+type renamePropertyConfig struct {
+	Name string `json:"name"`
+}
+
+func (p renamePropertyConfig) GetType() notionapi.PropertyConfigType {
+	return ""
+}
+
+func (p renamePropertyConfig) GetID() notionapi.PropertyID {
+	return ""
+}
+
+func titlePropertyName(properties notionapi.PropertyConfigs) string {
+	for name, config := range properties {
+		if config.GetType() == notionapi.PropertyConfigTypeTitle {
+			return name
+		}
+	}
+	return ""
+}
+
+func newPropertyConfig(configType notionapi.PropertyConfigType) notionapi.PropertyConfig {
+	switch configType {
+	case notionapi.PropertyConfigTypeTitle:
+		return notionapi.TitlePropertyConfig{Type: configType}
+	case notionapi.PropertyConfigTypeSelect:
+		return notionapi.SelectPropertyConfig{Type: configType, Select: notionapi.Select{Options: []notionapi.Option{}}}
+	case notionapi.PropertyConfigTypeNumber:
+		return notionapi.NumberPropertyConfig{Type: configType, Number: notionapi.NumberFormat{Format: notionapi.FormatNumber}}
+	case notionapi.PropertyConfigTypeCheckbox:
+		return notionapi.CheckboxPropertyConfig{Type: configType}
+	default:
+		return notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+	}
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jomei/notionapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaStubHandler は、databasesのプロパティ構成を返し、更新・作成リクエストを記録するスタブ
+func schemaStubHandler(t *testing.T, databases map[string]notionapi.PropertyConfigs, updates map[string]map[string]json.RawMessage, created *[]map[string]json.RawMessage) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/databases/{id}", func(w http.ResponseWriter, r *http.Request) {
+		properties, ok := databases[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Error{Object: notionapi.ObjectTypeError, Status: http.StatusNotFound, Message: "database not found"}))
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Database{Object: notionapi.ObjectTypeDatabase, Properties: properties}))
+	})
+	mux.HandleFunc("PATCH /v1/databases/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		updates[r.PathValue("id")] = req.Properties
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Database{Object: notionapi.ObjectTypeDatabase}))
+	})
+	mux.HandleFunc("POST /v1/databases", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Parent     notionapi.Parent           `json:"parent"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		assert.Equal(t, notionapi.PageID("parent-page"), req.Parent.PageID)
+		*created = append(*created, req.Properties)
+		assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Database{Object: notionapi.ObjectTypeDatabase, ID: "created-db"}))
+	})
+	return mux
+}
+
+func validInputProperties() notionapi.PropertyConfigs {
+	return notionapi.PropertyConfigs{
+		"tempUserID": &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+		"name":       &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+		"tag":        &notionapi.SelectPropertyConfig{Type: notionapi.PropertyConfigTypeSelect},
+		"done":       &notionapi.CheckboxPropertyConfig{Type: notionapi.PropertyConfigTypeCheckbox},
+	}
+}
+
+func validSummaryProperties() notionapi.PropertyConfigs {
+	return notionapi.PropertyConfigs{
+		"tempUserID": &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+		"date":       &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+		"tag":        &notionapi.SelectPropertyConfig{Type: notionapi.PropertyConfigTypeSelect},
+		"amount":     &notionapi.NumberPropertyConfig{Type: notionapi.PropertyConfigTypeNumber},
+	}
+}
+
+func TestKaimemoRepository_ValidateSchema(t *testing.T) {
+	t.Run("valid schema", func(t *testing.T) {
+		databases := map[string]notionapi.PropertyConfigs{
+			"input-db":   validInputProperties(),
+			"summary-db": validSummaryProperties(),
+		}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, nil, nil))
+
+		assert.NoError(t, repo.ValidateSchema())
+	})
+
+	t.Run("missing and wrong-typed properties", func(t *testing.T) {
+		input := validInputProperties()
+		delete(input, "done")
+		input["tag"] = &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+		databases := map[string]notionapi.PropertyConfigs{
+			"input-db":   input,
+			"summary-db": validSummaryProperties(),
+		}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, nil, nil), WithUserPropertyType(UserPropertySelect))
+
+		err := repo.ValidateSchema()
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, []string{
+			`kaimemo input database (input-db): property "tag" is rich_text (expected select)`,
+			`kaimemo input database (input-db): property "done" is missing (expected checkbox)`,
+			`kaimemo input database (input-db): property "userKey" is missing (expected select)`,
+			`kaimemo summary record database (summary-db): property "userKey" is missing (expected select)`,
+		}, schemaErr.Problems)
+	})
+
+	t.Run("database not found", func(t *testing.T) {
+		databases := map[string]notionapi.PropertyConfigs{
+			"input-db": validInputProperties(),
+		}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, nil, nil))
+
+		err := repo.ValidateSchema()
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		require.Len(t, schemaErr.Problems, 1)
+		assert.Contains(t, schemaErr.Problems[0], "kaimemo summary record database (summary-db): failed to fetch")
+	})
+
+	// 一時的な障害は、スキーマの不備として扱わない
+	t.Run("notion unavailable", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			assert.NoError(t, json.NewEncoder(w).Encode(notionapi.Error{Object: notionapi.ObjectTypeError, Status: http.StatusServiceUnavailable, Code: "service_unavailable"}))
+		})
+		repo := newStubNotionRepository(t, handler)
+
+		err := repo.ValidateSchema()
+		require.Error(t, err)
+		var schemaErr *SchemaError
+		assert.False(t, errors.As(err, &schemaErr))
+		assert.Contains(t, err.Error(), "kaimemo input database (input-db): failed to fetch")
+	})
+
+	t.Run("suggest renaming the only unused property of the type", func(t *testing.T) {
+		input := validInputProperties()
+		delete(input, "done")
+		input["購入済み"] = &notionapi.CheckboxPropertyConfig{Type: notionapi.PropertyConfigTypeCheckbox}
+		databases := map[string]notionapi.PropertyConfigs{
+			"input-db":   input,
+			"summary-db": validSummaryProperties(),
+		}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, nil, nil))
+
+		err := repo.ValidateSchema()
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, []string{
+			`kaimemo input database (input-db): property "done" is missing (expected checkbox); rename "購入済み" to "done" or map it in NOTION_PROPERTY_MAPPING`,
+		}, schemaErr.Problems)
+	})
+}
+
+func TestKaimemoRepository_BootstrapSchema(t *testing.T) {
+	t.Run("patch existing databases", func(t *testing.T) {
+		input := validInputProperties()
+		delete(input, "done")
+		delete(input, "name")
+		input["Name"] = &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle}
+		summary := validSummaryProperties()
+		summary["amount"] = &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+		databases := map[string]notionapi.PropertyConfigs{"input-db": input, "summary-db": summary}
+		updates := map[string]map[string]json.RawMessage{}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, updates, nil))
+
+		result, err := repo.BootstrapSchema("", true)
+		require.NoError(t, err)
+		assert.Empty(t, result.CreatedDatabases)
+		assert.Equal(t, []string{
+			`kaimemo input: add "done" (checkbox)`,
+			`kaimemo input: rename title "Name" to "name"`,
+			`kaimemo summary record: change "amount" from rich_text to number`,
+		}, result.Changes)
+
+		assert.JSONEq(t, `{"name":"name"}`, string(updates["input-db"]["Name"]))
+		assert.JSONEq(t, `{"type":"checkbox","checkbox":{}}`, string(updates["input-db"]["done"]))
+		assert.JSONEq(t, `{"type":"number","number":{"format":"number"}}`, string(updates["summary-db"]["amount"]))
+	})
+
+	t.Run("refuse to change types without force", func(t *testing.T) {
+		input := validInputProperties()
+		delete(input, "done")
+		summary := validSummaryProperties()
+		summary["amount"] = &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+		databases := map[string]notionapi.PropertyConfigs{"input-db": input, "summary-db": summary}
+		updates := map[string]map[string]json.RawMessage{}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, updates, nil))
+
+		result, err := repo.BootstrapSchema("", false)
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, []string{
+			`kaimemo summary record database (summary-db): property "amount" is rich_text (expected number); rerun with --force to change its type, existing values may be lost`,
+		}, schemaErr.Problems)
+		assert.Empty(t, result.Changes)
+		assert.Empty(t, updates)
+	})
+
+	t.Run("refuse to rename title onto an existing property", func(t *testing.T) {
+		input := validInputProperties()
+		delete(input, "name")
+		input["Name"] = &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle}
+		input["name"] = &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+		summary := validSummaryProperties()
+		delete(summary, "tempUserID")
+		summary["date"] = &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+		summary["tempUserID"] = &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle}
+		databases := map[string]notionapi.PropertyConfigs{"input-db": input, "summary-db": summary}
+		updates := map[string]map[string]json.RawMessage{}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, updates, nil))
+
+		_, err := repo.BootstrapSchema("", true)
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, []string{
+			`kaimemo input database (input-db): cannot rename title "Name" to "name" because property "name" already exists as rich_text; rename or remove it first`,
+			`kaimemo summary record database (summary-db): property "tempUserID" is the title (expected rich_text); rename it first`,
+			`kaimemo summary record database (summary-db): cannot rename title "tempUserID" to "date" because property "date" already exists as rich_text; rename or remove it first`,
+		}, schemaErr.Problems)
+		assert.Empty(t, updates)
+	})
+
+	t.Run("nothing to change", func(t *testing.T) {
+		databases := map[string]notionapi.PropertyConfigs{
+			"input-db":   validInputProperties(),
+			"summary-db": validSummaryProperties(),
+		}
+		updates := map[string]map[string]json.RawMessage{}
+		repo := newStubNotionRepository(t, schemaStubHandler(t, databases, updates, nil))
+
+		result, err := repo.BootstrapSchema("", false)
+		require.NoError(t, err)
+		assert.Empty(t, result.Changes)
+		assert.Empty(t, updates)
+	})
+
+	t.Run("create missing database", func(t *testing.T) {
+		var created []map[string]json.RawMessage
+		repo := newStubNotionRepository(t, schemaStubHandler(t, nil, nil, &created))
+		repo.databaseKaimemoInputID = ""
+		repo.databaseKaimemoSummaryRecordID = ""
+
+		result, err := repo.BootstrapSchema("parent-page", false)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"kaimemo input": "created-db", "kaimemo summary record": "created-db"}, result.CreatedDatabases)
+		require.Len(t, created, 2)
+		assert.Len(t, created[0], 4)
+		assert.JSONEq(t, `{"type":"title","title":{}}`, string(created[0]["name"]))
+		assert.JSONEq(t, `{"type":"number","number":{"format":"number"}}`, string(created[1]["amount"]))
+
+		_, err = repo.BootstrapSchema("", false)
+		assert.Error(t, err)
+	})
+}
+
+func TestKaimemoRepository_ValidateSchema_PropertyMapping(t *testing.T) {
+	databases := map[string]notionapi.PropertyConfigs{
+		"input-db": {
+			"ユーザー": &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			"品名":   &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+			"分類":   &notionapi.SelectPropertyConfig{Type: notionapi.PropertyConfigTypeSelect},
+			"購入済み": &notionapi.CheckboxPropertyConfig{Type: notionapi.PropertyConfigTypeCheckbox},
+		},
+		"summary-db": validSummaryProperties(),
+	}
+	mapping := NotionPropertyMapping{
+		Input: NotionInputProperties{TempUserID: "ユーザー", Name: "品名", Tag: "分類", Done: "購入済み"},
+	}
+	repo := newStubNotionRepository(t, schemaStubHandler(t, databases, nil, nil), WithPropertyMapping(mapping))
+
+	assert.NoError(t, repo.ValidateSchema())
+}
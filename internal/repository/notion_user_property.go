@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// ユーザーの絞り込みに使うプロパティの型
+const (
+	// UserPropertyRichText は、tempUserID（テキスト）の完全一致で絞り込む。従来のデータベースのまま使える
+	UserPropertyRichText = "rich_text"
+	// UserPropertySelect は、userKey（セレクト）で絞り込む。MigrateUserKeyで移行してから切り替える。
+	//
+	// セレクトの選択肢はデータベースのスキーマに保存されるため、次の点に注意する。
+	//   - ユーザーIDの一覧が、データベースを共有している人全員にプロパティの選択肢として見える
+	//   - 選択肢はユーザーが増えるたびに追加され、ページを削除しても減らない
+	//   - Notionは選択肢の名前にカンマを使えないため、カンマを含むユーザーIDはErrInvalidUserKeyとして登録しない
+	//
+	// これらが問題になる場合は、UserPropertyRichTextのまま使う。完全一致で絞り込むため、どちらでも他のユーザーのデータは返さない
+	UserPropertySelect = "select"
+)
+
+// userFilter は、ユーザーのレコードに完全一致で絞り込むフィルタを生成する
+func (k *kaimemoRepository) userFilter(user notionUserProperties, userID string) notionapi.Filter {
+	if k.userPropertyType == UserPropertySelect {
+		return &notionapi.PropertyFilter{
+			Property: user.userKey,
+			Select: &notionapi.SelectFilterCondition{
+				Equals: userID,
+			},
+		}
+	}
+
+	return &notionapi.PropertyFilter{
+		Property: user.userID,
+		RichText: &notionapi.TextFilterCondition{
+			Equals: userID,
+		},
+	}
+}
+
+// setUserProperties は、登録するページにユーザーのプロパティを設定する。
+// 移行期間中も読み戻せるよう、tempUserIDは常に書き込む
+func (k *kaimemoRepository) setUserProperties(properties notionapi.Properties, user notionUserProperties, userID string) error {
+	if k.userPropertyType == UserPropertySelect && !validUserKey(userID) {
+		return ErrInvalidUserKey
+	}
+
+	properties[user.userID] = &notionapi.RichTextProperty{
+		RichText: []notionapi.RichText{
+			{
+				Text: &notionapi.Text{
+					Content: userID,
+				},
+			},
+		},
+	}
+	if k.userPropertyType == UserPropertySelect {
+		properties[user.userKey] = &notionapi.SelectProperty{
+			Select: notionapi.Option{
+				Name: userID,
+			},
+		}
+	}
+	return nil
+}
+
+// validUserKey は、ユーザーIDをセレクトの選択肢の名前にできるか判定する
+func validUserKey(userID string) bool {
+	return !strings.Contains(userID, ",")
+}
+
+// pageUserID は、ページの所有者のユーザーIDを返す
+func (k *kaimemoRepository) pageUserID(page *notionapi.Page, user notionUserProperties) string {
+	if k.userPropertyType == UserPropertySelect {
+		prop, ok := page.Properties[user.userKey].(*notionapi.SelectProperty)
+		if !ok {
+			return ""
+		}
+		return prop.Select.Name
+	}
+	return richTextUserID(page, user)
+}
+
+// richTextUserID は、ページのtempUserIDプロパティの値を返す
+func richTextUserID(page *notionapi.Page, user notionUserProperties) string {
+	prop, ok := page.Properties[user.userID].(*notionapi.RichTextProperty)
+	if !ok {
+		return ""
+	}
+	return plainText(prop.RichText)
+}
+
+// UserKeyMigrator は、tempUserIDの値をuserKeyプロパティへ移行する。
+//
+// 移行手順:
+//  1. MigrateUserKeyを実行する（userKeyプロパティがなければ追加される）
+//  2. NOTION_USER_PROPERTY_TYPE=select に切り替えて再起動する
+//  3. 切り替えまでに登録されたページのため、もう一度MigrateUserKeyを実行する
+//
+// userKeyが設定済みのページは対象外のため、何度実行しても結果は変わらない。
+// tempUserIDが空のページと、セレクトの選択肢にできない（カンマを含む）ページは移行せずSkippedに数える
+type UserKeyMigrator interface {
+	MigrateUserKey() (*UserKeyMigrationResult, error)
+}
+
+// UserKeyMigrationResult は、MigrateUserKeyの実行結果
+type UserKeyMigrationResult struct {
+	Migrated int `json:"migrated"`
+	Skipped  int `json:"skipped"`
+}
+
+// MigrateUserKey implements UserKeyMigrator.
+func (k *kaimemoRepository) MigrateUserKey() (*UserKeyMigrationResult, error) {
+	result := &UserKeyMigrationResult{}
+
+	databases := []struct {
+		id   string
+		user notionUserProperties
+	}{
+		{id: k.databaseKaimemoInputID, user: k.properties.Input.user()},
+		{id: k.databaseKaimemoSummaryRecordID, user: k.properties.Summary.user()},
+	}
+
+	for _, database := range databases {
+		if err := k.ensureUserKeyProperty(database.id, database.user.userKey); err != nil {
+			return result, err
+		}
+
+		pages, err := k.queryAll(database.id, &notionapi.PropertyFilter{
+			Property: database.user.userKey,
+			Select: &notionapi.SelectFilterCondition{
+				IsEmpty: true,
+			},
+		})
+		if err != nil {
+			return result, err
+		}
+
+		for _, page := range pages {
+			userID := richTextUserID(&page, database.user)
+			if userID == "" {
+				result.Skipped++
+				continue
+			}
+			if !validUserKey(userID) {
+				log.Printf("skipped migrating page %s: user ID %q cannot be a select option", page.ID, userID)
+				result.Skipped++
+				continue
+			}
+
+			_, err := k.client.Page.Update(context.Background(), notionapi.PageID(page.ID), &notionapi.PageUpdateRequest{
+				Properties: notionapi.Properties{
+					database.user.userKey: &notionapi.SelectProperty{
+						Select: notionapi.Option{
+							Name: userID,
+						},
+					},
+				},
+			})
+			if err != nil {
+				log.Printf("failed to notion update page: %v", err)
+				return result, err
+			}
+			result.Migrated++
+		}
+	}
+
+	return result, nil
+}
+
+// ensureUserKeyProperty は、データベースにuserKeyプロパティがなければ追加する
+func (k *kaimemoRepository) ensureUserKeyProperty(databaseID string, userKey string) error {
+	database, err := k.client.Database.Get(context.Background(), notionapi.DatabaseID(databaseID))
+	if err != nil {
+		log.Printf("failed to notion get database: %v", err)
+		return err
+	}
+
+	if config, ok := database.Properties[userKey]; ok {
+		if config.GetType() != notionapi.PropertyConfigTypeSelect {
+			return fmt.Errorf("property %q of database %s must be select, got %s", userKey, databaseID, config.GetType())
+		}
+		return nil
+	}
+
+	_, err = k.client.Database.Update(context.Background(), notionapi.DatabaseID(databaseID), &notionapi.DatabaseUpdateRequest{
+		Properties: notionapi.PropertyConfigs{
+			userKey: notionapi.SelectPropertyConfig{
+				Type:   notionapi.PropertyConfigTypeSelect,
+				Select: notionapi.Select{Options: []notionapi.Option{}},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to notion update database: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"template-echo-notion-integration/internal/model"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// notionMaxTextLength は、Notionのリッチテキストの1要素に保存できる文字数
+const notionMaxTextLength = 2000
+
+// notionUserRepository は、Notionのデータベースに1利用者1ページで保存する。
+// 表示名をタイトル（name）、LINEのユーザーIDをuserId（テキスト）、アイコンをpictureUrl（URL）、
+// 連携したtempUserIDをlinkedTempUserIds（テキスト、改行区切り）、最終ログイン日時をlastLoginAt（日付）に保存する。
+// プロパティ名はWithPropertyMappingで変更できる。
+// linkedTempUserIdsは、1要素の文字数の上限を超えないよう複数の要素に分けて保存する
+type notionUserRepository struct {
+	client     *notionapi.Client
+	databaseID string
+	properties NotionUserProperties
+}
+
+// NewNotionUserRepository は、databaseIDのNotionデータベースに利用者を保存する
+func NewNotionUserRepository(apiKey string, databaseID string, opts ...NotionOption) UserRepository {
+	options := &notionOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	client := notionapi.NewClient(notionapi.Token(apiKey), options.clientOptions...)
+
+	return &notionUserRepository{client: client, databaseID: databaseID, properties: options.properties.withDefaults().Users}
+}
+
+// ValidateSchema implements SchemaValidator.
+func (n *notionUserRepository) ValidateSchema() error {
+	names := n.properties
+	return validateDatabases(n.client, []notionDatabaseSpec{
+		{
+			label:      "user",
+			title:      "利用者",
+			databaseID: n.databaseID,
+			properties: []notionPropertySpec{
+				{name: names.Name, configType: notionapi.PropertyConfigTypeTitle},
+				{name: names.UserID, configType: notionapi.PropertyConfigTypeRichText},
+				{name: names.PictureURL, configType: notionapi.PropertyConfigTypeURL},
+				{name: names.LinkedTempUserIDs, configType: notionapi.PropertyConfigTypeRichText},
+				{name: names.LastLoginAt, configType: notionapi.PropertyConfigTypeDate},
+			},
+		},
+	})
+}
+
+// UpsertUser implements UserRepository.
+func (n *notionUserRepository) UpsertUser(info UserInfo) (*model.User, error) {
+	page, err := n.findPage(info.UserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	names := n.properties
+	lastLoginAt := notionapi.Date(time.Now())
+	properties := notionapi.Properties{
+		names.Name: &notionapi.TitleProperty{
+			Title: []notionapi.RichText{{Text: &notionapi.Text{Content: info.DisplayName}}},
+		},
+		names.PictureURL: &notionapi.URLProperty{
+			URL: info.PictureURL,
+		},
+		names.LastLoginAt: &notionapi.DateProperty{
+			Date: &notionapi.DateObject{Start: &lastLoginAt},
+		},
+	}
+
+	if page == nil {
+		properties[names.UserID] = &notionapi.RichTextProperty{
+			RichText: []notionapi.RichText{{Text: &notionapi.Text{Content: info.UserID}}},
+		}
+		page, err = n.client.Page.Create(context.Background(), &notionapi.PageCreateRequest{
+			Parent: notionapi.Parent{
+				DatabaseID: notionapi.DatabaseID(n.databaseID),
+			},
+			Properties: properties,
+		})
+		if err != nil {
+			log.Printf("failed to notion create user page: %v", err)
+			return nil, err
+		}
+		return n.toUser(*page), nil
+	}
+
+	page, err = n.client.Page.Update(context.Background(), notionapi.PageID(page.ID), &notionapi.PageUpdateRequest{
+		Properties: properties,
+	})
+	if err != nil {
+		log.Printf("failed to notion update user page: %v", err)
+		return nil, err
+	}
+	return n.toUser(*page), nil
+}
+
+// FindUser implements UserRepository.
+func (n *notionUserRepository) FindUser(userID string) (*model.User, error) {
+	page, err := n.findPage(userID)
+	if err != nil {
+		return nil, err
+	}
+	return n.toUser(*page), nil
+}
+
+// LinkTempUserID implements UserRepository.
+// Notionには一意制約がないため、別の利用者への連携は事前の検索で確認する
+func (n *notionUserRepository) LinkTempUserID(userID string, tempUserID string) error {
+	// containsは部分一致のため、一致したすべてのページの値を改めて比較する
+	pages, err := queryAllPages(n.client, n.databaseID, notionapi.PropertyFilter{
+		Property: n.properties.LinkedTempUserIDs,
+		RichText: &notionapi.TextFilterCondition{
+			Contains: tempUserID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		linked := n.toUser(page)
+		if !slices.Contains(linked.LinkedTempUserIDs, tempUserID) {
+			continue
+		}
+		if linked.ID != userID {
+			return ErrForbidden
+		}
+		return nil
+	}
+
+	page, err := n.findPage(userID)
+	if err != nil {
+		return err
+	}
+	linkedTempUserIDs := append(n.toUser(*page).LinkedTempUserIDs, tempUserID)
+	_, err = n.client.Page.Update(context.Background(), notionapi.PageID(page.ID), &notionapi.PageUpdateRequest{
+		Properties: notionapi.Properties{
+			n.properties.LinkedTempUserIDs: &notionapi.RichTextProperty{
+				RichText: joinTempUserIDs(linkedTempUserIDs),
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to notion update user page: %v", err)
+		return err
+	}
+	return nil
+}
+
+// findPage は、userIDのページを返す。同時のログインで重複して作成された場合は、最も古いページを使う
+func (n *notionUserRepository) findPage(userID string) (*notionapi.Page, error) {
+	resp, err := n.client.Database.Query(context.Background(), notionapi.DatabaseID(n.databaseID), &notionapi.DatabaseQueryRequest{
+		Filter: notionapi.PropertyFilter{
+			Property: n.properties.UserID,
+			RichText: &notionapi.TextFilterCondition{
+				Equals: userID,
+			},
+		},
+		Sorts: []notionapi.SortObject{
+			{Timestamp: notionapi.TimestampCreated, Direction: notionapi.SortOrderASC},
+		},
+		PageSize: 1,
+	})
+	if err != nil {
+		log.Printf("failed to notion query users: %v", err)
+		return nil, err
+	}
+	if len(resp.Results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &resp.Results[0], nil
+}
+
+func (n *notionUserRepository) toUser(page notionapi.Page) *model.User {
+	names := n.properties
+	user := &model.User{LinkedTempUserIDs: []string{}, CreatedAt: page.CreatedTime}
+	if prop, ok := page.Properties[names.UserID].(*notionapi.RichTextProperty); ok {
+		user.ID = plainText(prop.RichText)
+	}
+	if prop, ok := page.Properties[names.Name].(*notionapi.TitleProperty); ok {
+		user.DisplayName = plainText(prop.Title)
+	}
+	if prop, ok := page.Properties[names.PictureURL].(*notionapi.URLProperty); ok {
+		user.PictureURL = prop.URL
+	}
+	if prop, ok := page.Properties[names.LinkedTempUserIDs].(*notionapi.RichTextProperty); ok {
+		user.LinkedTempUserIDs = splitTempUserIDs(plainText(prop.RichText))
+	}
+	if prop, ok := page.Properties[names.LastLoginAt].(*notionapi.DateProperty); ok && prop.Date != nil && prop.Date.Start != nil {
+		user.LastLoginAt = time.Time(*prop.Date.Start)
+	}
+	return user
+}
+
+// joinTempUserIDs は、tempUserIDを改行区切りにし、notionMaxTextLength以内の要素に分ける。
+// 1つのtempUserIDが要素をまたがないよう、区切りの改行ごとに分ける
+func joinTempUserIDs(ids []string) []notionapi.RichText {
+	texts := []notionapi.RichText{}
+	var content strings.Builder
+	for _, id := range ids {
+		line := id + "\n"
+		if content.Len() > 0 && content.Len()+len(line) > notionMaxTextLength {
+			texts = append(texts, notionapi.RichText{Text: &notionapi.Text{Content: content.String()}})
+			content.Reset()
+		}
+		content.WriteString(line)
+	}
+	if content.Len() > 0 {
+		texts = append(texts, notionapi.RichText{Text: &notionapi.Text{Content: content.String()}})
+	}
+	return texts
+}
+
+// splitTempUserIDs は、改行区切りのtempUserIDを重複のない昇順の一覧にする
+func splitTempUserIDs(value string) []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, id := range strings.Split(value, "\n") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,92 @@
+//go:generate mockgen -source=$GOFILE -destination=../mock/$GOPACKAGE/mock_$GOFILE -package=mock
+package repository
+
+import (
+	"sync"
+	"template-echo-notion-integration/internal/model"
+	"time"
+)
+
+// SessionStore は、LINEログインのセッションの保存先。
+// 期限切れの判定と延長はservice.SessionManagerが行い、保存先は期限をそのまま保存する
+type SessionStore interface {
+	// SaveSession は、セッションを保存する。同じIDがあれば上書きする
+	SaveSession(session model.Session) error
+	// FindSession は、セッションを返す。存在しない場合はErrNotFoundを返す
+	FindSession(id string) (*model.Session, error)
+	// ExtendSession は、既存のセッションの期限をexpiresAtにする。
+	// ログアウトや期限切れで削除されたセッションを作り直さないよう、存在しない場合はErrNotFoundを返す
+	ExtendSession(id string, expiresAt time.Time) error
+	DeleteSession(id string) error
+	// DeleteExpiredSessions は、now以前に期限が切れたセッションを削除し、その件数を返す
+	DeleteExpiredSessions(now time.Time) (int, error)
+}
+
+// memorySessionStore は、再起動で消えるインメモリ実装
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]model.Session
+}
+
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: make(map[string]model.Session)}
+}
+
+// SaveSession implements SessionStore.
+func (m *memorySessionStore) SaveSession(session model.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+// FindSession implements SessionStore.
+func (m *memorySessionStore) FindSession(id string) (*model.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+// ExtendSession implements SessionStore.
+func (m *memorySessionStore) ExtendSession(id string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	session.ExpiresAt = expiresAt
+	m.sessions[id] = session
+	return nil
+}
+
+// DeleteSession implements SessionStore.
+func (m *memorySessionStore) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// DeleteExpiredSessions implements SessionStore.
+func (m *memorySessionStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, session := range m.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
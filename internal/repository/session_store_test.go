@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"path/filepath"
+	"sync"
+	"template-echo-notion-integration/internal/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSessionStore は、SessionStoreの振る舞いを実装ごとに検証する
+func testSessionStore(t *testing.T, store SessionStore) {
+	t.Helper()
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	session := model.Session{ID: "session-1", UserID: "line-user-1", ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, store.SaveSession(session))
+	require.NoError(t, store.SaveSession(model.Session{ID: "session-2", UserID: "line-user-2", ExpiresAt: now.Add(-time.Minute)}))
+
+	res, err := store.FindSession("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, session.UserID, res.UserID)
+	assert.True(t, session.ExpiresAt.Equal(res.ExpiresAt))
+
+	// 同じIDで保存すると期限を延長できる
+	session.ExpiresAt = now.Add(2 * time.Hour)
+	require.NoError(t, store.SaveSession(session))
+	res, err = store.FindSession("session-1")
+	require.NoError(t, err)
+	assert.True(t, session.ExpiresAt.Equal(res.ExpiresAt))
+
+	// 期限の延長は既存のセッションだけを更新する
+	session.ExpiresAt = now.Add(3 * time.Hour)
+	require.NoError(t, store.ExtendSession("session-1", session.ExpiresAt))
+	res, err = store.FindSession("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, session.UserID, res.UserID)
+	assert.True(t, session.ExpiresAt.Equal(res.ExpiresAt))
+	assert.ErrorIs(t, store.ExtendSession("unknown", now.Add(time.Hour)), ErrNotFound)
+
+	_, err = store.FindSession("unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	n, err := store.DeleteExpiredSessions(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = store.FindSession("session-2")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.DeleteSession("session-1"))
+	_, err = store.FindSession("session-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.DeleteSession("session-1"))
+
+	// 複数のリクエストから同時に使われる
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := []string{"session-a", "session-b"}[i%2]
+			assert.NoError(t, store.SaveSession(model.Session{ID: id, UserID: "line-user-1", ExpiresAt: now.Add(time.Hour)}))
+			_, err := store.FindSession(id)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore())
+}
+
+func TestSQLiteSessionStore(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "kaimemo.db"))
+	require.NoError(t, err)
+	testSessionStore(t, store)
+}
+
+func TestSQLiteSessionStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kaimemo.db")
+
+	// 買い物メモと同じファイルに保存できる
+	_, err := NewSQLiteRepository(path)
+	require.NoError(t, err)
+	store, err := NewSQLiteSessionStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveSession(model.Session{ID: "session-1", UserID: "line-user-1", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	reopened, err := NewSQLiteSessionStore(path)
+	require.NoError(t, err)
+	res, err := reopened.FindSession("session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-1", res.UserID)
+}
@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"template-echo-notion-integration/internal/model"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema は、Notionの2つのデータベースに相当するテーブル定義
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS kaimemo (
+	id           TEXT PRIMARY KEY,
+	temp_user_id TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	tag          TEXT NOT NULL DEFAULT '',
+	done         INTEGER NOT NULL DEFAULT 0,
+	archived     INTEGER NOT NULL DEFAULT 0,
+	version      INTEGER NOT NULL DEFAULT 1,
+	created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_kaimemo_temp_user_id ON kaimemo (temp_user_id, archived);
+
+CREATE TABLE IF NOT EXISTS kaimemo_amount (
+	id           TEXT PRIMARY KEY,
+	temp_user_id TEXT NOT NULL,
+	date         TEXT NOT NULL,
+	tag          TEXT NOT NULL DEFAULT '',
+	amount       INTEGER NOT NULL DEFAULT 0,
+	archived     INTEGER NOT NULL DEFAULT 0,
+	created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_kaimemo_amount_temp_user_id ON kaimemo_amount (temp_user_id, archived);
+`
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+// FetchKaimemoAmountRecords implements KaimemoRepository.
+func (s *sqliteRepository) FetchKaimemoAmountRecords(userID string) (*model.KaimemoAmountRecords, error) {
+	return queryKaimemoAmountRecords(s.db, userID)
+}
+
+// sqliteQueryer は、*sql.DBと*sql.Txに共通の検索
+type sqliteQueryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// queryKaimemoAmountRecords は、userIDの金額レコードをqから読む
+func queryKaimemoAmountRecords(q sqliteQueryer, userID string) (*model.KaimemoAmountRecords, error) {
+	rows, err := q.Query(
+		`SELECT id, date, tag, amount FROM kaimemo_amount WHERE temp_user_id = ? AND archived = 0 ORDER BY rowid`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite query kaimemo_amount: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kaimemoAmounts []model.KaimemoAmount
+	for rows.Next() {
+		data := model.KaimemoAmount{}
+		if err := rows.Scan(&data.ID, &data.Date, &data.Tag, &data.Amount); err != nil {
+			log.Printf("failed to sqlite scan kaimemo_amount: %v", err)
+			return nil, err
+		}
+		kaimemoAmounts = append(kaimemoAmounts, data)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to sqlite iterate kaimemo_amount: %v", err)
+		return nil, err
+	}
+
+	return &model.KaimemoAmountRecords{
+		Records: kaimemoAmounts,
+	}, nil
+}
+
+// InsertKaimemoAmount implements KaimemoRepository.
+func (s *sqliteRepository) InsertKaimemoAmount(req model.CreateKaimemoAmountRequest) error {
+	_, err := s.db.Exec(
+		`INSERT INTO kaimemo_amount (id, temp_user_id, date, tag, amount) VALUES (?, ?, ?, ?, ?)`,
+		newRecordID(), req.TempUserID, req.Date, req.Tag, req.Amount,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite insert kaimemo_amount: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateKaimemoAmount implements KaimemoRepository.
+// 更新と更新後の金額レコードの読み出しは1つのトランザクションで行う。
+// 所有者の確認の後に削除された場合は更新せず、ErrNotFoundを返す
+func (s *sqliteRepository) UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (*model.KaimemoAmountRecords, error) {
+	if err := s.checkOwner("kaimemo_amount", id, req.TempUserID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to sqlite begin: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var updatedID string
+	err = tx.QueryRow(
+		`UPDATE kaimemo_amount SET date = ?, tag = ?, amount = ? WHERE id = ? AND temp_user_id = ? AND archived = 0 RETURNING id`,
+		req.Date, req.Tag, req.Amount, id, req.TempUserID,
+	).Scan(&updatedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Printf("failed to sqlite update kaimemo_amount: %v", err)
+		return nil, err
+	}
+
+	res, err := queryKaimemoAmountRecords(tx, req.TempUserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to sqlite commit: %v", err)
+		return nil, err
+	}
+	return res, nil
+}
+
+// RemoveKaimemoAmount implements KaimemoRepository.
+func (s *sqliteRepository) RemoveKaimemoAmount(id string, userID string) error {
+	if err := s.checkOwner("kaimemo_amount", id, userID); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(
+		`UPDATE kaimemo_amount SET archived = 1 WHERE id = ? AND temp_user_id = ?`,
+		id, userID,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite archive kaimemo_amount: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FetchKaimemo implements KaimemoRepository.
+func (s *sqliteRepository) FetchKaimemo(userID string) ([]model.KaimemoResponse, error) {
+	rows, err := s.db.Query(
+		`SELECT id, tag, name, done, version FROM kaimemo WHERE temp_user_id = ? AND archived = 0 ORDER BY rowid`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite query kaimemo: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kaimemoResponses []model.KaimemoResponse
+	for rows.Next() {
+		data := model.KaimemoResponse{}
+		if err := rows.Scan(&data.ID, &data.Tag, &data.Name, &data.Done, &data.Version); err != nil {
+			log.Printf("failed to sqlite scan kaimemo: %v", err)
+			return nil, err
+		}
+		kaimemoResponses = append(kaimemoResponses, data)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to sqlite iterate kaimemo: %v", err)
+		return nil, err
+	}
+
+	return kaimemoResponses, nil
+}
+
+// FetchKaimemoPage implements KaimemoRepository.
+func (s *sqliteRepository) FetchKaimemoPage(userID string, cursor string, limit int) (*model.KaimemoPage, error) {
+	afterRowID, err := decodeOffsetCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// 次ページの有無を判定するため、1件多く取得する
+	rows, err := s.db.Query(
+		`SELECT rowid, id, tag, name, done, version FROM kaimemo WHERE temp_user_id = ? AND archived = 0 AND rowid > ? ORDER BY rowid LIMIT ?`,
+		userID, afterRowID, limit+1,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite query kaimemo: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &model.KaimemoPage{Items: []model.KaimemoResponse{}}
+	var lastRowID int64
+	for rows.Next() {
+		if len(page.Items) == limit {
+			page.HasMore = true
+			break
+		}
+		data := model.KaimemoResponse{}
+		if err := rows.Scan(&lastRowID, &data.ID, &data.Tag, &data.Name, &data.Done, &data.Version); err != nil {
+			log.Printf("failed to sqlite scan kaimemo: %v", err)
+			return nil, err
+		}
+		page.Items = append(page.Items, data)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to sqlite iterate kaimemo: %v", err)
+		return nil, err
+	}
+	if page.HasMore {
+		page.NextCursor = encodeOffsetCursor(lastRowID)
+	}
+
+	return page, nil
+}
+
+// InsertKaimemo implements KaimemoRepository.
+func (s *sqliteRepository) InsertKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error) {
+	data := &model.KaimemoResponse{ID: newRecordID(), Tag: req.Tag, Name: req.Name, Version: "1"}
+	_, err := s.db.Exec(
+		`INSERT INTO kaimemo (id, temp_user_id, name, tag) VALUES (?, ?, ?, ?)`,
+		data.ID, req.TempUserID, req.Name, req.Tag,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite insert kaimemo: %v", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// UpdateKaimemo implements KaimemoRepository.
+func (s *sqliteRepository) UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error) {
+	if err := s.checkOwner("kaimemo", id, req.TempUserID); err != nil {
+		return nil, err
+	}
+
+	// nilの項目はCOALESCEで現在の値のまま残す。バージョンの確認と更新は1文で行う。
+	// 所有者の確認の後に削除された場合は更新せず、削除と同じくErrNotFoundを返す
+	data := model.KaimemoResponse{}
+	err := s.db.QueryRow(
+		`UPDATE kaimemo SET name = COALESCE(?, name), tag = COALESCE(?, tag), done = COALESCE(?, done), version = version + 1
+		WHERE id = ? AND temp_user_id = ? AND archived = 0 AND (? = '' OR version = ?) RETURNING id, tag, name, done, version`,
+		req.Name, req.Tag, req.Done, id, req.TempUserID, req.IfMatch, req.IfMatch,
+	).Scan(&data.ID, &data.Tag, &data.Name, &data.Done, &data.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, s.conflict(id)
+	}
+	if err != nil {
+		log.Printf("failed to sqlite update kaimemo: %v", err)
+		return nil, err
+	}
+	return &data, nil
+}
+
+// RemoveKaimemo implements KaimemoRepository.
+func (s *sqliteRepository) RemoveKaimemo(id string, userID string, ifMatch string) error {
+	if err := s.checkOwner("kaimemo", id, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(
+		`UPDATE kaimemo SET archived = 1, version = version + 1 WHERE id = ? AND temp_user_id = ? AND archived = 0 AND (? = '' OR version = ?)`,
+		id, userID, ifMatch, ifMatch,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite archive kaimemo: %v", err)
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return s.conflict(id)
+	}
+	return nil
+}
+
+// ReassignUser implements KaimemoRepository.
+// 買い物メモと集計を1つのトランザクションで付け替える
+func (s *sqliteRepository) ReassignUser(fromUserID string, toUserID string) (*UserMigrationResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to sqlite begin: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &UserMigrationResult{}
+	for _, target := range []struct {
+		table    string
+		migrated *int
+	}{
+		{table: "kaimemo", migrated: &result.Items},
+		{table: "kaimemo_amount", migrated: &result.Amounts},
+	} {
+		res, err := tx.Exec(
+			`UPDATE `+target.table+` SET temp_user_id = ? WHERE temp_user_id = ? AND archived = 0`,
+			toUserID, fromUserID,
+		)
+		if err != nil {
+			log.Printf("failed to sqlite update %s: %v", target.table, err)
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		*target.migrated = int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to sqlite commit: %v", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// conflict は、条件付きの更新で対象がなかったときに、現在の状態を持つ*ConflictErrorを返す。
+// 確認の後に削除されていた場合はErrNotFoundを返す
+func (s *sqliteRepository) conflict(id string) error {
+	current := model.KaimemoResponse{}
+	err := s.db.QueryRow(
+		`SELECT id, tag, name, done, version FROM kaimemo WHERE id = ? AND archived = 0`,
+		id,
+	).Scan(&current.ID, &current.Tag, &current.Name, &current.Done, &current.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		log.Printf("failed to sqlite query kaimemo: %v", err)
+		return err
+	}
+	return &ConflictError{Current: &current}
+}
+
+// checkOwner は、tableのレコードが存在し、userIDのものであることを確認する
+func (s *sqliteRepository) checkOwner(table string, id string, userID string) error {
+	var owner string
+	err := s.db.QueryRow(
+		`SELECT temp_user_id FROM `+table+` WHERE id = ? AND archived = 0`,
+		id,
+	).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		log.Printf("failed to sqlite query %s: %v", table, err)
+		return err
+	}
+	if owner != userID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// NewSQLiteRepository は、指定したパスのSQLiteファイルを開き、スキーマを作成する
+func NewSQLiteRepository(path string) (KaimemoRepository, error) {
+	db, err := openSQLite(path, sqliteSchema)
+	if err != nil {
+		return nil, err
+	}
+	if err := addSQLiteColumn(db, "kaimemo", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite schema: %w", err)
+	}
+
+	return &sqliteRepository{db: db}, nil
+}
+
+// openSQLite は、pathのSQLiteを開き、schemaのテーブルを作成する。
+// 同じファイルを複数のリポジトリで開けるよう、WALと待ち時間を設定する
+func openSQLite(path string, schema string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite schema: %w", err)
+	}
+	return db, nil
+}
+
+// addSQLiteColumn は、既存のテーブルにcolumnがなければ追加する。CREATE TABLE IF NOT EXISTSでは列が増えないため
+func addSQLiteColumn(db *sql.DB, table string, column string, definition string) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// newRecordID は、SQLiteのレコードIDをランダムに生成する
+func newRecordID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
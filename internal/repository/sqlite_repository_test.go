@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"database/sql"
+	"path/filepath"
+	"template-echo-notion-integration/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteRepository(t *testing.T) KaimemoRepository {
+	t.Helper()
+
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "kaimemo.db"))
+	require.NoError(t, err)
+	return repo
+}
+
+func TestSQLiteRepository_Kaimemo(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "milk"})
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "daily", Name: "soap"})
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-2", Tag: "food", Name: "egg"})
+
+	res, err := repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "milk", res[0].Name)
+	assert.Equal(t, "food", res[0].Tag)
+	assert.False(t, res[0].Done)
+	assert.Equal(t, "soap", res[1].Name)
+
+	// 他のユーザーのIDではアーカイブされない
+	assert.ErrorIs(t, repo.RemoveKaimemo(res[0].ID, "user-2", ""), ErrForbidden)
+	res, err = repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+
+	assert.NoError(t, repo.RemoveKaimemo(res[0].ID, "user-1", ""))
+	assert.ErrorIs(t, repo.RemoveKaimemo(res[0].ID, "user-1", ""), ErrNotFound)
+	assert.ErrorIs(t, repo.RemoveKaimemo("unknown", "user-1", ""), ErrNotFound)
+	res, err = repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "soap", res[0].Name)
+}
+
+func TestSQLiteRepository_KaimemoAmount(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+
+	assert.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-15", Tag: "food", Amount: 1000}))
+	assert.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "transport", Amount: 2000}))
+	assert.NoError(t, repo.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-2", Date: "2023-05-16", Tag: "food", Amount: 3000}))
+
+	res, err := repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	require.Len(t, res.Records, 2)
+	assert.Equal(t, model.KaimemoAmount{ID: res.Records[0].ID, Date: "2023-05-15", Tag: "food", Amount: 1000}, res.Records[0])
+
+	assert.ErrorIs(t, repo.RemoveKaimemoAmount(res.Records[0].ID, "user-2"), ErrForbidden)
+	assert.NoError(t, repo.RemoveKaimemoAmount(res.Records[0].ID, "user-1"))
+	assert.ErrorIs(t, repo.RemoveKaimemoAmount(res.Records[0].ID, "user-1"), ErrNotFound)
+	res, err = repo.FetchKaimemoAmountRecords("user-1")
+	require.NoError(t, err)
+	require.Len(t, res.Records, 1)
+	assert.Equal(t, 2000, res.Records[0].Amount)
+}
+
+func TestSQLiteRepository_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kaimemo.db")
+
+	repo, err := NewSQLiteRepository(path)
+	require.NoError(t, err)
+	insertKaimemo(t, repo, model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "milk"})
+
+	reopened, err := NewSQLiteRepository(path)
+	require.NoError(t, err)
+	res, err := reopened.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+}
+
+func TestSQLiteRepository_MigrateVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kaimemo.db")
+
+	// version列を追加する前のテーブル
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE kaimemo (
+		id           TEXT PRIMARY KEY,
+		temp_user_id TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		tag          TEXT NOT NULL DEFAULT '',
+		done         INTEGER NOT NULL DEFAULT 0,
+		archived     INTEGER NOT NULL DEFAULT 0,
+		created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO kaimemo (id, temp_user_id, name, tag) VALUES ('old-1', 'user-1', 'milk', 'food');`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	repo, err := NewSQLiteRepository(path)
+	require.NoError(t, err)
+	res, err := repo.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{{ID: "old-1", Tag: "food", Name: "milk", Version: "1"}}, res)
+}
+
+func TestSQLiteRepository_KaimemoVersion(t *testing.T) {
+	testKaimemoVersion(t, newTestSQLiteRepository(t))
+}
+
+func TestSQLiteRepository_FetchKaimemoPage(t *testing.T) {
+	testFetchKaimemoPage(t, newTestSQLiteRepository(t))
+}
+
+func TestSQLiteRepository_UpdateKaimemo(t *testing.T) {
+	testUpdateKaimemo(t, newTestSQLiteRepository(t))
+}
+
+func TestSQLiteRepository_UpdateKaimemoAmount(t *testing.T) {
+	testUpdateKaimemoAmount(t, newTestSQLiteRepository(t))
+}
+
+func TestSQLiteRepository_ReassignUser(t *testing.T) {
+	testReassignUser(t, newTestSQLiteRepository(t))
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"template-echo-notion-integration/internal/model"
+	"time"
+)
+
+// sqliteSessionSchema は、セッションのテーブル定義。期限はUnix時間（ミリ秒）で保存する
+const sqliteSessionSchema = `
+CREATE TABLE IF NOT EXISTS session (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_session_expires_at ON session (expires_at);
+`
+
+// sqliteSessionStore は、再起動してもログインが続くSQLite実装
+type sqliteSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionStore は、pathのSQLiteにセッションを保存する。買い物メモと同じファイルを指定してもよい
+func NewSQLiteSessionStore(path string) (SessionStore, error) {
+	db, err := openSQLite(path, sqliteSessionSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteSessionStore{db: db}, nil
+}
+
+// SaveSession implements SessionStore.
+func (s *sqliteSessionStore) SaveSession(session model.Session) error {
+	_, err := s.db.Exec(
+		`INSERT INTO session (id, user_id, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, expires_at = excluded.expires_at`,
+		session.ID, session.UserID, session.ExpiresAt.UnixMilli(),
+	)
+	if err != nil {
+		log.Printf("failed to sqlite save session: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindSession implements SessionStore.
+func (s *sqliteSessionStore) FindSession(id string) (*model.Session, error) {
+	session := model.Session{ID: id}
+	var expiresAt int64
+	err := s.db.QueryRow(`SELECT user_id, expires_at FROM session WHERE id = ?`, id).Scan(&session.UserID, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Printf("failed to sqlite query session: %v", err)
+		return nil, err
+	}
+	session.ExpiresAt = time.UnixMilli(expiresAt)
+	return &session, nil
+}
+
+// ExtendSession implements SessionStore.
+func (s *sqliteSessionStore) ExtendSession(id string, expiresAt time.Time) error {
+	res, err := s.db.Exec(`UPDATE session SET expires_at = ? WHERE id = ?`, expiresAt.UnixMilli(), id)
+	if err != nil {
+		log.Printf("failed to sqlite extend session: %v", err)
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSession implements SessionStore.
+func (s *sqliteSessionStore) DeleteSession(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM session WHERE id = ?`, id); err != nil {
+		log.Printf("failed to sqlite delete session: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredSessions implements SessionStore.
+func (s *sqliteSessionStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM session WHERE expires_at <= ?`, now.UnixMilli())
+	if err != nil {
+		log.Printf("failed to sqlite delete expired sessions: %v", err)
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"template-echo-notion-integration/internal/model"
+	"time"
+)
+
+// sqliteUserSchema は、利用者と、連携したtempUserIDのテーブル定義。日時はUnix時間（ミリ秒）で保存する
+const sqliteUserSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	id            TEXT PRIMARY KEY,
+	display_name  TEXT NOT NULL DEFAULT '',
+	picture_url   TEXT NOT NULL DEFAULT '',
+	created_at    INTEGER NOT NULL,
+	last_login_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_link (
+	temp_user_id TEXT PRIMARY KEY,
+	user_id      TEXT NOT NULL REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_link_user_id ON user_link (user_id);
+`
+
+type sqliteUserRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewSQLiteUserRepository は、pathのSQLiteに利用者を保存する。買い物メモと同じファイルを指定してもよい
+func NewSQLiteUserRepository(path string) (UserRepository, error) {
+	db, err := openSQLite(path, sqliteUserSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteUserRepository{db: db, now: time.Now}, nil
+}
+
+// UpsertUser implements UserRepository.
+func (s *sqliteUserRepository) UpsertUser(info UserInfo) (*model.User, error) {
+	now := s.now().UnixMilli()
+	_, err := s.db.Exec(
+		`INSERT INTO users (id, display_name, picture_url, created_at, last_login_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET display_name = excluded.display_name, picture_url = excluded.picture_url, last_login_at = excluded.last_login_at`,
+		info.UserID, info.DisplayName, info.PictureURL, now, now,
+	)
+	if err != nil {
+		log.Printf("failed to sqlite upsert users: %v", err)
+		return nil, err
+	}
+	return s.FindUser(info.UserID)
+}
+
+// FindUser implements UserRepository.
+func (s *sqliteUserRepository) FindUser(userID string) (*model.User, error) {
+	user := model.User{ID: userID, LinkedTempUserIDs: []string{}}
+	var createdAt, lastLoginAt int64
+	err := s.db.QueryRow(
+		`SELECT display_name, picture_url, created_at, last_login_at FROM users WHERE id = ?`,
+		userID,
+	).Scan(&user.DisplayName, &user.PictureURL, &createdAt, &lastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Printf("failed to sqlite query users: %v", err)
+		return nil, err
+	}
+	user.CreatedAt = time.UnixMilli(createdAt)
+	user.LastLoginAt = time.UnixMilli(lastLoginAt)
+
+	rows, err := s.db.Query(`SELECT temp_user_id FROM user_link WHERE user_id = ? ORDER BY temp_user_id`, userID)
+	if err != nil {
+		log.Printf("failed to sqlite query user_link: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tempUserID string
+		if err := rows.Scan(&tempUserID); err != nil {
+			log.Printf("failed to sqlite scan user_link: %v", err)
+			return nil, err
+		}
+		user.LinkedTempUserIDs = append(user.LinkedTempUserIDs, tempUserID)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to sqlite iterate user_link: %v", err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkTempUserID implements UserRepository.
+// 同じtempUserIDの連携が同時に行われても、temp_user_idの一意制約で先に記録した利用者だけが連携できる
+func (s *sqliteUserRepository) LinkTempUserID(userID string, tempUserID string) error {
+	var exists int
+	err := s.db.QueryRow(`SELECT 1 FROM users WHERE id = ?`, userID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		log.Printf("failed to sqlite query users: %v", err)
+		return err
+	}
+
+	if _, err := s.db.Exec(
+		`INSERT INTO user_link (temp_user_id, user_id) VALUES (?, ?) ON CONFLICT (temp_user_id) DO NOTHING`,
+		tempUserID, userID,
+	); err != nil {
+		log.Printf("failed to sqlite insert user_link: %v", err)
+		return err
+	}
+
+	var linked string
+	if err := s.db.QueryRow(`SELECT user_id FROM user_link WHERE temp_user_id = ?`, tempUserID).Scan(&linked); err != nil {
+		log.Printf("failed to sqlite query user_link: %v", err)
+		return err
+	}
+	if linked != userID {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+//go:generate mockgen -source=$GOFILE -destination=../mock/$GOPACKAGE/mock_$GOFILE -package=mock
+package repository
+
+import (
+	"sort"
+	"sync"
+	"template-echo-notion-integration/internal/model"
+	"time"
+)
+
+// UserRepository は、LINEログインした利用者の保存先
+type UserRepository interface {
+	// UpsertUser は、LINEのプロフィールで利用者を登録・更新し、最終ログイン日時を記録する
+	UpsertUser(info UserInfo) (*model.User, error)
+	// FindUser は、利用者を返す。存在しない場合はErrNotFoundを返す
+	FindUser(userID string) (*model.User, error)
+	// LinkTempUserID は、tempUserIDを利用者のアカウントに連携したことを記録する。
+	// 連携済みなら何もしない。別の利用者に連携済みの場合はErrForbidden、利用者がいない場合はErrNotFoundを返す
+	LinkTempUserID(userID string, tempUserID string) error
+}
+
+// memoryUserRepository は、ローカル開発・結合テスト用のインメモリ実装
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]*model.User
+	// links は、tempUserIDごとの連携先のユーザーID
+	links map[string]string
+	now   func() time.Time
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{users: make(map[string]*model.User), links: make(map[string]string), now: time.Now}
+}
+
+// UpsertUser implements UserRepository.
+func (m *memoryUserRepository) UpsertUser(info UserInfo) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	user, ok := m.users[info.UserID]
+	if !ok {
+		user = &model.User{ID: info.UserID, LinkedTempUserIDs: []string{}, CreatedAt: now}
+		m.users[info.UserID] = user
+	}
+	user.DisplayName = info.DisplayName
+	user.PictureURL = info.PictureURL
+	user.LastLoginAt = now
+	return copyUser(user), nil
+}
+
+// FindUser implements UserRepository.
+func (m *memoryUserRepository) FindUser(userID string) (*model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+// LinkTempUserID implements UserRepository.
+func (m *memoryUserRepository) LinkTempUserID(userID string, tempUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if linked, ok := m.links[tempUserID]; ok {
+		if linked != userID {
+			return ErrForbidden
+		}
+		return nil
+	}
+	m.links[tempUserID] = userID
+	user.LinkedTempUserIDs = append(user.LinkedTempUserIDs, tempUserID)
+	return nil
+}
+
+// copyUser は、呼び出し元の変更が保存中の値に影響しないよう複製する
+func copyUser(user *model.User) *model.User {
+	res := *user
+	res.LinkedTempUserIDs = append([]string{}, user.LinkedTempUserIDs...)
+	sort.Strings(res.LinkedTempUserIDs)
+	return &res
+}
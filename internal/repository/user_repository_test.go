@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jomei/notionapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testUserRepository は、UserRepositoryの振る舞いを実装ごとに検証する
+func testUserRepository(t *testing.T, repo UserRepository) {
+	t.Helper()
+
+	_, err := repo.FindUser("line-user-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	created, err := repo.UpsertUser(UserInfo{UserID: "line-user-1", DisplayName: "Taro", PictureURL: "https://profile.line-scdn.net/taro"})
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-1", created.ID)
+	assert.Equal(t, "Taro", created.DisplayName)
+	assert.Equal(t, "https://profile.line-scdn.net/taro", created.PictureURL)
+	assert.Equal(t, []string{}, created.LinkedTempUserIDs)
+	assert.False(t, created.LastLoginAt.IsZero())
+
+	// 再ログインでプロフィールを更新し、登録日時は変えない
+	updated, err := repo.UpsertUser(UserInfo{UserID: "line-user-1", DisplayName: "Taro Yamada"})
+	require.NoError(t, err)
+	assert.Equal(t, "Taro Yamada", updated.DisplayName)
+	assert.Empty(t, updated.PictureURL)
+	assert.True(t, created.CreatedAt.Equal(updated.CreatedAt))
+	assert.False(t, updated.LastLoginAt.Before(created.LastLoginAt))
+
+	res, err := repo.FindUser("line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, updated.DisplayName, res.DisplayName)
+	assert.True(t, updated.LastLoginAt.Equal(res.LastLoginAt))
+
+	_, err = repo.UpsertUser(UserInfo{UserID: "line-user-2", DisplayName: "Hanako"})
+	require.NoError(t, err)
+	res, err = repo.FindUser("line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Taro Yamada", res.DisplayName)
+
+	// 連携は何度記録しても1件で、別の利用者には連携できない
+	require.NoError(t, repo.LinkTempUserID("line-user-1", "temp-b"))
+	require.NoError(t, repo.LinkTempUserID("line-user-1", "temp-a"))
+	require.NoError(t, repo.LinkTempUserID("line-user-1", "temp-a"))
+	assert.ErrorIs(t, repo.LinkTempUserID("line-user-2", "temp-a"), ErrForbidden)
+	assert.ErrorIs(t, repo.LinkTempUserID("line-user-unknown", "temp-c"), ErrNotFound)
+	require.NoError(t, repo.LinkTempUserID("line-user-2", "temp"))
+
+	res, err = repo.FindUser("line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temp-a", "temp-b"}, res.LinkedTempUserIDs)
+	assert.Equal(t, "Taro Yamada", res.DisplayName)
+
+	// 再ログインしても連携は残る
+	res, err = repo.UpsertUser(UserInfo{UserID: "line-user-1", DisplayName: "Taro"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temp-a", "temp-b"}, res.LinkedTempUserIDs)
+	res, err = repo.FindUser("line-user-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temp"}, res.LinkedTempUserIDs)
+}
+
+func TestMemoryUserRepository(t *testing.T) {
+	testUserRepository(t, NewMemoryUserRepository())
+}
+
+func TestSQLiteUserRepository(t *testing.T) {
+	repo, err := NewSQLiteUserRepository(filepath.Join(t.TempDir(), "kaimemo.db"))
+	require.NoError(t, err)
+	testUserRepository(t, repo)
+}
+
+func TestSQLiteUserRepository_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kaimemo.db")
+
+	// 買い物メモ・セッションと同じファイルに保存できる
+	_, err := NewSQLiteRepository(path)
+	require.NoError(t, err)
+	_, err = NewSQLiteSessionStore(path)
+	require.NoError(t, err)
+	repo, err := NewSQLiteUserRepository(path)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.UpsertUser(UserInfo{UserID: "line-user-1", DisplayName: fmt.Sprintf("Taro %d", i)})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	res, err := repo.FindUser("line-user-1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.DisplayName, "Taro "))
+}
+
+// stubUserRepository は、スタブのページをデフォルトのプロパティ名で読む
+var stubUserRepository = &notionUserRepository{properties: DefaultNotionPropertyMapping().Users}
+
+// stubNotionUsers は、Notionの利用者データベースのスタブ。デフォルトのプロパティ名だけを扱う
+type stubNotionUsers struct {
+	mu    sync.Mutex
+	pages []notionapi.Page
+}
+
+// stubUserProperties は、スタブが受け取るページ作成・更新のプロパティ
+type stubUserProperties struct {
+	Name *struct {
+		Title []notionapi.RichText `json:"title"`
+	} `json:"name"`
+	UserID *struct {
+		RichText []notionapi.RichText `json:"rich_text"`
+	} `json:"userId"`
+	PictureURL *struct {
+		URL string `json:"url"`
+	} `json:"pictureUrl"`
+	LinkedTempUserIDs *struct {
+		RichText []notionapi.RichText `json:"rich_text"`
+	} `json:"linkedTempUserIds"`
+	LastLoginAt *struct {
+		Date struct {
+			Start string `json:"start"`
+		} `json:"date"`
+	} `json:"lastLoginAt"`
+}
+
+func (s *stubNotionUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var req struct {
+		Filter struct {
+			Property string `json:"property"`
+			RichText struct {
+				Equals   string `json:"equals"`
+				Contains string `json:"contains"`
+			} `json:"rich_text"`
+		} `json:"filter"`
+		StartCursor string             `json:"start_cursor"`
+		PageSize    int                `json:"page_size"`
+		Properties  stubUserProperties `json:"properties"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/databases/users-db/query":
+		results := []notionapi.Page{}
+		for _, page := range s.pages {
+			user := stubUserRepository.toUser(page)
+			switch req.Filter.Property {
+			case stubUserRepository.properties.UserID:
+				if user.ID == req.Filter.RichText.Equals {
+					results = append(results, page)
+				}
+			case stubUserRepository.properties.LinkedTempUserIDs:
+				if strings.Contains(strings.Join(user.LinkedTempUserIDs, "\n"), req.Filter.RichText.Contains) {
+					results = append(results, page)
+				}
+			}
+		}
+		// start_cursorは、そこから返す位置とする
+		start := 0
+		if req.StartCursor != "" {
+			start, _ = strconv.Atoi(req.StartCursor)
+		}
+		results = results[min(start, len(results)):]
+		resp := notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList, Results: results}
+		if req.PageSize > 0 && len(results) > req.PageSize {
+			resp.Results = results[:req.PageSize]
+			resp.HasMore = true
+			resp.NextCursor = notionapi.Cursor(strconv.Itoa(start + req.PageSize))
+		}
+		writeJSON(w, resp)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/pages":
+		page := notionapi.Page{
+			Object:      notionapi.ObjectTypePage,
+			ID:          notionapi.ObjectID(fmt.Sprintf("page-%d", len(s.pages)+1)),
+			CreatedTime: time.Now().Truncate(time.Minute),
+			Properties: notionapi.Properties{
+				stubUserRepository.properties.UserID: &notionapi.RichTextProperty{Type: notionapi.PropertyTypeRichText, RichText: req.Properties.UserID.RichText},
+			},
+		}
+		s.pages = append(s.pages, page)
+		writeJSON(w, s.applyProperties(len(s.pages)-1, req.Properties))
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/v1/pages/"):
+		for i, page := range s.pages {
+			if string(page.ID) == strings.TrimPrefix(r.URL.Path, "/v1/pages/") {
+				writeJSON(w, s.applyProperties(i, req.Properties))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// applyProperties は、リクエストに含まれるプロパティだけを更新する
+func (s *stubNotionUsers) applyProperties(i int, properties stubUserProperties) notionapi.Page {
+	page := &s.pages[i]
+	names := stubUserRepository.properties
+	if properties.Name != nil {
+		page.Properties[names.Name] = &notionapi.TitleProperty{Type: notionapi.PropertyTypeTitle, Title: properties.Name.Title}
+	}
+	if properties.PictureURL != nil {
+		page.Properties[names.PictureURL] = &notionapi.URLProperty{Type: notionapi.PropertyTypeURL, URL: properties.PictureURL.URL}
+	}
+	if properties.LinkedTempUserIDs != nil {
+		page.Properties[names.LinkedTempUserIDs] = &notionapi.RichTextProperty{Type: notionapi.PropertyTypeRichText, RichText: properties.LinkedTempUserIDs.RichText}
+	}
+	if properties.LastLoginAt != nil {
+		start, err := time.Parse(time.RFC3339, properties.LastLoginAt.Date.Start)
+		if err == nil {
+			date := notionapi.Date(start)
+			page.Properties[names.LastLoginAt] = &notionapi.DateProperty{Type: notionapi.PropertyTypeDate, Date: &notionapi.DateObject{Start: &date}}
+		}
+	}
+	return *page
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestNotionUserRepository(t *testing.T) {
+	stub := &stubNotionUsers{}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	repo := NewNotionUserRepository("test-api-key", "users-db", WithNotionClientOptions(
+		notionapi.WithHTTPClient(&http.Client{Transport: rewriteTransport{target: target}}),
+		notionapi.WithRetry(0),
+	))
+	testUserRepository(t, repo)
+	assert.Len(t, stub.pages, 2)
+}
+
+func TestNotionUserRepository_LinkTempUserID(t *testing.T) {
+	stub := &stubNotionUsers{}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	repo := NewNotionUserRepository("test-api-key", "users-db", WithNotionClientOptions(
+		notionapi.WithHTTPClient(&http.Client{Transport: rewriteTransport{target: target}}),
+		notionapi.WithRetry(0),
+	))
+
+	// 部分一致するページが1回の検索に収まらなくても、連携済みのページを見つける
+	for i := 0; i <= notionMaxPageSize; i++ {
+		userID := fmt.Sprintf("line-user-%d", i)
+		_, err := repo.UpsertUser(UserInfo{UserID: userID})
+		require.NoError(t, err)
+		tempUserID := fmt.Sprintf("shared-temp-%d", i)
+		if i == notionMaxPageSize {
+			tempUserID = "shared-temp"
+		}
+		require.NoError(t, repo.LinkTempUserID(userID, tempUserID))
+	}
+	assert.ErrorIs(t, repo.LinkTempUserID("line-user-0", "shared-temp"), ErrForbidden)
+
+	// 連携したtempUserIDが多くても、要素ごとの文字数の上限を超えずに保存する
+	expected := []string{"shared-temp-0"}
+	for i := 0; i < 100; i++ {
+		tempUserID := fmt.Sprintf("temp-%036d", i)
+		expected = append(expected, tempUserID)
+		require.NoError(t, repo.LinkTempUserID("line-user-0", tempUserID))
+	}
+	res, err := repo.FindUser("line-user-0")
+	require.NoError(t, err)
+	assert.Equal(t, expected, res.LinkedTempUserIDs)
+
+	prop := stub.pages[0].Properties["linkedTempUserIds"].(*notionapi.RichTextProperty)
+	assert.Greater(t, len(prop.RichText), 1)
+	for _, text := range prop.RichText {
+		assert.LessOrEqual(t, len(text.Text.Content), notionMaxTextLength)
+	}
+}
+
+// newStubNotionUserRepository は、handlerをNotion APIとして扱うnotionUserRepositoryを生成する
+func newStubNotionUserRepository(t *testing.T, handler http.Handler, opts ...NotionOption) *notionUserRepository {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	opts = append(opts, WithNotionClientOptions(
+		notionapi.WithHTTPClient(&http.Client{Transport: rewriteTransport{target: target}}),
+		notionapi.WithRetry(0),
+	))
+	return NewNotionUserRepository("test-api-key", "users-db", opts...).(*notionUserRepository)
+}
+
+func TestNotionUserRepository_PropertyMapping(t *testing.T) {
+	mapping := NotionPropertyMapping{Users: NotionUserProperties{Name: "表示名", UserID: "LINE ID", LastLoginAt: "最終ログイン"}}
+	var created map[string]json.RawMessage
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/databases/users-db/query", func(w http.ResponseWriter, r *http.Request) {
+		var req stubQueryRequest
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		assert.JSONEq(t, `{"property":"LINE ID","rich_text":{"equals":"line-user-1"}}`, string(req.Filter))
+		writeJSON(w, notionapi.DatabaseQueryResponse{Object: notionapi.ObjectTypeList, Results: []notionapi.Page{}})
+	})
+	mux.HandleFunc("POST /v1/pages", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if !decodeStubRequest(t, w, r, &req) {
+			return
+		}
+		created = req.Properties
+		writeJSON(w, notionapi.Page{
+			Object: notionapi.ObjectTypePage,
+			ID:     "page-1",
+			Properties: notionapi.Properties{
+				"LINE ID": &notionapi.RichTextProperty{Type: notionapi.PropertyTypeRichText, RichText: []notionapi.RichText{{Text: &notionapi.Text{Content: "line-user-1"}}}},
+				"表示名":     &notionapi.TitleProperty{Type: notionapi.PropertyTypeTitle, Title: []notionapi.RichText{{Text: &notionapi.Text{Content: "Taro"}}}},
+			},
+		})
+	})
+	repo := newStubNotionUserRepository(t, mux, WithPropertyMapping(mapping))
+
+	user, err := repo.UpsertUser(UserInfo{UserID: "line-user-1", DisplayName: "Taro"})
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-1", user.ID)
+	assert.Equal(t, "Taro", user.DisplayName)
+	// 指定しないプロパティは、デフォルトの名前を使う
+	assert.ElementsMatch(t, []string{"表示名", "LINE ID", "pictureUrl", "最終ログイン"}, slices.Collect(maps.Keys(created)))
+}
+
+func TestNotionUserRepository_ValidateSchema(t *testing.T) {
+	valid := func() notionapi.PropertyConfigs {
+		return notionapi.PropertyConfigs{
+			"name":              &notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+			"userId":            &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			"pictureUrl":        &notionapi.URLPropertyConfig{Type: notionapi.PropertyConfigTypeURL},
+			"linkedTempUserIds": &notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			"lastLoginAt":       &notionapi.DatePropertyConfig{Type: notionapi.PropertyConfigTypeDate},
+		}
+	}
+
+	t.Run("valid schema", func(t *testing.T) {
+		repo := newStubNotionUserRepository(t, schemaStubHandler(t, map[string]notionapi.PropertyConfigs{"users-db": valid()}, nil, nil))
+		assert.NoError(t, repo.ValidateSchema())
+	})
+
+	t.Run("mapped property is missing", func(t *testing.T) {
+		repo := newStubNotionUserRepository(t,
+			schemaStubHandler(t, map[string]notionapi.PropertyConfigs{"users-db": valid()}, nil, nil),
+			WithPropertyMapping(NotionPropertyMapping{Users: NotionUserProperties{LastLoginAt: "最終ログイン"}}),
+		)
+
+		err := repo.ValidateSchema()
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, []string{
+			`user database (users-db): property "最終ログイン" is missing (expected date); rename "lastLoginAt" to "最終ログイン" or map it in NOTION_PROPERTY_MAPPING`,
+		}, schemaErr.Problems)
+	})
+}
+
+func TestSplitTempUserIDs(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "empty", value: "", want: []string{}},
+		{name: "sorted and deduplicated", value: "temp-b\ntemp-a\n\ntemp-b \n", want: []string{"temp-a", "temp-b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, splitTempUserIDs(tc.value))
+		})
+	}
+}
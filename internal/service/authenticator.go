@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrUnauthenticated は、セッションクッキーもチケットもない、または無効な場合のエラー
+var ErrUnauthenticated = errors.New("not authenticated")
+
+// 認証
+// リクエストを送った利用者を、クエリのticketまたはセッションクッキーから求める
+type Authenticator interface {
+	Authenticate(c echo.Context) (string, error)
+	// AuthenticateUser は、Authenticateで求めた利用者のプロフィールを返す
+	AuthenticateUser(c echo.Context) (*model.User, error)
+}
+
+type authenticator struct {
+	sessionManager SessionManager
+	ticketManager  TicketManager
+	userRepository repository.UserRepository
+	cookieManager  CookieManager
+}
+
+// NewAuthenticator は、ログインで登録した利用者のプロフィールをuserRepositoryから読む
+func NewAuthenticator(sessionManager SessionManager, ticketManager TicketManager, userRepository repository.UserRepository) Authenticator {
+	return &authenticator{
+		sessionManager: sessionManager,
+		ticketManager:  ticketManager,
+		userRepository: userRepository,
+		cookieManager:  NewCookieManager(),
+	}
+}
+
+// Authenticate は、ログイン中のユーザーIDを返す。チケットが指定されていれば、クッキーより優先する。
+// セッションクッキーで認証した場合は、セッションを延長した場合に合わせて、クッキーの期限も設定し直す
+func (a *authenticator) Authenticate(c echo.Context) (string, error) {
+	if ticket := c.QueryParam("ticket"); ticket != "" {
+		userID, err := a.ticketManager.VerifyTicket(ticket)
+		if err != nil {
+			return "", ErrUnauthenticated
+		}
+		return userID, nil
+	}
+
+	cookie, err := c.Cookie("session")
+	if err != nil {
+		return "", ErrUnauthenticated
+	}
+	session, err := a.sessionManager.GetSession(cookie.Value)
+	if err != nil {
+		return "", ErrUnauthenticated
+	}
+	if err := a.cookieManager.SetSessionCookie(c, session.ID, session.ExpiresAt); err != nil {
+		return "", errors.New("Failed to set session cookie")
+	}
+	return session.UserID, nil
+}
+
+// AuthenticateUser implements Authenticator.
+// 利用者が登録されていない場合（メモリに保存していて再起動した場合など）は、IDだけを設定して返す
+func (a *authenticator) AuthenticateUser(c echo.Context) (*model.User, error) {
+	userID, err := a.Authenticate(c)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.userRepository.FindUser(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &model.User{ID: userID, LinkedTempUserIDs: []string{}}, nil
+	}
+	if err != nil {
+		log.Printf("failed to find user: %v", err)
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"template-echo-notion-integration/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	sessionManager := &sessionManager{store: repository.NewMemorySessionStore(), ttl: time.Hour, now: func() time.Time { return now }}
+	ticketManager := NewTicketManager([]byte("test-secret"), time.Minute)
+	authenticator := NewAuthenticator(sessionManager, ticketManager, repository.NewMemoryUserRepository())
+
+	session, err := sessionManager.CreateSession("line-user-1")
+	require.NoError(t, err)
+	ticket, _, err := ticketManager.IssueTicket("line-user-2")
+	require.NoError(t, err)
+	authenticate := func(target string, cookie *http.Cookie) (string, *httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		userID, err := authenticator.Authenticate(echo.New().NewContext(req, rec))
+		return userID, rec, err
+	}
+
+	// セッションを延長したら、クッキーの期限も延ばす
+	now = now.Add(40 * time.Minute)
+	userID, rec, err := authenticate("/", &http.Cookie{Name: "session", Value: session.ID})
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-1", userID)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, session.ID, cookies[0].Value)
+	assert.True(t, now.Add(time.Hour).Equal(cookies[0].Expires))
+
+	// チケットで認証した場合は、クッキーを設定しない
+	userID, rec, err = authenticate("/?ticket="+ticket, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-2", userID)
+	assert.Empty(t, rec.Result().Cookies())
+
+	_, rec, err = authenticate("/", &http.Cookie{Name: "session", Value: "unknown"})
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	assert.Empty(t, rec.Result().Cookies())
+	_, _, err = authenticate("/", nil)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
@@ -9,17 +9,26 @@ import (
 
 // クッキー操作
 type CookieManager interface {
-	SetSessionCookie(c echo.Context, sessionID string) error
+	SetSessionCookie(c echo.Context, sessionID string, expiresAt time.Time) error
 	ClearSessionCookie(c echo.Context) error
+	SetLoginStateCookie(c echo.Context, value string, expiresAt time.Time) error
+	ClearLoginStateCookie(c echo.Context) error
 }
 
+// ログイン状態のクッキー名。/line/callbackにだけ送る
+const (
+	loginStateCookieName = "line_login"
+	loginStateCookiePath = "/line/callback"
+)
+
 type cookieManager struct{}
 
 func NewCookieManager() CookieManager {
 	return &cookieManager{}
 }
 
-func (cookieManager *cookieManager) SetSessionCookie(c echo.Context, sessionID string) error {
+// SetSessionCookie は、セッションと同じ期限でクッキーを設定する。セッションを延長したら設定し直す
+func (cookieManager *cookieManager) SetSessionCookie(c echo.Context, sessionID string, expiresAt time.Time) error {
 	c.SetCookie(&http.Cookie{
 		Name:     "session",
 		Value:    sessionID,
@@ -27,7 +36,7 @@ func (cookieManager *cookieManager) SetSessionCookie(c echo.Context, sessionID s
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  expiresAt,
 	})
 	return nil
 }
@@ -44,3 +53,32 @@ func (cookieManager *cookieManager) ClearSessionCookie(c echo.Context) error {
 	})
 	return nil
 }
+
+// SetLoginStateCookie は、/line/loginで作ったログイン状態を保存する。
+// LINEからのリダイレクト（サイトをまたぐトップレベルの遷移）でも送られるよう、SameSite=Laxにする
+func (cookieManager *cookieManager) SetLoginStateCookie(c echo.Context, value string, expiresAt time.Time) error {
+	c.SetCookie(&http.Cookie{
+		Name:     loginStateCookieName,
+		Value:    value,
+		Path:     loginStateCookiePath,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expiresAt,
+	})
+	return nil
+}
+
+// ClearLoginStateCookie は、ログイン状態を使い切る。同じstateでコールバックを繰り返せないようにする
+func (cookieManager *cookieManager) ClearLoginStateCookie(c echo.Context) error {
+	c.SetCookie(&http.Cookie{
+		Name:     loginStateCookieName,
+		Value:    "",
+		Path:     loginStateCookiePath,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+	return nil
+}
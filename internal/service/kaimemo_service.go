@@ -31,13 +31,31 @@ func (k *kaimemoService) FetchKaimemoSummaryRecord(userID string) (model.Kaimemo
 	}, nil
 }
 
+// UpdateKaimemoAmount implements KaimemoService.
+// 更新後の集計を返すため、画面の合計をそのまま差し替えられる。
+// 集計には更新とともに返された金額レコードを使い、読み直さない
+func (k *kaimemoService) UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (model.KaimemoSummaryResponse, error) {
+	res, err := k.repo.UpdateKaimemoAmount(id, req)
+	if err != nil {
+		return model.KaimemoSummaryResponse{
+			MonthlySummaries: []model.MonthlySummary{},
+			WeeklySummaries:  []model.WeeklySummary{},
+		}, err
+	}
+
+	return model.KaimemoSummaryResponse{
+		MonthlySummaries: res.GroupByMonth(),
+		WeeklySummaries:  res.GroupByWeek(),
+	}, nil
+}
+
 // RemoveKaimemoAmount implements KaimemoService.
 func (k *kaimemoService) RemoveKaimemoAmount(id string, userID string) error {
 	return k.repo.RemoveKaimemoAmount(id, userID)
 }
 
 // CreateKaimemo implements KaimemoService.
-func (k *kaimemoService) CreateKaimemo(req model.CreateKaimemoRequest) error {
+func (k *kaimemoService) CreateKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error) {
 	return k.repo.InsertKaimemo(req)
 }
 
@@ -46,17 +64,30 @@ func (k *kaimemoService) FetchKaimemo(userID string) ([]model.KaimemoResponse, e
 	return k.repo.FetchKaimemo(userID)
 }
 
+// FetchKaimemoPage implements KaimemoService.
+func (k *kaimemoService) FetchKaimemoPage(userID string, cursor string, limit int) (*model.KaimemoPage, error) {
+	return k.repo.FetchKaimemoPage(userID, cursor, limit)
+}
+
+// UpdateKaimemo implements KaimemoService.
+func (k *kaimemoService) UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error) {
+	return k.repo.UpdateKaimemo(id, req)
+}
+
 // RemoveKaimemo implements KaimemoService.
-func (k *kaimemoService) RemoveKaimemo(id string, userID string) error {
-	return k.repo.RemoveKaimemo(id, userID)
+func (k *kaimemoService) RemoveKaimemo(id string, userID string, ifMatch string) error {
+	return k.repo.RemoveKaimemo(id, userID, ifMatch)
 }
 
 type KaimemoService interface {
 	FetchKaimemo(userID string) ([]model.KaimemoResponse, error)
-	CreateKaimemo(req model.CreateKaimemoRequest) error
-	RemoveKaimemo(id string, userID string) error
+	FetchKaimemoPage(userID string, cursor string, limit int) (*model.KaimemoPage, error)
+	CreateKaimemo(req model.CreateKaimemoRequest) (*model.KaimemoResponse, error)
+	UpdateKaimemo(id string, req model.UpdateKaimemoRequest) (*model.KaimemoResponse, error)
+	RemoveKaimemo(id string, userID string, ifMatch string) error
 	FetchKaimemoSummaryRecord(userID string) (model.KaimemoSummaryResponse, error)
 	CreateKaimemoAmount(req model.CreateKaimemoAmountRequest) error
+	UpdateKaimemoAmount(id string, req model.UpdateKaimemoAmountRequest) (model.KaimemoSummaryResponse, error)
 	RemoveKaimemoAmount(id string, userID string) error
 }
 
@@ -1 +1,88 @@
 package service
+
+import (
+	mock "template-echo-notion-integration/internal/mock/repository"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestKaimemoService_KaimemoFlow(t *testing.T) {
+	svc := NewKaimemoService(repository.NewMemoryRepository())
+
+	created, err := svc.CreateKaimemo(model.CreateKaimemoRequest{TempUserID: "user-1", Tag: "food", Name: "milk"})
+	require.NoError(t, err)
+	_, err = svc.CreateKaimemo(model.CreateKaimemoRequest{TempUserID: "user-2", Tag: "food", Name: "egg"})
+	require.NoError(t, err)
+
+	res, err := svc.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.KaimemoResponse{*created}, res)
+
+	require.NoError(t, svc.RemoveKaimemo(res[0].ID, "user-1", ""))
+	res, err = svc.FetchKaimemo("user-1")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, err = svc.FetchKaimemo("user-2")
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+}
+
+func TestKaimemoService_FetchKaimemoSummaryRecord(t *testing.T) {
+	svc := NewKaimemoService(repository.NewMemoryRepository())
+
+	require.NoError(t, svc.CreateKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-15", Tag: "food", Amount: 1000}))
+	require.NoError(t, svc.CreateKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "transport", Amount: 2000}))
+	require.NoError(t, svc.CreateKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "user-2", Date: "2023-05-16", Tag: "food", Amount: 9999}))
+
+	res, err := svc.FetchKaimemoSummaryRecord("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.MonthlySummary{
+		{
+			Month:       "2023-05",
+			TotalAmount: 3000,
+			TagSummary:  map[string]int{"food": 1000, "transport": 2000},
+		},
+	}, res.MonthlySummaries)
+	require.Len(t, res.WeeklySummaries, 1)
+	assert.Equal(t, 3000, res.WeeklySummaries[0].TotalAmount)
+
+	require.NoError(t, svc.RemoveKaimemoAmount(res.WeeklySummaries[0].Items[0].ID, "user-1"))
+	res, err = svc.FetchKaimemoSummaryRecord("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2000, res.MonthlySummaries[0].TotalAmount)
+}
+
+func TestKaimemoService_UpdateKaimemoAmount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mock.NewMockKaimemoRepository(ctrl)
+	svc := NewKaimemoService(repo)
+
+	// 集計は更新とともに返された金額レコードから求め、読み直さない
+	req := model.UpdateKaimemoAmountRequest{TempUserID: "user-1", Date: "2023-05-16", Tag: "food", Amount: 1500}
+	repo.EXPECT().UpdateKaimemoAmount("amount-1", req).Return(&model.KaimemoAmountRecords{
+		Records: []model.KaimemoAmount{
+			{ID: "amount-1", Date: "2023-05-16", Tag: "food", Amount: 1500},
+			{ID: "amount-2", Date: "2023-05-16", Tag: "transport", Amount: 2000},
+		},
+	}, nil)
+	res, err := svc.UpdateKaimemoAmount("amount-1", req)
+	require.NoError(t, err)
+	assert.Equal(t, []model.MonthlySummary{
+		{
+			Month:       "2023-05",
+			TotalAmount: 3500,
+			TagSummary:  map[string]int{"food": 1500, "transport": 2000},
+		},
+	}, res.MonthlySummaries)
+
+	repo.EXPECT().UpdateKaimemoAmount("unknown", req).Return(nil, repository.ErrNotFound)
+	res, err = svc.UpdateKaimemoAmount("unknown", req)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Empty(t, res.MonthlySummaries)
+}
@@ -2,57 +2,82 @@
 package service
 
 import (
+	"crypto/subtle"
 	"errors"
-	"fmt"
+	"log"
+	"template-echo-notion-integration/internal/model"
 	"template-echo-notion-integration/internal/repository"
 
 	"github.com/labstack/echo/v4"
 )
 
+// ErrInvalidTempUserID は、連携するtempUserIDが空、またはログイン中の利用者自身のIDの場合のエラー
+var ErrInvalidTempUserID = errors.New("tempUserID is invalid")
+
+// ErrTempUserIDTaken は、tempUserIDが別の利用者に連携済み、または別の利用者のIDの場合のエラー
+var ErrTempUserIDTaken = errors.New("tempUserID is linked to another user")
+
 type LineAuthService interface {
 	Login(c echo.Context) (string, error)
 	Logout(c echo.Context) error
 	Callback(c echo.Context, code string) error
-	CheckAuth(c echo.Context) error
+	// CheckAuth は、セッションクッキーからログイン中の利用者を返す
+	CheckAuth(c echo.Context) (*model.User, error)
+	IssueTicket(c echo.Context) (*model.TicketResponse, error)
+	// LinkTempUser は、ログイン前の端末のtempUserIDの買い物メモと集計を、ログイン中の利用者に付け替える
+	LinkTempUser(c echo.Context, tempUserID string) (*model.LinkTempUserResponse, error)
 }
 
-// セッション管理用の仮データ
-var sessionStore = make(map[string]string)
-
 type lineAuthService struct {
-	repository     repository.LineRepository
-	sessionManager SessionManager
-	cookieManager  CookieManager
+	repository        repository.LineRepository
+	userRepository    repository.UserRepository
+	kaimemoRepository repository.KaimemoRepository
+	sessionManager    SessionManager
+	cookieManager     CookieManager
+	ticketManager     TicketManager
+	loginStateManager LoginStateManager
 }
 
-func NewLineAuthService(repository repository.LineRepository) LineAuthService {
+// NewLineAuthService は、ログインで作ったセッションをsessionManagerに保存する。
+// WebSocketの接続を認証するAuthenticatorと同じsessionManagerを渡す
+func NewLineAuthService(repository repository.LineRepository, userRepository repository.UserRepository, kaimemoRepository repository.KaimemoRepository, sessionManager SessionManager, ticketManager TicketManager, loginStateManager LoginStateManager) LineAuthService {
 	return &lineAuthService{
-		repository:     repository,
-		sessionManager: NewSessionManager(),
-		cookieManager:  NewCookieManager(),
+		repository:        repository,
+		userRepository:    userRepository,
+		kaimemoRepository: kaimemoRepository,
+		sessionManager:    sessionManager,
+		cookieManager:     NewCookieManager(),
+		ticketManager:     ticketManager,
+		loginStateManager: loginStateManager,
 	}
 }
 
 // Callback implements LineAuthService.
+// /line/loginで保存したログイン状態とstateを照合し、使い切ってからcode_verifierを添えてトークンを取得する。
+// ログインのたびに、LINEのプロフィールで利用者を登録・更新する
 func (l *lineAuthService) Callback(c echo.Context, code string) error {
-	if !l.repository.MatchState(c.QueryParam("state")) {
-		return errors.New("State does not match")
+	loginState, err := l.consumeLoginState(c)
+	if err != nil {
+		return err
 	}
 
-	userInfo, err := l.repository.GetUserInfo(c.FormValue("code"))
-	fmt.Println(userInfo)
+	userInfo, err := l.repository.GetUserInfo(code, *loginState)
+	if err != nil {
+		log.Printf("failed to get line user info: %v", err)
+		return err
+	}
 
-	//
-	// TODO : システムに登録されていなければ、ユーザー情報をDBに保存する
-	//
+	if _, err := l.userRepository.UpsertUser(*userInfo); err != nil {
+		log.Printf("failed to upsert user: %v", err)
+		return err
+	}
 
-	sessionID, err := l.sessionManager.CreateSession(userInfo.UserID)
+	session, err := l.sessionManager.CreateSession(userInfo.UserID)
 	if err != nil {
 		return errors.New("Failed to create session")
 	}
 
-	// HACK : リファクタリング後、クッキーに保存できていない。ので、checkAuthで取得に失敗しているよう
-	if err := l.cookieManager.SetSessionCookie(c, sessionID); err != nil {
+	if err := l.cookieManager.SetSessionCookie(c, session.ID, session.ExpiresAt); err != nil {
 		return errors.New("Failed to set session cookie")
 	}
 
@@ -60,30 +85,155 @@ func (l *lineAuthService) Callback(c echo.Context, code string) error {
 	return nil
 }
 
-func (l *lineAuthService) CheckAuth(c echo.Context) error {
-	cookie, err := c.Cookie("session")
+// CheckAuth implements LineAuthService.
+// セッションを延長した場合に合わせて、クッキーの期限も設定し直す。
+// セッションがあっても利用者が登録されていなければ、ログインし直してもらう
+func (l *lineAuthService) CheckAuth(c echo.Context) (*model.User, error) {
+	session, err := l.session(c)
 	if err != nil {
-		return errors.New("Not logged in")
-	}
-	userID, exists := sessionStore[cookie.Value]
-	if !exists {
-		return errors.New("Session invalid")
+		return nil, err
 	}
 
-	// TODO : userIDをもとに、ユーザー情報を取得して返す
-	fmt.Println(userID)
+	user, err := l.userRepository.FindUser(session.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Printf("user %s of session is not registered", session.UserID)
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		log.Printf("failed to find user: %v", err)
+		return nil, err
+	}
 
-	return nil
+	if err := l.cookieManager.SetSessionCookie(c, session.ID, session.ExpiresAt); err != nil {
+		return nil, errors.New("Failed to set session cookie")
+	}
+	return user, nil
 }
 
+// Login implements LineAuthService.
+// ログインのたびにstate・nonce・code_verifierを作り直し、署名付きのクッキーに保存する
 func (l *lineAuthService) Login(c echo.Context) (string, error) {
-	return l.repository.GetAuthCodeUrl(), nil
+	loginState, value, expiresAt, err := l.loginStateManager.NewLoginState()
+	if err != nil {
+		log.Printf("failed to create login state: %v", err)
+		return "", err
+	}
+	if err := l.cookieManager.SetLoginStateCookie(c, value, expiresAt); err != nil {
+		return "", errors.New("Failed to set login state cookie")
+	}
+	return l.repository.GetAuthCodeUrl(*loginState), nil
+}
+
+// consumeLoginState は、クッキーのログイン状態を検証してstateと照合する。
+// 照合に失敗しても、同じログイン状態を再び使えないようにクッキーは消す
+func (l *lineAuthService) consumeLoginState(c echo.Context) (*model.LoginState, error) {
+	cookie, err := c.Cookie(loginStateCookieName)
+	if err != nil {
+		return nil, ErrInvalidLoginState
+	}
+	if err := l.cookieManager.ClearLoginStateCookie(c); err != nil {
+		return nil, errors.New("Failed to clear login state cookie")
+	}
+
+	loginState, err := l.loginStateManager.VerifyLoginState(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(c.QueryParam("state")), []byte(loginState.State)) != 1 {
+		return nil, ErrInvalidLoginState
+	}
+	return loginState, nil
 }
 
+// Logout implements LineAuthService.
+// クッキーを消すだけでなく、サーバー側のセッションも削除する
 func (l *lineAuthService) Logout(c echo.Context) error {
+	if cookie, err := c.Cookie("session"); err == nil {
+		if err := l.sessionManager.DestroySession(cookie.Value); err != nil {
+			log.Printf("failed to destroy session: %v", err)
+			return err
+		}
+	}
 	if err := l.cookieManager.ClearSessionCookie(c); err != nil {
 		return errors.New("Failed to clear session cookie")
 	}
 
 	return nil
 }
+
+// IssueTicket は、セッションクッキーでログインしている利用者に、WebSocket接続用のチケットを発行する。
+// チケットからチケットを発行できると期限なく使い続けられるため、クッキーのみを受け付ける
+func (l *lineAuthService) IssueTicket(c echo.Context) (*model.TicketResponse, error) {
+	session, err := l.session(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, expiresAt, err := l.ticketManager.IssueTicket(session.UserID)
+	if err != nil {
+		log.Printf("failed to issue ticket: %v", err)
+		return nil, err
+	}
+	return &model.TicketResponse{Ticket: ticket, ExpiresAt: expiresAt}, nil
+}
+
+// LinkTempUser implements LineAuthService.
+// 先に連携を記録してから付け替えるため、付け替えが途中で失敗しても同じtempUserIDで再実行すれば残りを移行できる。
+// tempUserIDは端末が決めた値のため、別の利用者に連携済みのものや、登録済みの利用者のIDは受け付けない
+func (l *lineAuthService) LinkTempUser(c echo.Context, tempUserID string) (*model.LinkTempUserResponse, error) {
+	session, err := l.session(c)
+	if err != nil {
+		return nil, err
+	}
+	if tempUserID == "" || tempUserID == session.UserID {
+		return nil, ErrInvalidTempUserID
+	}
+
+	_, err = l.userRepository.FindUser(tempUserID)
+	if err == nil {
+		return nil, ErrTempUserIDTaken
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("failed to find user: %v", err)
+		return nil, err
+	}
+
+	err = l.userRepository.LinkTempUserID(session.UserID, tempUserID)
+	if errors.Is(err, repository.ErrForbidden) {
+		return nil, ErrTempUserIDTaken
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		log.Printf("failed to link tempUserID: %v", err)
+		return nil, err
+	}
+
+	result, err := l.kaimemoRepository.ReassignUser(tempUserID, session.UserID)
+	if err != nil {
+		log.Printf("failed to reassign kaimemo of tempUserID: %v", err)
+		return nil, err
+	}
+	return &model.LinkTempUserResponse{
+		TempUserID:      tempUserID,
+		MigratedItems:   result.Items,
+		MigratedAmounts: result.Amounts,
+	}, nil
+}
+
+// session は、セッションクッキーの有効なセッションを返す。ない場合はErrUnauthenticatedを返す
+func (l *lineAuthService) session(c echo.Context) (*model.Session, error) {
+	cookie, err := c.Cookie("session")
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	session, err := l.sessionManager.GetSession(cookie.Value)
+	if errors.Is(err, ErrSessionInvalid) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	mock "template-echo-notion-integration/internal/mock/repository"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// newTestContext は、cookiesを送るリクエストのコンテキストを組み立てる
+func newTestContext(target string, cookies []*http.Cookie) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestLineAuthService_Session(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lineRepository := mock.NewMockLineRepository(ctrl)
+	sessionManager := NewSessionManager(repository.NewMemorySessionStore(), time.Hour)
+	userRepository := repository.NewMemoryUserRepository()
+	authService := newTestLineAuthService(lineRepository, userRepository, sessionManager)
+
+	_, err := authService.CheckAuth(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/line/me", nil), httptest.NewRecorder()))
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	loginState, loginCookies := login(t, authService, lineRepository)
+	lineRepository.EXPECT().GetUserInfo("code", loginState).Return(&repository.UserInfo{UserID: "line-user-1", DisplayName: "Taro", PictureURL: "https://profile.line-scdn.net/taro"}, nil)
+	c, rec := newTestContext("/line/callback?code=code&state="+loginState.State, loginCookies)
+	require.NoError(t, authService.Callback(c, "code"))
+	cookies := findCookies(rec, "session")
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+
+	// /line/callbackで登録した利用者を、同じクッキーで/line/meが返す
+	c, rec = newTestContext("/line/me", cookies)
+	user, err := authService.CheckAuth(c)
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-1", user.ID)
+	assert.Equal(t, "Taro", user.DisplayName)
+	assert.Equal(t, "https://profile.line-scdn.net/taro", user.PictureURL)
+	assert.NotEmpty(t, rec.Result().Cookies())
+
+	c, _ = newTestContext("/line/ticket", cookies)
+	ticket, err := authService.IssueTicket(c)
+	require.NoError(t, err)
+	assert.NotEmpty(t, ticket.Ticket)
+
+	// ログアウトすると、同じクッキーでは使えない
+	c, _ = newTestContext("/line/logout", cookies)
+	require.NoError(t, authService.Logout(c))
+	c, _ = newTestContext("/line/me", cookies)
+	_, err = authService.CheckAuth(c)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	t.Run("user info error", func(t *testing.T) {
+		loginState, loginCookies := login(t, authService, lineRepository)
+		lineRepository.EXPECT().GetUserInfo("code", loginState).Return(nil, assert.AnError)
+		c, rec := newTestContext("/line/callback?code=code&state="+loginState.State, loginCookies)
+		assert.Error(t, authService.Callback(c, "code"))
+		assert.Empty(t, findCookies(rec, "session"))
+	})
+
+	t.Run("user not registered", func(t *testing.T) {
+		session, err := sessionManager.CreateSession("line-user-unknown")
+		require.NoError(t, err)
+		c, _ := newTestContext("/line/me", []*http.Cookie{{Name: "session", Value: session.ID}})
+		_, err = authService.CheckAuth(c)
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	})
+}
+
+func TestLineAuthService_UpsertUserError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lineRepository := mock.NewMockLineRepository(ctrl)
+	userRepository := mock.NewMockUserRepository(ctrl)
+	authService := newTestLineAuthService(lineRepository, userRepository, NewSessionManager(repository.NewMemorySessionStore(), time.Hour))
+
+	// 利用者を保存できなければ、ログインさせない
+	loginState, loginCookies := login(t, authService, lineRepository)
+	userInfo := &repository.UserInfo{UserID: "line-user-1", DisplayName: "Taro"}
+	lineRepository.EXPECT().GetUserInfo("code", loginState).Return(userInfo, nil)
+	userRepository.EXPECT().UpsertUser(*userInfo).Return(nil, assert.AnError)
+	c, rec := newTestContext("/line/callback?code=code&state="+loginState.State, loginCookies)
+	assert.ErrorIs(t, authService.Callback(c, "code"), assert.AnError)
+	assert.Empty(t, findCookies(rec, "session"))
+}
+
+func TestLineAuthService_LinkTempUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessionManager := NewSessionManager(repository.NewMemorySessionStore(), time.Hour)
+	userRepository := repository.NewMemoryUserRepository()
+	kaimemoRepository := repository.NewMemoryRepository()
+	authService := newTestLineAuthServiceWithKaimemo(mock.NewMockLineRepository(ctrl), userRepository, kaimemoRepository, sessionManager)
+
+	for _, userID := range []string{"line-user-1", "line-user-2"} {
+		_, err := userRepository.UpsertUser(repository.UserInfo{UserID: userID})
+		require.NoError(t, err)
+	}
+	sessionCookies := func(userID string) []*http.Cookie {
+		session, err := sessionManager.CreateSession(userID)
+		require.NoError(t, err)
+		return []*http.Cookie{{Name: "session", Value: session.ID}}
+	}
+	_, err := kaimemoRepository.InsertKaimemo(model.CreateKaimemoRequest{TempUserID: "temp-1", Name: "milk"})
+	require.NoError(t, err)
+	require.NoError(t, kaimemoRepository.InsertKaimemoAmount(model.CreateKaimemoAmountRequest{TempUserID: "temp-1", Date: "2023-05-15", Amount: 100}))
+
+	c, _ := newTestContext("/line/link", sessionCookies("line-user-1"))
+	res, err := authService.LinkTempUser(c, "temp-1")
+	require.NoError(t, err)
+	assert.Equal(t, &model.LinkTempUserResponse{TempUserID: "temp-1", MigratedItems: 1, MigratedAmounts: 1}, res)
+
+	items, err := kaimemoRepository.FetchKaimemo("line-user-1")
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+	user, err := userRepository.FindUser("line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temp-1"}, user.LinkedTempUserIDs)
+
+	// 同じtempUserIDで再実行しても、移行済みのものは数えない
+	res, err = authService.LinkTempUser(c, "temp-1")
+	require.NoError(t, err)
+	assert.Equal(t, &model.LinkTempUserResponse{TempUserID: "temp-1"}, res)
+
+	tests := []struct {
+		name       string
+		cookies    []*http.Cookie
+		tempUserID string
+		wantErr    error
+	}{
+		{name: "not logged in", tempUserID: "temp-2", wantErr: ErrUnauthenticated},
+		{name: "empty tempUserID", cookies: sessionCookies("line-user-1"), tempUserID: "", wantErr: ErrInvalidTempUserID},
+		{name: "own user id", cookies: sessionCookies("line-user-1"), tempUserID: "line-user-1", wantErr: ErrInvalidTempUserID},
+		{name: "linked to another user", cookies: sessionCookies("line-user-2"), tempUserID: "temp-1", wantErr: ErrTempUserIDTaken},
+		{name: "another user id", cookies: sessionCookies("line-user-2"), tempUserID: "line-user-1", wantErr: ErrTempUserIDTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext("/line/link", tt.cookies)
+			_, err := authService.LinkTempUser(c, tt.tempUserID)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+	items, err = kaimemoRepository.FetchKaimemo("line-user-1")
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestLineAuthService_LinkTempUserResume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessionManager := NewSessionManager(repository.NewMemorySessionStore(), time.Hour)
+	userRepository := repository.NewMemoryUserRepository()
+	kaimemoRepository := mock.NewMockKaimemoRepository(ctrl)
+	authService := newTestLineAuthServiceWithKaimemo(mock.NewMockLineRepository(ctrl), userRepository, kaimemoRepository, sessionManager)
+
+	_, err := userRepository.UpsertUser(repository.UserInfo{UserID: "line-user-1"})
+	require.NoError(t, err)
+	session, err := sessionManager.CreateSession("line-user-1")
+	require.NoError(t, err)
+	c, _ := newTestContext("/line/link", []*http.Cookie{{Name: "session", Value: session.ID}})
+
+	// 付け替えが途中で失敗しても連携は記録され、再実行で残りを移行する
+	gomock.InOrder(
+		kaimemoRepository.EXPECT().ReassignUser("temp-1", "line-user-1").Return(&repository.UserMigrationResult{Items: 1}, assert.AnError),
+		kaimemoRepository.EXPECT().ReassignUser("temp-1", "line-user-1").Return(&repository.UserMigrationResult{Items: 2, Amounts: 1}, nil),
+	)
+	_, err = authService.LinkTempUser(c, "temp-1")
+	assert.ErrorIs(t, err, assert.AnError)
+	user, err := userRepository.FindUser("line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temp-1"}, user.LinkedTempUserIDs)
+
+	res, err := authService.LinkTempUser(c, "temp-1")
+	require.NoError(t, err)
+	assert.Equal(t, &model.LinkTempUserResponse{TempUserID: "temp-1", MigratedItems: 2, MigratedAmounts: 1}, res)
+}
+
+func TestLineAuthService_LoginState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lineRepository := mock.NewMockLineRepository(ctrl)
+	authService := newTestLineAuthService(lineRepository, repository.NewMemoryUserRepository(), NewSessionManager(repository.NewMemorySessionStore(), time.Hour))
+
+	// ログインのたびに別の値を使う
+	first, firstCookies := login(t, authService, lineRepository)
+	second, _ := login(t, authService, lineRepository)
+	assert.NotEqual(t, first.State, second.State)
+	assert.NotEqual(t, first.Nonce, second.Nonce)
+	assert.NotEqual(t, first.CodeVerifier, second.CodeVerifier)
+	assert.Equal(t, "/line/callback", firstCookies[0].Path)
+
+	expired, expiredValue, _, err := NewLoginStateManager([]byte("test-secret"), -time.Minute).NewLoginState()
+	require.NoError(t, err)
+	forgedState, forged, _, err := NewLoginStateManager([]byte("other-secret"), time.Minute).NewLoginState()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		state   string
+		cookies []*http.Cookie
+	}{
+		{name: "no login state", state: first.State},
+		{name: "state mismatch", state: second.State, cookies: firstCookies},
+		{name: "empty state", state: "", cookies: firstCookies},
+		{name: "forged login state", state: forgedState.State, cookies: []*http.Cookie{{Name: "line_login", Value: forged}}},
+		{name: "expired login state", state: expired.State, cookies: []*http.Cookie{{Name: "line_login", Value: expiredValue}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext("/line/callback?code=code&state="+tt.state, tt.cookies)
+			assert.ErrorIs(t, authService.Callback(c, "code"), ErrInvalidLoginState)
+			assert.Empty(t, findCookies(rec, "session"))
+		})
+	}
+
+	t.Run("consumed on callback", func(t *testing.T) {
+		loginState, loginCookies := login(t, authService, lineRepository)
+		lineRepository.EXPECT().GetUserInfo("code", loginState).Return(&repository.UserInfo{UserID: "line-user-1"}, nil)
+		c, rec := newTestContext("/line/callback?code=code&state="+loginState.State, loginCookies)
+		require.NoError(t, authService.Callback(c, "code"))
+		cleared := findCookies(rec, "line_login")
+		require.Len(t, cleared, 1)
+		assert.Empty(t, cleared[0].Value)
+		assert.Negative(t, cleared[0].MaxAge)
+	})
+}
+
+func newTestLineAuthService(lineRepository repository.LineRepository, userRepository repository.UserRepository, sessionManager SessionManager) LineAuthService {
+	return newTestLineAuthServiceWithKaimemo(lineRepository, userRepository, repository.NewMemoryRepository(), sessionManager)
+}
+
+func newTestLineAuthServiceWithKaimemo(lineRepository repository.LineRepository, userRepository repository.UserRepository, kaimemoRepository repository.KaimemoRepository, sessionManager SessionManager) LineAuthService {
+	secret := []byte("test-secret")
+	return NewLineAuthService(lineRepository, userRepository, kaimemoRepository, sessionManager, NewTicketManager(secret, time.Minute), NewLoginStateManager(secret, 10*time.Minute))
+}
+
+// login は、/line/loginを実行し、LINEに送ったログイン状態と、保存したクッキーを返す
+func login(t *testing.T, authService LineAuthService, lineRepository *mock.MockLineRepository) (model.LoginState, []*http.Cookie) {
+	t.Helper()
+
+	var loginState model.LoginState
+	lineRepository.EXPECT().GetAuthCodeUrl(gomock.Any()).DoAndReturn(func(s model.LoginState) string {
+		loginState = s
+		return "https://access.line.me/oauth2/v2.1/authorize?state=" + s.State
+	})
+	c, rec := newTestContext("/line/login", nil)
+	url, err := authService.Login(c)
+	require.NoError(t, err)
+	assert.Contains(t, url, loginState.State)
+	assert.NotEmpty(t, loginState.Nonce)
+	assert.NotEmpty(t, loginState.CodeVerifier)
+
+	cookies := findCookies(rec, "line_login")
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	return loginState, cookies
+}
+
+func findCookies(rec *httptest.ResponseRecorder, name string) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
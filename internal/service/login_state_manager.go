@@ -0,0 +1,94 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"template-echo-notion-integration/internal/model"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// ログイン状態の用途。チケットなど、同じ鍵で署名した他のトークンと取り違えない
+const loginStateAudience = "line-login"
+
+// ErrInvalidLoginState は、ログイン状態がない、署名・期限が正しくない、またはstateが一致しない場合のエラー
+var ErrInvalidLoginState = errors.New("login state is invalid")
+
+// ログイン状態管理
+// /line/loginから/line/callbackまでの間、state・nonce・code_verifierを署名付きのクッキーに保存する。
+// サーバーに保存しないため、インスタンスが複数あっても、再起動してもログインを続けられる
+type LoginStateManager interface {
+	// NewLoginState は、新しいログイン状態と、クッキーに保存する署名済みの値・有効期限を返す
+	NewLoginState() (*model.LoginState, string, time.Time, error)
+	// VerifyLoginState は、署名済みの値を検証し、ログイン状態を返す
+	VerifyLoginState(value string) (*model.LoginState, error)
+}
+
+type loginStateManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewLoginStateManager(secret []byte, ttl time.Duration) LoginStateManager {
+	return &loginStateManager{secret: secret, ttl: ttl, now: time.Now}
+}
+
+// loginStateClaims は、ログイン状態の署名済みの値の内容
+type loginStateClaims struct {
+	model.LoginState
+	jwt.RegisteredClaims
+}
+
+// NewLoginState implements LoginStateManager.
+func (l *loginStateManager) NewLoginState() (*model.LoginState, string, time.Time, error) {
+	loginState := model.LoginState{
+		State:        generateRandomToken(),
+		Nonce:        generateRandomToken(),
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}
+
+	now := l.now()
+	expiresAt := now.Add(l.ttl)
+	value, err := jwt.NewWithClaims(jwt.SigningMethodHS256, loginStateClaims{
+		LoginState: loginState,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{loginStateAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString(l.secret)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return &loginState, value, expiresAt, nil
+}
+
+// VerifyLoginState implements LoginStateManager.
+func (l *loginStateManager) VerifyLoginState(value string) (*model.LoginState, error) {
+	var claims loginStateClaims
+	_, err := jwt.ParseWithClaims(value, &claims, func(*jwt.Token) (interface{}, error) {
+		return l.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(loginStateAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(l.now),
+	)
+	if err != nil || claims.State == "" || claims.Nonce == "" || claims.CodeVerifier == "" {
+		return nil, ErrInvalidLoginState
+	}
+	return &claims.LoginState, nil
+}
+
+// generateRandomToken は、推測できない32バイトのランダムな値をURLに使える文字列で返す
+func generateRandomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -5,42 +5,91 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	"time"
 )
 
+// ErrSessionInvalid は、セッションが存在しない、または期限が切れている場合のエラー
+var ErrSessionInvalid = errors.New("Session invalid")
+
 // セッション管理
+// 期限はttl。使われるたびに延長し（sliding expiration）、最後に使われてからttlが過ぎると切れる
 type SessionManager interface {
-	CreateSession(userID string) (string, error)
-	GetSession(sessionID string) (string, error)
+	CreateSession(userID string) (*model.Session, error)
+	GetSession(sessionID string) (*model.Session, error)
 	DestroySession(sessionID string) error
+	// PurgeExpiredSessions は、再び使われないまま期限が切れたセッションを保存先から削除する
+	PurgeExpiredSessions() (int, error)
 }
 
 type sessionManager struct {
-	sessionStore map[string]string
+	store repository.SessionStore
+	ttl   time.Duration
+	now   func() time.Time
 }
 
-func NewSessionManager() SessionManager {
-	return &sessionManager{
-		sessionStore: make(map[string]string),
-	}
+// NewSessionManager は、storeにセッションを保存する。
+// 同時に参照される場合の排他はstoreが行う
+func NewSessionManager(store repository.SessionStore, ttl time.Duration) SessionManager {
+	return &sessionManager{store: store, ttl: ttl, now: time.Now}
 }
 
-func (s *sessionManager) CreateSession(userID string) (string, error) {
-	sessionID := fmt.Sprintf("session-%s", generateSessionID())
-	s.sessionStore[sessionID] = userID
-	return sessionID, nil
+func (s *sessionManager) CreateSession(userID string) (*model.Session, error) {
+	session := model.Session{
+		ID:        fmt.Sprintf("session-%s", generateSessionID()),
+		UserID:    userID,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	if err := s.store.SaveSession(session); err != nil {
+		log.Printf("failed to save session: %v", err)
+		return nil, err
+	}
+	return &session, nil
 }
 
-func (s *sessionManager) GetSession(sessionID string) (string, error) {
-	userID, exists := s.sessionStore[sessionID]
-	if !exists {
-		return "", errors.New("Session invalid")
+// GetSession は、有効なセッションを返す。
+// 残りの期限がttlの半分を切っていれば延長する。参照のたびに保存先へ書き込まないよう、延長はそのときだけ行う。
+// 延長は既存のセッションだけを更新するため、同時にログアウトしたセッションは復活しない
+func (s *sessionManager) GetSession(sessionID string) (*model.Session, error) {
+	session, err := s.store.FindSession(sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrSessionInvalid
+	}
+	if err != nil {
+		log.Printf("failed to find session: %v", err)
+		return nil, err
+	}
+
+	now := s.now()
+	if !session.ExpiresAt.After(now) {
+		if err := s.store.DeleteSession(sessionID); err != nil {
+			log.Printf("failed to delete expired session: %v", err)
+		}
+		return nil, ErrSessionInvalid
+	}
+
+	if session.ExpiresAt.Sub(now) < s.ttl/2 {
+		session.ExpiresAt = now.Add(s.ttl)
+		err := s.store.ExtendSession(sessionID, session.ExpiresAt)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSessionInvalid
+		}
+		if err != nil {
+			log.Printf("failed to extend session: %v", err)
+			return nil, err
+		}
 	}
-	return userID, nil
+	return session, nil
 }
 
 func (s *sessionManager) DestroySession(sessionID string) error {
-	delete(s.sessionStore, sessionID)
-	return nil
+	return s.store.DeleteSession(sessionID)
+}
+
+func (s *sessionManager) PurgeExpiredSessions() (int, error) {
+	return s.store.DeleteExpiredSessions(s.now())
 }
 
 // セッションIDをランダムに生成
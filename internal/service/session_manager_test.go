@@ -0,0 +1,103 @@
+package service
+
+import (
+	"path/filepath"
+	"template-echo-notion-integration/internal/model"
+	"template-echo-notion-integration/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionManager(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	store := repository.NewMemorySessionStore()
+	manager := &sessionManager{store: store, ttl: time.Hour, now: func() time.Time { return now }}
+
+	session, err := manager.CreateSession("line-user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "line-user-1", session.UserID)
+	assert.Equal(t, now.Add(time.Hour), session.ExpiresAt)
+
+	// 残りがttlの半分以上あるうちは延長しない
+	now = now.Add(20 * time.Minute)
+	res, err := manager.GetSession(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, session.ExpiresAt, res.ExpiresAt)
+
+	// 使われ続ける限り期限は延びる
+	for i := 0; i < 3; i++ {
+		now = now.Add(35 * time.Minute)
+		res, err = manager.GetSession(session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(time.Hour), res.ExpiresAt)
+	}
+
+	// 最後に使われてからttlが過ぎると切れ、保存先からも消える
+	now = now.Add(time.Hour)
+	_, err = manager.GetSession(session.ID)
+	assert.ErrorIs(t, err, ErrSessionInvalid)
+	_, err = store.FindSession(session.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = manager.GetSession("unknown")
+	assert.ErrorIs(t, err, ErrSessionInvalid)
+
+	other, err := manager.CreateSession("line-user-2")
+	require.NoError(t, err)
+	require.NoError(t, manager.DestroySession(other.ID))
+	_, err = manager.GetSession(other.ID)
+	assert.ErrorIs(t, err, ErrSessionInvalid)
+
+	_, err = manager.CreateSession("line-user-3")
+	require.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	n, err := manager.PurgeExpiredSessions()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+// logoutOnFind は、セッションを読み取った直後に、別のリクエストがログアウトするSessionStore
+type logoutOnFind struct {
+	repository.SessionStore
+	logout func()
+}
+
+func (l *logoutOnFind) FindSession(id string) (*model.Session, error) {
+	session, err := l.SessionStore.FindSession(id)
+	if l.logout != nil {
+		l.logout()
+		l.logout = nil
+	}
+	return session, err
+}
+
+func TestSessionManager_LogoutWhileExtending(t *testing.T) {
+	sqliteStore, err := repository.NewSQLiteSessionStore(filepath.Join(t.TempDir(), "kaimemo.db"))
+	require.NoError(t, err)
+	stores := map[string]repository.SessionStore{
+		"memory": repository.NewMemorySessionStore(),
+		"sqlite": sqliteStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			wrapped := &logoutOnFind{SessionStore: store}
+			manager := &sessionManager{store: wrapped, ttl: time.Hour, now: func() time.Time { return now }}
+			session, err := manager.CreateSession("line-user-1")
+			require.NoError(t, err)
+
+			// 期限を延長する参照の途中でログアウトしても、セッションは復活しない
+			now = now.Add(40 * time.Minute)
+			wrapped.logout = func() {
+				assert.NoError(t, manager.DestroySession(session.ID))
+			}
+			_, err = manager.GetSession(session.ID)
+			assert.ErrorIs(t, err, ErrSessionInvalid)
+			_, err = store.FindSession(session.ID)
+			assert.ErrorIs(t, err, repository.ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// チケットの用途。セッションのJWTなど、同じ鍵で署名した他のトークンと取り違えない
+const ticketAudience = "kaimemo-ws"
+
+// ErrInvalidTicket は、チケットの署名・期限・用途が正しくない場合のエラー
+var ErrInvalidTicket = errors.New("ticket is invalid")
+
+// チケット管理
+// クッキーを送れないクロスサイトのWebSocket・Server-Sent Eventsの接続で、ログイン中の利用者を示す短命の署名付きトークン
+type TicketManager interface {
+	IssueTicket(userID string) (string, time.Time, error)
+	VerifyTicket(ticket string) (string, error)
+}
+
+type ticketManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewTicketManager(secret []byte, ttl time.Duration) TicketManager {
+	return &ticketManager{secret: secret, ttl: ttl, now: time.Now}
+}
+
+// IssueTicket は、userIDのチケットと有効期限を返す
+func (t *ticketManager) IssueTicket(userID string) (string, time.Time, error) {
+	now := t.now()
+	expiresAt := now.Add(t.ttl)
+	ticket, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{ticketAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString(t.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return ticket, expiresAt, nil
+}
+
+// VerifyTicket は、チケットを検証し、userIDを返す
+func (t *ticketManager) VerifyTicket(ticket string) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(ticket, &claims, func(*jwt.Token) (interface{}, error) {
+		return t.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(ticketAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(t.now),
+	)
+	if err != nil || claims.Subject == "" {
+		return "", ErrInvalidTicket
+	}
+	return claims.Subject, nil
+}
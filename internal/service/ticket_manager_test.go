@@ -0,0 +1,47 @@
+package service
+
+import (
+	"template-echo-notion-integration/internal/shared"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketManager(t *testing.T) {
+	secret := []byte("test-secret")
+	manager := NewTicketManager(secret, time.Minute)
+
+	ticket, expiresAt, err := manager.IssueTicket("user-1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, 5*time.Second)
+	userID, err := manager.VerifyTicket(ticket)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+
+	expired, _, err := NewTicketManager(secret, -time.Minute).IssueTicket("user-1")
+	require.NoError(t, err)
+	forged, _, err := NewTicketManager([]byte("other-secret"), time.Minute).IssueTicket("user-1")
+	require.NoError(t, err)
+	// 同じ鍵で署名したセッション用のJWTは、チケットとして使えない
+	sessionJWT, err := shared.GenerateJWT("user-1", secret)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		ticket string
+	}{
+		{name: "expired", ticket: expired},
+		{name: "forged", ticket: forged},
+		{name: "other audience", ticket: sessionJWT},
+		{name: "malformed", ticket: "not-a-ticket"},
+		{name: "tampered", ticket: ticket + "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := manager.VerifyTicket(tt.ticket)
+			assert.ErrorIs(t, err, ErrInvalidTicket)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -94,7 +95,8 @@ func TestGetRequest(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				assert.Equal(t, "GET", r.Method)
-				assert.Equal(t, "Bearer "+tt.token, r.Header.Get("Authorization"))
+				// 末尾の空白はHTTPサーバー側で除去される
+				assert.Equal(t, strings.TrimSpace("Bearer "+tt.token), r.Header.Get("Authorization"))
 				w.WriteHeader(tt.statusCode)
 				w.Write([]byte(tt.response))
 			}))